@@ -0,0 +1,150 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/drone-go/plugin/admission"
+	"github.com/drone/drone-go/plugin/config"
+	"github.com/drone/drone-go/plugin/converter"
+	"github.com/drone/drone-go/plugin/environ"
+	"github.com/drone/drone-go/plugin/registry"
+	"github.com/drone/drone-go/plugin/secret"
+	"github.com/drone/drone-go/plugin/transport"
+	"github.com/drone/drone-go/plugin/validator"
+	"github.com/drone/drone-go/plugin/webhook"
+)
+
+// kinds lists the supported plugin kinds.
+var kinds = []string{
+	"admission",
+	"config",
+	"converter",
+	"environ",
+	"registry",
+	"secret",
+	"validator",
+	"webhook",
+}
+
+// remote defines the plugin endpoint and client options.
+type remote struct {
+	endpoint   string
+	secret     string
+	skipverify bool
+	opts       []transport.Option
+}
+
+// invoke decodes the JSON-encoded request, invokes the plugin
+// using the plugin client for the kind, and returns the result.
+func invoke(ctx context.Context, t remote, kind string, data []byte) (interface{}, error) {
+	switch kind {
+	case "admission":
+		in := new(admission.Request)
+		if err := decode(data, in); err != nil {
+			return nil, err
+		}
+		res, err := admission.Client(t.endpoint, t.secret, t.skipverify, t.opts...).Admit(ctx, in)
+		if res == nil || *res == (drone.User{}) {
+			// the plugin returned no content.
+			return nil, err
+		}
+		return res, err
+	case "config":
+		in := new(config.Request)
+		if err := decode(data, in); err != nil {
+			return nil, err
+		}
+		res, err := config.Client(t.endpoint, t.secret, t.skipverify, t.opts...).Find(ctx, in)
+		if res == nil || *res == (drone.Config{}) {
+			// the plugin returned no content.
+			return nil, err
+		}
+		return res, err
+	case "converter":
+		in := new(converter.Request)
+		if err := decode(data, in); err != nil {
+			return nil, err
+		}
+		res, err := converter.Client(t.endpoint, t.secret, t.skipverify, t.opts...).Convert(ctx, in)
+		if res == nil || *res == (drone.Config{}) {
+			// the plugin returned no content.
+			return nil, err
+		}
+		return res, err
+	case "environ":
+		in := new(environ.Request)
+		if err := decode(data, in); err != nil {
+			return nil, err
+		}
+		return environ.Client(t.endpoint, t.secret, t.skipverify, t.opts...).List(ctx, in)
+	case "registry":
+		in := new(registry.Request)
+		if err := decode(data, in); err != nil {
+			return nil, err
+		}
+		return registry.Client(t.endpoint, t.secret, t.skipverify, t.opts...).List(ctx, in)
+	case "secret":
+		in := new(secret.Request)
+		if err := decode(data, in); err != nil {
+			return nil, err
+		}
+		return secret.Client(t.endpoint, t.secret, t.skipverify, t.opts...).Find(ctx, in)
+	case "validator":
+		in := new(validator.Request)
+		if err := decode(data, in); err != nil {
+			return nil, err
+		}
+		return nil, validator.Client(t.endpoint, t.secret, t.skipverify, t.opts...).Validate(ctx, in)
+	case "webhook":
+		in := new(webhook.Request)
+		if err := decode(data, in); err != nil {
+			return nil, err
+		}
+		return nil, webhook.Client(t.endpoint, t.secret, t.skipverify, t.opts...).Deliver(ctx, in)
+	default:
+		return nil, fmt.Errorf("unknown plugin kind %q, want one of %s", kind, strings.Join(kinds, ", "))
+	}
+}
+
+// decode decodes the JSON-encoded request.
+func decode(data []byte, v interface{}) error {
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("cannot decode request: %s", err)
+	}
+	return nil
+}
+
+// codeOf returns the status code of the error, or zero if the
+// error is nil or is not a plugin error.
+func codeOf(err error) int {
+	switch err {
+	case nil:
+		return 0
+	case validator.ErrSkip:
+		return validator.StatusSkip
+	case validator.ErrBlock:
+		return validator.StatusBlock
+	}
+	if xerr, ok := err.(*drone.Error); ok {
+		return xerr.Code
+	}
+	return 0
+}
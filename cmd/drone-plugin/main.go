@@ -0,0 +1,244 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command drone-plugin invokes a plugin endpoint from the
+// command line. It signs the request, decrypts the response
+// and prints the decoded result, and can replay a directory of
+// request fixtures as a smoke test.
+//
+// Usage:
+//
+//	drone-plugin [flags] <kind> [request.json]
+//	drone-plugin [flags] -replay <dir>
+//
+// The request is read from the file, from stdin if the file
+// is -, or built from the request flags if no file is given.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/drone-go/plugin"
+	"github.com/drone/drone-go/plugin/transport"
+	"github.com/drone/drone-go/plugin/validator"
+)
+
+// EnvEndpoint is the environment variable that provides the
+// default plugin endpoint.
+const EnvEndpoint = "DRONE_PLUGIN_ENDPOINT"
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run runs the command and returns the exit code.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("drone-plugin", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "Usage:\n  drone-plugin [flags] <kind> [request.json]\n  drone-plugin [flags] -replay <dir>\n\n")
+		fmt.Fprintf(stderr, "Kinds:\n  %s\n\nFlags:\n", strings.Join(kinds, ", "))
+		flags.PrintDefaults()
+	}
+
+	var (
+		endpoint   = flags.String("endpoint", os.Getenv(EnvEndpoint), "plugin endpoint")
+		secret     = flags.String("secret", os.Getenv(plugin.EnvSecret), "shared secret used to sign the request")
+		keyID      = flags.String("key-id", "", "keyId used to sign the request")
+		privateKey = flags.String("private-key", "", "ed25519 or rsa private key file used to sign the request")
+		skipverify = flags.Bool("skip-verify", false, "skip tls certificate verification")
+		encrypt    = flags.Bool("encrypt", false, "request an aesgcm encrypted response")
+		accept     = flags.String("accept", "", "override the requested media type")
+		timeout    = flags.Duration("timeout", time.Minute, "request timeout")
+		replay     = flags.String("replay", "", "replay the request fixtures in the directory")
+
+		repo    = flags.String("repo", "", "repository slug")
+		branch  = flags.String("branch", "", "repository default branch")
+		private = flags.Bool("private", false, "repository is private")
+		trusted = flags.Bool("trusted", false, "repository is trusted")
+		path    = flags.String("config-path", "", "repository configuration path")
+		event   = flags.String("event", "", "build, admission or webhook event")
+		action  = flags.String("action", "", "build or webhook action")
+		ref     = flags.String("ref", "", "build ref")
+		source  = flags.String("source", "", "build source branch")
+		target  = flags.String("target", "", "build target branch")
+		commit  = flags.String("commit", "", "build commit sha")
+		fork    = flags.String("fork", "", "build source repository, for pull requests from forks")
+		name    = flags.String("name", "", "secret name")
+		user    = flags.String("user", "", "user login")
+		data    = flags.String("data", "", "configuration file used for converter and validator requests")
+	)
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	t := remote{
+		endpoint:   *endpoint,
+		secret:     *secret,
+		skipverify: *skipverify,
+		// retries are disabled so that failures are reported
+		// exactly as returned by the plugin.
+		opts: []transport.Option{transport.WithRetries(-1)},
+	}
+	if t.endpoint == "" {
+		fmt.Fprintf(stderr, "error: missing plugin endpoint\n")
+		return 2
+	}
+	if *keyID != "" {
+		t.opts = append(t.opts, transport.WithKeyID(*keyID))
+	}
+	if *privateKey != "" {
+		key, err := transport.LoadPrivateKey(*privateKey)
+		if err != nil {
+			fmt.Fprintf(stderr, "error: cannot load private key: %s\n", err)
+			return 2
+		}
+		id := *keyID
+		if id == "" {
+			id = transport.DefaultKeyID
+		}
+		t.opts = append(t.opts, transport.WithPrivateKey(id, key))
+	}
+	if *encrypt {
+		t.opts = append(t.opts, transport.WithEncryption())
+	}
+	if *accept != "" {
+		t.opts = append(t.opts, transport.WithAccept(*accept))
+	}
+
+	if *replay != "" {
+		return replayDir(t, *replay, *timeout, stdout, stderr)
+	}
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+	kind := flags.Arg(0)
+
+	var body []byte
+	var err error
+	switch file := flags.Arg(1); file {
+	case "":
+		var config string
+		config, err = readFile(*data)
+		if err != nil {
+			break
+		}
+		body, err = json.Marshal(map[string]interface{}{
+			"name":   *name,
+			"event":  *event,
+			"action": *action,
+			"user":   &drone.User{Login: *user},
+			"repo": &drone.Repo{
+				Namespace: namespace(*repo),
+				Name:      strings.TrimPrefix(*repo, namespace(*repo)+"/"),
+				Slug:      *repo,
+				Branch:    *branch,
+				Private:   *private,
+				Trusted:   *trusted,
+				Config:    *path,
+			},
+			"build": &drone.Build{
+				Event:  *event,
+				Action: *action,
+				Ref:    *ref,
+				Source: *source,
+				Target: *target,
+				After:  *commit,
+				Fork:   *fork,
+			},
+			"config": &drone.Config{Data: config},
+		})
+	case "-":
+		body, err = ioutil.ReadAll(stdin)
+	default:
+		body, err = ioutil.ReadFile(file)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "error: cannot read request: %s\n", err)
+		return 2
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	start := time.Now()
+	res, err := invoke(ctx, t, kind, body)
+	elapsed := time.Since(start)
+
+	switch {
+	case err == validator.ErrSkip:
+		fmt.Fprintln(stdout, "skip")
+	case err == validator.ErrBlock:
+		fmt.Fprintln(stdout, "block")
+	case err != nil:
+		printError(stderr, err)
+		fmt.Fprintf(stderr, "elapsed: %s\n", elapsed)
+		return 1
+	case res == nil:
+		fmt.Fprintln(stdout, "ok")
+	default:
+		out, _ := json.MarshalIndent(res, "", "  ")
+		fmt.Fprintln(stdout, string(out))
+	}
+	fmt.Fprintf(stderr, "elapsed: %s\n", elapsed)
+	return 0
+}
+
+// printError prints the error. A plugin error is printed with
+// the status code, retryable flag and details.
+func printError(w io.Writer, err error) {
+	xerr, ok := err.(*drone.Error)
+	if !ok {
+		fmt.Fprintf(w, "error: %s\n", err)
+		return
+	}
+	fmt.Fprintf(w, "error: %d %s\n", xerr.Code, xerr.Message)
+	if xerr.Retryable {
+		fmt.Fprintf(w, "retryable: true\n")
+	}
+	if xerr.Details != nil {
+		for k, v := range *xerr.Details {
+			fmt.Fprintf(w, "%s: %s\n", k, v)
+		}
+	}
+}
+
+// namespace returns the namespace of the repository slug.
+func namespace(slug string) string {
+	if i := strings.LastIndex(slug, "/"); i != -1 {
+		return slug[:i]
+	}
+	return ""
+}
+
+// readFile returns the file contents, or an empty string if
+// the path is empty.
+func readFile(path string) (string, error) {
+	if path == "" {
+		return "", nil
+	}
+	b, err := ioutil.ReadFile(path)
+	return string(b), err
+}
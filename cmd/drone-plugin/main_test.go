@@ -0,0 +1,197 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/drone-go/plugin/config"
+	"github.com/drone/drone-go/plugin/environ"
+	"github.com/drone/drone-go/plugin/secret"
+	"github.com/drone/drone-go/plugin/server"
+	"github.com/drone/drone-go/plugin/validator"
+)
+
+const key = "xVKAGlWQiY3sOp8JVc0nbuNId3PNCgWh"
+
+func TestRun(t *testing.T) {
+	ts := newServer(t)
+	defer ts.Close()
+
+	tests := []struct {
+		args []string
+		code int
+		out  string
+	}{
+		{
+			args: []string{"-name", "password", "secret"},
+			code: 0,
+			out:  `"data": "correct-horse-battery-staple"`,
+		},
+		{
+			args: []string{"-name", "password", "-encrypt", "secret"},
+			code: 0,
+			out:  `"data": "correct-horse-battery-staple"`,
+		},
+		{
+			args: []string{"-name", "unknown", "secret"},
+			code: 1,
+		},
+		{
+			args: []string{"-accept", environ.V1, "environ"},
+			code: 0,
+			out:  `"name": "GOOS"`,
+		},
+		{
+			args: []string{"-event", "cron", "validator"},
+			code: 0,
+			out:  "skip",
+		},
+		{
+			args: []string{"config"},
+			code: 0,
+			out:  "ok",
+		},
+		{
+			args: []string{"-secret", "invalid", "secret"},
+			code: 1,
+		},
+	}
+	for _, test := range tests {
+		args := append([]string{"-endpoint", ts.URL, "-secret", key}, test.args...)
+		stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+		if got, want := run(args, nil, stdout, stderr), test.code; got != want {
+			t.Errorf("Want exit code %d for %v, got %d: %s", want, test.args, got, stderr)
+		}
+		if !strings.Contains(stdout.String(), test.out) {
+			t.Errorf("Want output %q for %v, got %q", test.out, test.args, stdout)
+		}
+		if !strings.Contains(stderr.String(), "elapsed:") {
+			t.Errorf("Want elapsed time printed for %v", test.args)
+		}
+	}
+}
+
+func TestRun_Error(t *testing.T) {
+	ts := newServer(t)
+	defer ts.Close()
+
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	run([]string{"-endpoint", ts.URL, "-secret", key, "-name", "unknown", "secret"}, nil, stdout, stderr)
+	if got, want := stderr.String(), "error: 404 secret not found\n"; !strings.HasPrefix(got, want) {
+		t.Errorf("Want error %q, got %q", want, got)
+	}
+}
+
+func TestRun_DataFile(t *testing.T) {
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	code := run([]string{"-endpoint", "http://localhost", "-data", "testdata/missing.yml", "validator"}, nil, stdout, stderr)
+	if got, want := code, 2; got != want {
+		t.Errorf("Want exit code %d, got %d", want, got)
+	}
+	if got, want := stderr.String(), "error: cannot read request:"; !strings.HasPrefix(got, want) {
+		t.Errorf("Want error %q, got %q", want, got)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	ts := newServer(t)
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "drone-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fixtures := map[string]string{
+		"01_secret.json":    `{"kind":"secret","request":{"name":"password"},"result":{"name":"password","data":"correct-horse-battery-staple"}}`,
+		"02_encrypted.json": `{"kind":"secret","encrypt":true,"request":{"name":"password"}}`,
+		"03_missing.json":   `{"kind":"secret","request":{"name":"unknown"},"code":404}`,
+		"04_skip.json":      `{"kind":"validator","request":{"build":{"event":"cron"}},"code":498}`,
+		"05_wrong.json":     `{"kind":"secret","request":{"name":"password"},"result":{"data":"wrong"}}`,
+		"06_unknown.json":   `{"kind":"unknown","request":{}}`,
+	}
+	for name, data := range fixtures {
+		ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0600)
+	}
+
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	code := run([]string{"-endpoint", ts.URL, "-secret", key, "-replay", dir}, nil, stdout, stderr)
+	if got, want := code, 1; got != want {
+		t.Errorf("Want exit code %d, got %d", want, got)
+	}
+
+	out := stdout.String()
+	for _, want := range []string{
+		"PASS 01_secret.json",
+		"PASS 02_encrypted.json",
+		"PASS 03_missing.json",
+		"PASS 04_skip.json",
+		"FAIL 05_wrong.json",
+		"FAIL 06_unknown.json",
+		"4 passed, 2 failed",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Want output to contain %q, got %q", want, out)
+		}
+	}
+}
+
+func newServer(t *testing.T) *httptest.Server {
+	srv, err := server.New(key, &secretPlugin{}, &environPlugin{}, &validatorPlugin{}, &configPlugin{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return httptest.NewServer(srv.Handler())
+}
+
+type secretPlugin struct{}
+
+func (*secretPlugin) Find(ctx context.Context, req *secret.Request) (*drone.Secret, error) {
+	if req.Name != "password" {
+		return nil, &drone.Error{Code: 404, Message: "secret not found"}
+	}
+	return &drone.Secret{Name: req.Name, Data: "correct-horse-battery-staple"}, nil
+}
+
+type environPlugin struct{}
+
+func (*environPlugin) List(ctx context.Context, req *environ.Request) ([]*environ.Variable, error) {
+	return []*environ.Variable{{Name: "GOOS", Data: "linux"}}, nil
+}
+
+type validatorPlugin struct{}
+
+func (*validatorPlugin) Validate(ctx context.Context, req *validator.Request) error {
+	if req.Build.Event == "cron" {
+		return validator.ErrSkip
+	}
+	return nil
+}
+
+type configPlugin struct{}
+
+func (*configPlugin) Find(ctx context.Context, req *config.Request) (*drone.Config, error) {
+	return nil, nil
+}
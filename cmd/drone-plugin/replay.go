@@ -0,0 +1,150 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/drone/drone-go/plugin/transport"
+)
+
+// fixture defines a request fixture and the expected result.
+type fixture struct {
+	// Kind is the plugin kind.
+	Kind string `json:"kind"`
+
+	// Accept optionally overrides the requested media type.
+	Accept string `json:"accept,omitempty"`
+
+	// Encrypt requests an aesgcm encrypted response.
+	Encrypt bool `json:"encrypt,omitempty"`
+
+	// Request is the JSON-encoded plugin request.
+	Request json.RawMessage `json:"request"`
+
+	// Code is the expected error status code. Use the
+	// validator.StatusSkip (498) or validator.StatusBlock (499)
+	// code for a validator that skips or blocks the build. If
+	// zero, the request is expected to succeed.
+	Code int `json:"code,omitempty"`
+
+	// Result is the optional expected JSON-encoded result.
+	Result json.RawMessage `json:"result,omitempty"`
+}
+
+// replayDir replays the json fixtures in the directory, in
+// lexical order, and returns a non-zero exit code if any
+// fixture fails.
+func replayDir(t remote, dir string, timeout time.Duration, stdout, stderr io.Writer) int {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		fmt.Fprintf(stderr, "error: %s\n", err)
+		return 2
+	}
+	if len(files) == 0 {
+		fmt.Fprintf(stderr, "error: no fixtures found in %s\n", dir)
+		return 2
+	}
+	sort.Strings(files)
+
+	var failed int
+	for _, file := range files {
+		start := time.Now()
+		err := replayFile(t, file, timeout)
+		elapsed := time.Since(start).Round(time.Millisecond)
+		name := filepath.Base(file)
+		if err != nil {
+			failed++
+			fmt.Fprintf(stdout, "FAIL %s (%s): %s\n", name, elapsed, err)
+		} else {
+			fmt.Fprintf(stdout, "PASS %s (%s)\n", name, elapsed)
+		}
+	}
+	fmt.Fprintf(stdout, "%d passed, %d failed\n", len(files)-failed, failed)
+	if failed != 0 {
+		return 1
+	}
+	return 0
+}
+
+// replayFile replays the fixture and returns an error if the
+// result does not match the expected result.
+func replayFile(t remote, file string, timeout time.Duration) error {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	f := new(fixture)
+	if err := json.Unmarshal(data, f); err != nil {
+		return fmt.Errorf("cannot decode fixture: %s", err)
+	}
+
+	// copy the options so that fixture options are not
+	// shared between fixtures.
+	opts := append([]transport.Option{}, t.opts...)
+	if f.Accept != "" {
+		opts = append(opts, transport.WithAccept(f.Accept))
+	}
+	if f.Encrypt {
+		opts = append(opts, transport.WithEncryption())
+	}
+	t.opts = opts
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	res, err := invoke(ctx, t, f.Kind, f.Request)
+	code := codeOf(err)
+	if err != nil && code == 0 {
+		return err
+	}
+	if code != f.Code {
+		if err != nil {
+			return fmt.Errorf("want code %d, got %d: %s", f.Code, code, err)
+		}
+		return fmt.Errorf("want code %d, got success", f.Code)
+	}
+	if err != nil || len(f.Result) == 0 {
+		return nil
+	}
+
+	var got, want interface{}
+	out, _ := json.Marshal(res)
+	json.Unmarshal(out, &got)
+	if err := json.Unmarshal(f.Result, &want); err != nil {
+		return fmt.Errorf("cannot decode expected result: %s", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		return fmt.Errorf("want result %s, got %s", compact(f.Result), out)
+	}
+	return nil
+}
+
+// compact returns the compacted JSON-encoded value.
+func compact(data []byte) string {
+	out, err := json.Marshal(json.RawMessage(data))
+	if err != nil {
+		return string(data)
+	}
+	return string(out)
+}
@@ -0,0 +1,345 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command drone-secrets manages an encrypted secret store.
+//
+// Usage:
+//
+//	drone-secrets [flags] init
+//	drone-secrets [flags] add [policy flags] [-path path] <name>
+//	drone-secrets [flags] rotate [-path path] <name>
+//	drone-secrets [flags] remove [-path path] <name>
+//	drone-secrets [flags] list
+//	drone-secrets [flags] rekey
+//
+// The master key is read from the DRONE_SECRET_STORE_KEY
+// environment variable or the -key-file flag, and the new
+// master key used by rekey is read from the
+// DRONE_SECRET_STORE_NEW_KEY environment variable or the
+// -new-key-file flag. The secret data for add and rotate is
+// read from stdin, or from the -data-file flag.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/drone/drone-go/plugin/policy"
+	"github.com/drone/drone-go/plugin/secret/encrypted"
+)
+
+// Environment variables.
+const (
+	EnvStore  = "DRONE_SECRET_STORE"
+	EnvKey    = "DRONE_SECRET_STORE_KEY"
+	EnvNewKey = "DRONE_SECRET_STORE_NEW_KEY"
+)
+
+// errUsage is returned when the command is invoked with
+// invalid arguments.
+var errUsage = errors.New("invalid arguments")
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run runs the command and returns the exit code.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("drone-secrets", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "Usage:\n  drone-secrets [flags] <init|add|rotate|remove|list|rekey> [args]\n\nFlags:\n")
+		flags.PrintDefaults()
+	}
+	var (
+		store      = flags.String("store", envOr(EnvStore, "secrets.json"), "secret store file")
+		keyFile    = flags.String("key-file", "", "file containing the master key")
+		newKeyFile = flags.String("new-key-file", "", "file containing the new master key, used by rekey")
+	)
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	c := &command{
+		store:  *store,
+		stdin:  stdin,
+		stdout: stdout,
+		stderr: stderr,
+		key: func() (string, error) {
+			return readKey(EnvKey, *keyFile)
+		},
+		newKey: func() (string, error) {
+			return readKey(EnvNewKey, *newKeyFile)
+		},
+	}
+
+	var err error
+	switch cmd, args := flags.Arg(0), flags.Args()[1:]; cmd {
+	case "init":
+		err = c.init()
+	case "add":
+		err = c.add(args)
+	case "rotate":
+		err = c.rotate(args)
+	case "remove":
+		err = c.remove(args)
+	case "list":
+		err = c.list()
+	case "rekey":
+		err = c.rekey()
+	default:
+		fmt.Fprintf(stderr, "error: unknown command %q\n", cmd)
+		flags.Usage()
+		return 2
+	}
+	if err == errUsage || err == flag.ErrHelp {
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "error: %s\n", err)
+		return 1
+	}
+	return 0
+}
+
+type command struct {
+	store  string
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+	key    func() (string, error)
+	newKey func() (string, error)
+}
+
+func (c *command) init() error {
+	if _, err := os.Stat(c.store); err == nil {
+		return fmt.Errorf("store %s already exists", c.store)
+	}
+	key, err := c.key()
+	if err != nil {
+		return err
+	}
+	s, err := encrypted.Create(key)
+	if err != nil {
+		return err
+	}
+	return s.Save(c.store)
+}
+
+func (c *command) add(args []string) error {
+	flags := c.flags("add")
+	var (
+		path     = flags.String("path", "", "secret path")
+		dataFile = flags.String("data-file", "", "file containing the secret data")
+		repos    = flags.String("repos", "", "comma-separated repository glob patterns")
+		branches = flags.String("branches", "", "comma-separated branch glob patterns")
+		events   = flags.String("events", "", "comma-separated build events")
+		pulls    = flags.Bool("pull-request", false, "allow pull requests")
+		forks    = flags.Bool("fork", false, "allow pull requests from forks")
+		trusted  = flags.Bool("trusted", false, "allow only trusted repositories")
+	)
+	name, err := parseName(flags, args)
+	if err != nil {
+		return err
+	}
+	data, err := c.readData(*dataFile)
+	if err != nil {
+		return err
+	}
+	return c.update(func(s *encrypted.Store) error {
+		return s.Add(*path, name, data, policy.Policy{
+			Repos:       split(*repos),
+			Branches:    split(*branches),
+			Events:      split(*events),
+			PullRequest: *pulls,
+			Fork:        *forks,
+			Trusted:     *trusted,
+		})
+	})
+}
+
+func (c *command) rotate(args []string) error {
+	flags := c.flags("rotate")
+	path := flags.String("path", "", "secret path")
+	dataFile := flags.String("data-file", "", "file containing the secret data")
+	name, err := parseName(flags, args)
+	if err != nil {
+		return err
+	}
+	data, err := c.readData(*dataFile)
+	if err != nil {
+		return err
+	}
+	return c.update(func(s *encrypted.Store) error {
+		return s.Rotate(*path, name, data)
+	})
+}
+
+func (c *command) remove(args []string) error {
+	flags := c.flags("remove")
+	path := flags.String("path", "", "secret path")
+	name, err := parseName(flags, args)
+	if err != nil {
+		return err
+	}
+	return c.update(func(s *encrypted.Store) error {
+		return s.Remove(*path, name)
+	})
+}
+
+// list lists the secrets and their access policies. The names
+// and policies are not encrypted, so the master key is not
+// required.
+func (c *command) list() error {
+	data, err := ioutil.ReadFile(c.store)
+	if err != nil {
+		return err
+	}
+	s := new(encrypted.Store)
+	if err := json.Unmarshal(data, s); err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(c.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "PATH\tNAME\tREPOS\tBRANCHES\tEVENTS\tPULL REQUEST\tFORK\tTRUSTED\tUPDATED")
+	for _, e := range s.Secrets {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%v\t%v\t%v\t%s\n",
+			or(e.Path, "-"),
+			e.Name,
+			or(strings.Join(e.Repos, ","), "*"),
+			or(strings.Join(e.Branches, ","), "*"),
+			or(strings.Join(e.Events, ","), "*"),
+			e.PullRequest,
+			e.Fork,
+			e.Trusted,
+			time.Unix(e.Updated, 0).UTC().Format(time.RFC3339),
+		)
+	}
+	return w.Flush()
+}
+
+func (c *command) rekey() error {
+	newKey, err := c.newKey()
+	if err != nil {
+		return err
+	}
+	return c.update(func(s *encrypted.Store) error {
+		return s.Rekey(newKey)
+	})
+}
+
+// flags returns the flag set for the subcommand.
+func (c *command) flags(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	return flags
+}
+
+// update loads the store, applies the change and saves the
+// store.
+func (c *command) update(fn func(*encrypted.Store) error) error {
+	key, err := c.key()
+	if err != nil {
+		return err
+	}
+	s, err := encrypted.Load(c.store, key)
+	if err != nil {
+		return err
+	}
+	if err := fn(s); err != nil {
+		return err
+	}
+	return s.Save(c.store)
+}
+
+// readData reads the secret data from the file, or from stdin
+// if the file is empty. A single trailing newline is removed.
+func (c *command) readData(file string) (string, error) {
+	var data []byte
+	var err error
+	if file != "" {
+		data, err = ioutil.ReadFile(file)
+	} else {
+		data, err = ioutil.ReadAll(c.stdin)
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(string(data), "\n"), "\r"), nil
+}
+
+// readKey reads the master key from the file, or from the
+// environment variable if the file is empty.
+func readKey(env, file string) (string, error) {
+	if file == "" {
+		if key := os.Getenv(env); key != "" {
+			return key, nil
+		}
+		return "", fmt.Errorf("missing master key, set %s or use a key file", env)
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// parseName parses the flags and returns the secret name.
+func parseName(flags *flag.FlagSet, args []string) (string, error) {
+	if err := flags.Parse(args); err != nil {
+		return "", err
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprintf(flags.Output(), "Usage: drone-secrets %s [flags] <name>\n", flags.Name())
+		flags.PrintDefaults()
+		return "", errUsage
+	}
+	return flags.Arg(0), nil
+}
+
+// split splits the comma-separated list.
+func split(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func or(s, fallback string) string {
+	if s == "" {
+		return fallback
+	}
+	return s
+}
+
+func envOr(env, fallback string) string {
+	if v := os.Getenv(env); v != "" {
+		return v
+	}
+	return fallback
+}
@@ -0,0 +1,100 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/drone/drone-go/plugin/secret/encrypted"
+)
+
+func TestRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "drone-secrets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store := filepath.Join(dir, "secrets.json")
+	keyFile := filepath.Join(dir, "key")
+	newKeyFile := filepath.Join(dir, "new-key")
+	ioutil.WriteFile(keyFile, []byte("correct-horse-battery-staple\n"), 0600)
+	ioutil.WriteFile(newKeyFile, []byte("new-master-key\n"), 0600)
+
+	exec := func(stdin string, args ...string) (int, string) {
+		args = append([]string{"-store", store, "-key-file", keyFile, "-new-key-file", newKeyFile}, args...)
+		stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+		code := run(args, strings.NewReader(stdin), stdout, stderr)
+		return code, stdout.String() + stderr.String()
+	}
+
+	steps := []struct {
+		stdin string
+		args  []string
+		code  int
+	}{
+		{"", []string{"init"}, 0},
+		{"", []string{"init"}, 1},
+		{"foo\n", []string{"add", "-repos", "octocat/*", "-events", "push,tag", "password"}, 0},
+		{"bar\n", []string{"add", "-path", "aws", "-trusted", "access_key"}, 0},
+		{"baz\n", []string{"add", "password"}, 1},
+		{"qux\n", []string{"rotate", "password"}, 0},
+		{"qux\n", []string{"rotate", "unknown"}, 1},
+		{"", []string{"add"}, 2},
+		{"", []string{"unknown"}, 2},
+	}
+	for _, step := range steps {
+		if code, out := exec(step.stdin, step.args...); code != step.code {
+			t.Errorf("Want exit code %d for %v, got %d: %s", step.code, step.args, code, out)
+		}
+	}
+
+	_, out := exec("", "list")
+	for _, want := range []string{"password", "octocat/*", "push,tag", "access_key"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Want list output to contain %q, got %q", want, out)
+		}
+	}
+
+	if code, out := exec("", "rekey"); code != 0 {
+		t.Fatalf("Want rekey to succeed, got %s", out)
+	}
+	s, err := encrypted.Load(store, "new-master-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, data, _ := s.Get("", "password"); data != "qux" {
+		t.Errorf("Want rotated secret after rekey, got %q", data)
+	}
+	if _, data, _ := s.Get("aws", "access_key"); data != "bar" {
+		t.Errorf("Want secret after rekey, got %q", data)
+	}
+
+	// the store is now encrypted with the new master key.
+	if code, _ := exec("", "remove", "password"); code != 1 {
+		t.Errorf("Want old master key rejected after rekey")
+	}
+	os.Setenv(EnvKey, "new-master-key")
+	defer os.Unsetenv(EnvKey)
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	if code := run([]string{"-store", store, "remove", "password"}, nil, stdout, stderr); code != 0 {
+		t.Errorf("Want remove with master key from environment, got %s", stderr)
+	}
+}
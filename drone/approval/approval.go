@@ -0,0 +1,333 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package approval automatically approves or declines blocked
+// build stages based on a list of rules.
+package approval
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/drone-go/drone/deployments"
+)
+
+// ActionSkip is recorded when no rule matches a blocked stage
+// and the stage is left blocked.
+const ActionSkip = "skip"
+
+// errInvalidInterval is returned when the Run interval is not
+// positive.
+var errInvalidInterval = errors.New("approval: interval must be positive")
+
+type (
+	// Candidate is a blocked stage awaiting approval.
+	Candidate struct {
+		Namespace string
+		Name      string
+		Build     *drone.Build
+		Stage     *drone.Stage
+	}
+
+	// Decision records the action taken for a blocked stage.
+	Decision struct {
+		Repo    string    `json:"repo"`
+		Build   int64     `json:"build"`
+		Stage   int       `json:"stage"`
+		Action  string    `json:"action"`
+		Rule    string    `json:"rule,omitempty"`
+		Reason  string    `json:"reason,omitempty"`
+		Commits int       `json:"commits"`
+		DryRun  bool      `json:"dry_run,omitempty"`
+		Error   string    `json:"error,omitempty"`
+		Time    time.Time `json:"time"`
+	}
+
+	// CommitFunc returns the number of commits deployed by
+	// the promote or rollback build.
+	CommitFunc func(namespace, name string, build *drone.Build) (int, error)
+
+	// Engine evaluates the rules against blocked stages and
+	// approves or declines them. The exported fields may be
+	// changed before the Engine is used.
+	Engine struct {
+		// Rules is the ordered list of rules. The first
+		// matching rule determines the action.
+		Rules []*Rule
+
+		// DryRun evaluates and logs decisions without
+		// approving or declining stages.
+		DryRun bool
+
+		// Logger receives the audit log.
+		Logger drone.Logger
+
+		// Commits optionally counts the commits deployed by a
+		// promote or rollback build. If nil, the commits
+		// between the current deployment to the build target
+		// and the build are counted, and the build history of
+		// each repository is fetched once per Process.
+		Commits CommitFunc
+
+		client drone.Client
+		now    func() time.Time
+	}
+)
+
+// New returns a new approval Engine. An error is returned if
+// any of the rules are invalid.
+func New(client drone.Client, rules []*Rule) (*Engine, error) {
+	for _, rule := range rules {
+		if err := rule.validate(); err != nil {
+			return nil, err
+		}
+	}
+	engine := &Engine{
+		Rules:  rules,
+		Logger: drone.DiscardLogger(),
+		client: client,
+		now:    time.Now,
+	}
+	return engine, nil
+}
+
+// Run processes the blocked stages at the specified interval
+// until the context is canceled. It returns an error if the
+// interval is not positive.
+func (e *Engine) Run(ctx context.Context, interval time.Duration) error {
+	if interval <= 0 {
+		return errInvalidInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := e.Process(); err != nil {
+			e.Logger.Errorf("approval: cannot process blocked stages: %s", err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Process finds all blocked stages using the incomplete build
+// list and approves or declines them.
+func (e *Engine) Process() ([]*Decision, error) {
+	candidates, err := e.Blocked()
+	if err != nil {
+		return nil, err
+	}
+	return e.decideAll(candidates), nil
+}
+
+// ProcessRepo finds the blocked stages of the repository using
+// the recent build list and approves or declines them.
+func (e *Engine) ProcessRepo(namespace, name string) ([]*Decision, error) {
+	candidates, err := e.BlockedRepo(namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	return e.decideAll(candidates), nil
+}
+
+// Blocked returns the blocked stages of all incomplete builds.
+func (e *Engine) Blocked() ([]*Candidate, error) {
+	items, err := e.client.IncompleteV2()
+	if err != nil {
+		return nil, err
+	}
+	type key struct {
+		namespace, name string
+		number          int64
+	}
+	seen := map[key]bool{}
+	var out []*Candidate
+	for _, item := range items {
+		if item.StageStatus != drone.StatusBlocked {
+			continue
+		}
+		k := key{item.RepoNamespace, item.RepoName, item.BuildNumber}
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		res, err := e.blockedStages(k.namespace, k.name, k.number)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, res...)
+	}
+	return out, nil
+}
+
+// BlockedRepo returns the blocked stages of the recent builds
+// of the repository.
+func (e *Engine) BlockedRepo(namespace, name string) ([]*Candidate, error) {
+	builds, err := e.client.BuildList(namespace, name, drone.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	var out []*Candidate
+	for _, build := range builds {
+		if build.Status != drone.StatusBlocked {
+			continue
+		}
+		res, err := e.blockedStages(namespace, name, build.Number)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, res...)
+	}
+	return out, nil
+}
+
+// Decide evaluates the rules against the candidate and, unless
+// running in dry-run mode, approves or declines the stage.
+func (e *Engine) Decide(c *Candidate) *Decision {
+	return e.decide(c, map[string][]*drone.Build{})
+}
+
+// decide evaluates the rules against the candidate. The build
+// history of the repository is read from, and added to, the
+// history cache.
+func (e *Engine) decide(c *Candidate, history map[string][]*drone.Build) *Decision {
+	decision := &Decision{
+		Repo:   c.Namespace + "/" + c.Name,
+		Build:  c.Build.Number,
+		Stage:  c.Stage.Number,
+		Action: ActionSkip,
+		DryRun: e.DryRun,
+		Time:   e.now(),
+	}
+
+	commits, err := e.countCommits(c, history)
+	if err != nil {
+		decision.Error = err.Error()
+		decision.Reason = "cannot count commits"
+		e.audit(decision)
+		return decision
+	}
+	decision.Commits = commits
+
+	for _, rule := range e.Rules {
+		ok, reason := rule.match(decision.Repo, c.Build, commits, decision.Time)
+		if !ok {
+			e.Logger.Debugf("approval: %s#%d stage %d: rule %q not matched: %s",
+				decision.Repo, decision.Build, decision.Stage, rule.Name, reason)
+			decision.Reason = reason
+			continue
+		}
+		decision.Action = rule.Action
+		decision.Rule = rule.Name
+		decision.Reason = ""
+		break
+	}
+
+	if decision.Action != ActionSkip && !e.DryRun {
+		switch decision.Action {
+		case ActionApprove:
+			err = e.client.Approve(c.Namespace, c.Name, int(c.Build.Number), c.Stage.Number)
+		case ActionDecline:
+			err = e.client.Decline(c.Namespace, c.Name, int(c.Build.Number), c.Stage.Number)
+		}
+		if err != nil {
+			decision.Error = err.Error()
+		}
+	}
+	e.audit(decision)
+	return decision
+}
+
+func (e *Engine) decideAll(candidates []*Candidate) []*Decision {
+	// the build history is fetched once per repository and
+	// shared by all candidates.
+	history := map[string][]*drone.Build{}
+	var out []*Decision
+	for _, c := range candidates {
+		out = append(out, e.decide(c, history))
+	}
+	return out
+}
+
+// blockedStages fetches the build and returns its blocked stages.
+func (e *Engine) blockedStages(namespace, name string, number int64) ([]*Candidate, error) {
+	build, err := e.client.Build(namespace, name, int(number))
+	if err != nil {
+		return nil, err
+	}
+	var out []*Candidate
+	for _, stage := range build.Stages {
+		if stage.Status != drone.StatusBlocked {
+			continue
+		}
+		out = append(out, &Candidate{
+			Namespace: namespace,
+			Name:      name,
+			Build:     build,
+			Stage:     stage,
+		})
+	}
+	return out, nil
+}
+
+// countCommits returns the number of commits deployed by the
+// candidate build. Deployment builds are compared against the
+// current deployment to the same target. Other builds count as
+// zero commits, and do not match rules with a commit limit.
+func (e *Engine) countCommits(c *Candidate, history map[string][]*drone.Build) (int, error) {
+	if !deployments.IsDeployment(c.Build) {
+		return 0, nil
+	}
+	if e.Commits != nil {
+		return e.Commits(c.Namespace, c.Name, c.Build)
+	}
+	slug := c.Namespace + "/" + c.Name
+	builds, ok := history[slug]
+	if !ok {
+		var err error
+		builds, err = deployments.New(e.client).Builds(c.Namespace, c.Name)
+		if err != nil {
+			return 0, err
+		}
+		history[slug] = builds
+	}
+	current := deployments.NewHistory(builds).Current(c.Build.Deploy)
+	if current == nil {
+		return 0, nil
+	}
+	return len(deployments.NewDiff(builds, current, c.Build).Commits), nil
+}
+
+// audit writes the decision to the audit log.
+func (e *Engine) audit(d *Decision) {
+	mode := ""
+	if d.DryRun {
+		mode = " (dry run)"
+	}
+	switch {
+	case d.Error != "":
+		e.Logger.Errorf("approval: %s#%d stage %d: %s%s failed: %s",
+			d.Repo, d.Build, d.Stage, d.Action, mode, d.Error)
+	case d.Action == ActionSkip:
+		e.Logger.Infof("approval: %s#%d stage %d: no matching rule: %s",
+			d.Repo, d.Build, d.Stage, d.Reason)
+	default:
+		e.Logger.Infof("approval: %s#%d stage %d: %s%s by rule %q",
+			d.Repo, d.Build, d.Stage, d.Action, mode, d.Rule)
+	}
+}
@@ -0,0 +1,302 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package approval
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestProcess(t *testing.T) {
+	server := newMockServer()
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	engine, err := New(drone.New(ts.URL), []*Rule{
+		{
+			Name:    "trusted-authors",
+			Action:  ActionApprove,
+			Authors: []string{"octocat"},
+			Events:  []string{drone.EventPush},
+		},
+		{
+			Name:     "no-forks",
+			Action:   ActionDecline,
+			Branches: []string{"master"},
+			Events:   []string{drone.EventPullRequest},
+		},
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	decisions, err := engine.Process()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if got, want := len(decisions), 3; got != want {
+		t.Errorf("Want %d decisions, got %d", want, got)
+		return
+	}
+
+	want := map[int64]string{
+		1: ActionApprove,
+		2: ActionDecline,
+		3: ActionSkip,
+	}
+	for _, d := range decisions {
+		if got := d.Action; got != want[d.Build] {
+			t.Errorf("Want build %d action %s, got %s", d.Build, want[d.Build], got)
+		}
+	}
+	if diff := cmp.Diff(server.approved, []string{"1/2"}); diff != "" {
+		t.Errorf("Unexpected approvals")
+		t.Log(diff)
+	}
+	if diff := cmp.Diff(server.declined, []string{"2/1"}); diff != "" {
+		t.Errorf("Unexpected declines")
+		t.Log(diff)
+	}
+}
+
+func TestProcess_DryRun(t *testing.T) {
+	server := newMockServer()
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	engine, err := New(drone.New(ts.URL), []*Rule{
+		{Name: "all", Action: ActionApprove},
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	engine.DryRun = true
+
+	decisions, err := engine.ProcessRepo("octocat", "hello-world")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if got, want := len(decisions), 3; got != want {
+		t.Errorf("Want %d decisions, got %d", want, got)
+	}
+	for _, d := range decisions {
+		if !d.DryRun || d.Action != ActionApprove {
+			t.Errorf("Want dry run approval, got %+v", d)
+		}
+	}
+	if len(server.approved) != 0 || len(server.declined) != 0 {
+		t.Errorf("Want no approvals in dry run mode")
+	}
+}
+
+func TestProcess_MaxCommits(t *testing.T) {
+	server := newMockServer()
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	// builds 1 and 2 promote to production. Build 3 is a push,
+	// for which the number of commits is not known.
+	for _, number := range []int64{1, 2} {
+		server.builds[number].Event = drone.EventPromote
+		server.builds[number].Deploy = "production"
+	}
+
+	engine, err := New(drone.New(ts.URL), []*Rule{
+		{Name: "small", Action: ActionApprove, MaxCommits: 1},
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	engine.Commits = func(namespace, name string, build *drone.Build) (int, error) {
+		return int(build.Number), nil
+	}
+
+	decisions, err := engine.Process()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for _, d := range decisions {
+		want := ActionSkip
+		if d.Build == 1 {
+			want = ActionApprove
+		}
+		if d.Action != want {
+			t.Errorf("Want build %d %s, got %s", d.Build, want, d.Action)
+		}
+	}
+}
+
+func TestProcess_BuildHistory(t *testing.T) {
+	server := newMockServer()
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	for _, build := range server.builds {
+		build.Event = drone.EventPromote
+		build.Deploy = "production"
+	}
+
+	engine, err := New(drone.New(ts.URL), []*Rule{
+		{Name: "small", Action: ActionApprove, MaxCommits: 10},
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err := engine.Process(); err != nil {
+		t.Error(err)
+		return
+	}
+	if got, want := server.lists, 1; got != want {
+		t.Errorf("Want build history fetched %d time per Process, got %d", want, got)
+	}
+}
+
+func TestRun_Interval(t *testing.T) {
+	engine, _ := New(nil, nil)
+	if err := engine.Run(context.Background(), 0); err != errInvalidInterval {
+		t.Errorf("Want errInvalidInterval, got %v", err)
+	}
+}
+
+func TestRule_Invalid(t *testing.T) {
+	_, err := New(nil, []*Rule{{Name: "bad", Action: "merge"}})
+	if err == nil {
+		t.Errorf("Want error for invalid action")
+	}
+	_, err = New(nil, []*Rule{{Name: "bad", Action: ActionApprove, Window: &Window{Start: "25:00", End: "01:00"}}})
+	if err == nil {
+		t.Errorf("Want error for invalid window")
+	}
+}
+
+func TestWindow(t *testing.T) {
+	tests := []struct {
+		window *Window
+		time   string
+		want   bool
+	}{
+		{&Window{Start: "09:00", End: "17:00"}, "2021-01-04T10:00:00Z", true},
+		{&Window{Start: "09:00", End: "17:00"}, "2021-01-04T17:00:00Z", false},
+		{&Window{Start: "22:00", End: "06:00"}, "2021-01-04T23:30:00Z", true},
+		{&Window{Start: "22:00", End: "06:00"}, "2021-01-04T05:59:00Z", true},
+		{&Window{Start: "22:00", End: "06:00"}, "2021-01-04T12:00:00Z", false},
+		{&Window{Start: "09:00", End: "17:00", Days: []time.Weekday{time.Monday}}, "2021-01-04T10:00:00Z", true},
+		{&Window{Start: "09:00", End: "17:00", Days: []time.Weekday{time.Tuesday}}, "2021-01-04T10:00:00Z", false},
+		// 01:00 on Monday belongs to the window that started on Sunday.
+		{&Window{Start: "22:00", End: "06:00", Days: []time.Weekday{time.Sunday}}, "2021-01-04T01:00:00Z", true},
+	}
+	for i, test := range tests {
+		now, _ := time.Parse(time.RFC3339, test.time)
+		if got := test.window.Contains(now); got != test.want {
+			t.Errorf("Test %d: want %v, got %v", i, test.want, got)
+		}
+	}
+}
+
+type mockServer struct {
+	sync.Mutex
+	builds   map[int64]*drone.Build
+	approved []string
+	declined []string
+	lists    int
+}
+
+func newMockServer() *mockServer {
+	blocked := func(number int64, event, author string) *drone.Build {
+		return &drone.Build{
+			Number: number,
+			Event:  event,
+			Author: author,
+			Target: "master",
+			Status: drone.StatusBlocked,
+			Stages: []*drone.Stage{
+				{Number: 1, Status: drone.StatusPassing},
+				{Number: 2, Status: drone.StatusBlocked},
+			},
+		}
+	}
+	builds := map[int64]*drone.Build{
+		1: blocked(1, drone.EventPush, "octocat"),
+		2: blocked(2, drone.EventPullRequest, "spaceghost"),
+		3: blocked(3, drone.EventPush, "spaceghost"),
+	}
+	builds[2].Stages[0].Status = drone.StatusBlocked
+	builds[2].Stages[1].Status = drone.StatusWaiting
+	return &mockServer{builds: builds}
+}
+
+func (m *mockServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.Lock()
+	defer m.Unlock()
+
+	var out interface{}
+	switch path := r.URL.Path; {
+	case path == "/api/builds/incomplete/v2":
+		var items []*drone.RepoBuildStage
+		for _, number := range []int64{1, 2, 3} {
+			items = append(items, &drone.RepoBuildStage{
+				RepoNamespace: "octocat",
+				RepoName:      "hello-world",
+				BuildNumber:   number,
+				StageStatus:   drone.StatusBlocked,
+			})
+		}
+		out = items
+	case path == "/api/repos/octocat/hello-world/builds":
+		m.lists++
+		out = []*drone.Build{m.builds[3], m.builds[2], m.builds[1]}
+	case r.Method == "POST":
+		// path format is /api/repos/octocat/hello-world/builds/:build/:action/:stage
+		parts := strings.Split(strings.TrimPrefix(path, "/api/repos/octocat/hello-world/builds/"), "/")
+		if len(parts) != 3 {
+			w.WriteHeader(404)
+			return
+		}
+		entry := parts[0] + "/" + parts[2]
+		if parts[1] == "approve" {
+			m.approved = append(m.approved, entry)
+		} else {
+			m.declined = append(m.declined, entry)
+		}
+		w.WriteHeader(204)
+		return
+	default:
+		number, _ := strconv.ParseInt(strings.TrimPrefix(path, "/api/repos/octocat/hello-world/builds/"), 10, 64)
+		build, ok := m.builds[number]
+		if !ok {
+			w.WriteHeader(404)
+			return
+		}
+		out = build
+	}
+	_ = json.NewEncoder(w).Encode(out)
+}
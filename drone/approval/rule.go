@@ -0,0 +1,209 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package approval
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/drone-go/drone/deployments"
+)
+
+// Action values.
+const (
+	ActionApprove = "approve"
+	ActionDecline = "decline"
+)
+
+type (
+	// Rule defines the conditions under which a blocked stage
+	// is approved or declined. Empty conditions match any
+	// value. Glob patterns use path.Match syntax.
+	Rule struct {
+		// Name identifies the rule in the audit log.
+		Name string `json:"name"`
+
+		// Action is the action taken when the rule matches,
+		// either approve or decline.
+		Action string `json:"action"`
+
+		// Repos is a list of repository slug patterns.
+		Repos []string `json:"repos,omitempty"`
+
+		// Authors is a list of allowed author logins.
+		Authors []string `json:"authors,omitempty"`
+
+		// Branches is a list of target branch patterns.
+		Branches []string `json:"branches,omitempty"`
+
+		// Events is a list of build events.
+		Events []string `json:"events,omitempty"`
+
+		// Targets is a list of deployment target patterns.
+		Targets []string `json:"targets,omitempty"`
+
+		// Window restricts the rule to a time window.
+		Window *Window `json:"window,omitempty"`
+
+		// MaxCommits is the maximum number of commits deployed
+		// by a promote or rollback build, compared to the
+		// current deployment to the same target. A rule with a
+		// commit limit does not match other builds, because the
+		// Drone API does not report the number of commits in a
+		// push or pull request. A zero value disables the check.
+		MaxCommits int `json:"max_commits,omitempty"`
+	}
+
+	// Window defines a daily time window. If End is before
+	// Start the window spans midnight.
+	Window struct {
+		// Start is the start of the window in 15:04 format.
+		Start string `json:"start"`
+
+		// End is the end of the window in 15:04 format.
+		End string `json:"end"`
+
+		// Days is an optional list of weekdays on which the
+		// window applies.
+		Days []time.Weekday `json:"days,omitempty"`
+
+		// Location is the time zone of the window. If nil,
+		// UTC is used.
+		Location *time.Location `json:"-"`
+	}
+)
+
+// match returns true if the rule matches the build. If the
+// rule does not match, the reason is returned.
+func (r *Rule) match(slug string, build *drone.Build, commits int, now time.Time) (bool, string) {
+	if len(r.Repos) != 0 && !matchGlob(r.Repos, slug) {
+		return false, "repository not matched"
+	}
+	if len(r.Authors) != 0 && !matchExact(r.Authors, build.Author) {
+		return false, "author not allowed"
+	}
+	if len(r.Branches) != 0 && !matchGlob(r.Branches, build.Target) {
+		return false, "branch not matched"
+	}
+	if len(r.Events) != 0 && !matchExact(r.Events, build.Event) {
+		return false, "event not matched"
+	}
+	if len(r.Targets) != 0 && !matchGlob(r.Targets, build.Deploy) {
+		return false, "target not matched"
+	}
+	if r.Window != nil && !r.Window.Contains(now) {
+		return false, "outside time window"
+	}
+	if r.MaxCommits != 0 && !deployments.IsDeployment(build) {
+		return false, "commit limit only applies to deployments"
+	}
+	if r.MaxCommits != 0 && commits > r.MaxCommits {
+		return false, fmt.Sprintf("%d commits exceeds limit of %d", commits, r.MaxCommits)
+	}
+	return true, ""
+}
+
+// validate returns an error if the rule is invalid.
+func (r *Rule) validate() error {
+	switch r.Action {
+	case ActionApprove, ActionDecline:
+	default:
+		return fmt.Errorf("approval: rule %q: invalid action %q", r.Name, r.Action)
+	}
+	if r.Window != nil {
+		if _, err := parseClock(r.Window.Start); err != nil {
+			return fmt.Errorf("approval: rule %q: invalid window start: %s", r.Name, err)
+		}
+		if _, err := parseClock(r.Window.End); err != nil {
+			return fmt.Errorf("approval: rule %q: invalid window end: %s", r.Name, err)
+		}
+	}
+	return nil
+}
+
+// Contains returns true if the time falls within the window.
+func (w *Window) Contains(t time.Time) bool {
+	loc := w.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	t = t.In(loc)
+
+	start, err := parseClock(w.Start)
+	if err != nil {
+		return false
+	}
+	end, err := parseClock(w.End)
+	if err != nil {
+		return false
+	}
+	clock := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+
+	// the weekday of a window that spans midnight is the
+	// weekday on which the window started.
+	day := t.Weekday()
+	var inside bool
+	if start <= end {
+		inside = clock >= start && clock < end
+	} else {
+		inside = clock >= start || clock < end
+		if clock < end {
+			day = t.Add(-24 * time.Hour).Weekday()
+		}
+	}
+	if !inside {
+		return false
+	}
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, d := range w.Days {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+// parseClock parses a 15:04 time of day and returns the
+// duration since midnight.
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func matchExact(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchGlob(patterns []string, s string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, s); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -21,6 +21,16 @@ const (
 	EventTag         = "tag"
 	EventPromote     = "promote"
 	EventRollback    = "rollback"
+	EventCron        = "cron"
+	EventCustom      = "custom"
+)
+
+// Action values.
+const (
+	ActionOpened       = "opened"
+	ActionSynchronized = "synchronized"
+	ActionClosed       = "closed"
+	ActionReopened     = "reopened"
 )
 
 // Status values.
@@ -36,3 +46,10 @@ const (
 	StatusKilled   = "killed"
 	StatusError    = "error"
 )
+
+// Registry policy values.
+const (
+	RegistryPull     = "pull"
+	RegistryPush     = "push"
+	RegistryPushPull = "push-pull"
+)
@@ -0,0 +1,369 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package deployments builds a per-environment deployment
+// history from the promote and rollback builds of a repository.
+package deployments
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/drone/drone-go/drone"
+)
+
+// DefaultPageSize is the default number of builds requested
+// per page when scanning the build history.
+const DefaultPageSize = 50
+
+// DefaultMaxPages is the default maximum number of pages
+// scanned when building the deployment history.
+const DefaultMaxPages = 10
+
+// ErrNotFound is returned when no deployment matches the
+// requested target.
+var ErrNotFound = errors.New("deployments: not found")
+
+type (
+	// History is the deployment history of a repository,
+	// grouped by target environment. Deployments are sorted
+	// newest first.
+	History map[string][]*drone.Build
+
+	// Diff describes the changes between two deployments.
+	Diff struct {
+		// From is the older deployment.
+		From *drone.Build
+		// To is the newer deployment.
+		To *drone.Build
+		// Base is the commit sha deployed by From.
+		Base string
+		// Head is the commit sha deployed by To.
+		Head string
+		// Builds is the list of push builds to the deployed
+		// branch that introduced the changes from From to To,
+		// oldest first.
+		Builds []*drone.Build
+		// Commits is the list of commits introduced by Builds,
+		// oldest first.
+		Commits []string
+	}
+
+	// Tracker reads the deployment history of a repository
+	// using the Drone client. The exported fields may be
+	// changed after the Tracker is created.
+	Tracker struct {
+		// PageSize is the number of builds requested per page.
+		PageSize int
+
+		// MaxPages is the maximum number of pages scanned.
+		MaxPages int
+
+		client drone.Client
+	}
+)
+
+// New returns a new Tracker backed by the Drone client.
+func New(client drone.Client) *Tracker {
+	return &Tracker{
+		PageSize: DefaultPageSize,
+		MaxPages: DefaultMaxPages,
+		client:   client,
+	}
+}
+
+// Builds returns the recent builds of the repository, newest
+// first, scanning up to MaxPages pages of the build list.
+func (t *Tracker) Builds(namespace, name string) ([]*drone.Build, error) {
+	var out []*drone.Build
+	for page := 1; page <= t.MaxPages; page++ {
+		builds, err := t.client.BuildList(namespace, name, drone.ListOptions{
+			Page: page,
+			Size: t.PageSize,
+		})
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, builds...)
+		if len(builds) < t.PageSize {
+			break
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].Number > out[j].Number
+	})
+	return out, nil
+}
+
+// History returns the deployment history of the repository
+// grouped by target environment.
+func (t *Tracker) History(namespace, name string) (History, error) {
+	builds, err := t.Builds(namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	return NewHistory(builds), nil
+}
+
+// Current returns the deployment currently running in each
+// target environment.
+func (t *Tracker) Current(namespace, name string) (map[string]*drone.Build, error) {
+	history, err := t.History(namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	out := map[string]*drone.Build{}
+	for target := range history {
+		if build := history.Current(target); build != nil {
+			out[target] = build
+		}
+	}
+	return out, nil
+}
+
+// Previous returns the last good deployment to the target
+// environment before the current deployment.
+func (t *Tracker) Previous(namespace, name, target string) (*drone.Build, error) {
+	history, err := t.History(namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	build := history.Previous(target)
+	if build == nil {
+		return nil, ErrNotFound
+	}
+	return build, nil
+}
+
+// Diff returns the changes between two deployments of the
+// repository. The deployments may be passed in any order. It
+// returns ErrNotFound if either deployment is nil.
+func (t *Tracker) Diff(namespace, name string, a, b *drone.Build) (*Diff, error) {
+	if a == nil || b == nil {
+		return nil, ErrNotFound
+	}
+	builds, err := t.Builds(namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	return NewDiff(builds, a, b), nil
+}
+
+// RollbackToPrevious reverts the target environment to the
+// last good deployment before the current deployment.
+func (t *Tracker) RollbackToPrevious(namespace, name, target string, params map[string]string) (*drone.Build, error) {
+	prev, err := t.Previous(namespace, name, target)
+	if err != nil {
+		return nil, err
+	}
+	return t.client.Rollback(namespace, name, int(prev.Number), target, params)
+}
+
+// NewHistory groups the promote and rollback builds by target
+// environment. Other builds are ignored.
+func NewHistory(builds []*drone.Build) History {
+	history := History{}
+	for _, build := range builds {
+		if !IsDeployment(build) {
+			continue
+		}
+		history[build.Deploy] = append(history[build.Deploy], build)
+	}
+	for _, list := range history {
+		sort.SliceStable(list, func(i, j int) bool {
+			return list[i].Number > list[j].Number
+		})
+	}
+	return history
+}
+
+// Targets returns the sorted list of target environments.
+func (h History) Targets() []string {
+	var out []string
+	for target := range h {
+		out = append(out, target)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Current returns the most recent successful deployment to
+// the target environment, or nil if there is none.
+func (h History) Current(target string) *drone.Build {
+	for _, build := range h[target] {
+		if build.Status == drone.StatusPassing {
+			return build
+		}
+	}
+	return nil
+}
+
+// Previous returns the most recent successful deployment to
+// the target environment that deployed a different commit than
+// the current deployment, or nil if there is none.
+func (h History) Previous(target string) *drone.Build {
+	current := h.Current(target)
+	if current == nil {
+		return nil
+	}
+	for _, build := range h[target] {
+		if build.Number >= current.Number {
+			continue
+		}
+		if build.Status != drone.StatusPassing {
+			continue
+		}
+		if build.After == current.After {
+			continue
+		}
+		return build
+	}
+	return nil
+}
+
+// NewDiff returns the changes between deployments a and b
+// using the build list to resolve the builds in between. The
+// deployments may be passed in any order. It returns nil if
+// either deployment is nil.
+func NewDiff(builds []*drone.Build, a, b *drone.Build) *Diff {
+	if a == nil || b == nil {
+		return nil
+	}
+	if a.Number > b.Number {
+		a, b = b, a
+	}
+	diff := &Diff{
+		From: a,
+		To:   b,
+		Base: a.After,
+		Head: b.After,
+	}
+
+	index := map[int64]*drone.Build{}
+	for _, build := range builds {
+		if build != nil {
+			index[build.Number] = build
+		}
+	}
+
+	// the deployment builds reference the build that was
+	// promoted using the parent field. The changes between
+	// two deployments are the builds between the two parents.
+	lo, hi := a, b
+	if origin(index, lo) > origin(index, hi) {
+		lo, hi = hi, lo
+	}
+	from, to := origin(index, lo), origin(index, hi)
+
+	// only push builds to the deployed branch introduce
+	// commits. Pull request, cron and other branch builds are
+	// ignored.
+	branch := hi.Target
+	if build, ok := index[to]; ok {
+		branch = build.Target
+	}
+	var pushes []*drone.Build
+	for _, build := range builds {
+		if build == nil || build.Event != drone.EventPush || build.Target != branch {
+			continue
+		}
+		pushes = append(pushes, build)
+	}
+
+	// follow the Before to After chain from the newer commit
+	// to the older commit. If the chain is broken, for example
+	// because the history is truncated or the branch was force
+	// pushed, fall back to the builds numbered in between.
+	between, ok := walk(pushes, hi.After, lo.After)
+	if !ok {
+		between = nil
+		for _, build := range pushes {
+			if build.Number > from && build.Number <= to {
+				between = append(between, build)
+			}
+		}
+		sort.SliceStable(between, func(i, j int) bool {
+			return between[i].Number < between[j].Number
+		})
+	}
+
+	seen := map[string]bool{diff.Base: true}
+	for _, build := range between {
+		diff.Builds = append(diff.Builds, build)
+		if build.After == "" || seen[build.After] {
+			continue
+		}
+		seen[build.After] = true
+		diff.Commits = append(diff.Commits, build.After)
+	}
+	return diff
+}
+
+// walk returns the builds that introduced the commits from base,
+// exclusive, to head, inclusive, oldest first, by following the
+// Before commit of each build. It returns false if a commit in
+// the chain has no build.
+func walk(builds []*drone.Build, head, base string) ([]*drone.Build, bool) {
+	index := map[string]*drone.Build{}
+	for _, build := range builds {
+		// prefer the most recent build of a commit.
+		if prev, ok := index[build.After]; !ok || build.Number > prev.Number {
+			index[build.After] = build
+		}
+	}
+	var out []*drone.Build
+	seen := map[string]bool{}
+	for sha := head; sha != base; sha = index[sha].Before {
+		if _, ok := index[sha]; !ok || seen[sha] {
+			return nil, false
+		}
+		seen[sha] = true
+		out = append(out, index[sha])
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return out, true
+}
+
+// IsDeployment returns true if the build is a promote or
+// rollback build.
+func IsDeployment(build *drone.Build) bool {
+	if build == nil {
+		return false
+	}
+	switch build.Event {
+	case drone.EventPromote, drone.EventRollback:
+		return build.Deploy != ""
+	default:
+		return false
+	}
+}
+
+// origin returns the number of the build that was deployed.
+// A rollback references an earlier deployment, so the parent
+// chain is followed until a non-deployment build is reached.
+func origin(index map[int64]*drone.Build, build *drone.Build) int64 {
+	for i := 0; i < len(index)+1; i++ {
+		if !IsDeployment(build) || build.Parent == 0 {
+			break
+		}
+		parent, ok := index[build.Parent]
+		if !ok {
+			return build.Parent
+		}
+		build = parent
+	}
+	return build.Number
+}
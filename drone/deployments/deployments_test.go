@@ -0,0 +1,158 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deployments
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/google/go-cmp/cmp"
+)
+
+// mockBuilds is a build history, newest first. Builds 1, 2
+// and 4 are pushes, build 3 promotes build 2 to production,
+// build 5 promotes build 4 to production and fails, build 6
+// promotes build 4 to production and build 7 promotes build 1
+// to staging.
+var mockBuilds = []*drone.Build{
+	{Number: 7, Event: drone.EventPromote, Deploy: "staging", Parent: 1, After: "a1", Status: drone.StatusPassing},
+	{Number: 6, Event: drone.EventPromote, Deploy: "production", Parent: 4, After: "d4", Status: drone.StatusPassing},
+	{Number: 5, Event: drone.EventPromote, Deploy: "production", Parent: 4, After: "d4", Status: drone.StatusFailing},
+	{Number: 4, Event: drone.EventPush, Before: "b2", After: "d4", Status: drone.StatusPassing},
+	{Number: 3, Event: drone.EventPromote, Deploy: "production", Parent: 2, After: "b2", Status: drone.StatusPassing},
+	{Number: 2, Event: drone.EventPush, Before: "a1", After: "b2", Status: drone.StatusPassing},
+	{Number: 1, Event: drone.EventPush, After: "a1", Status: drone.StatusPassing},
+}
+
+func TestHistory(t *testing.T) {
+	history := NewHistory(mockBuilds)
+
+	if diff := cmp.Diff(history.Targets(), []string{"production", "staging"}); diff != "" {
+		t.Errorf("Unexpected targets")
+		t.Log(diff)
+	}
+	if got, want := len(history["production"]), 3; got != want {
+		t.Errorf("Want %d production deployments, got %d", want, got)
+	}
+	if got, want := history.Current("production").Number, int64(6); got != want {
+		t.Errorf("Want current production build %d, got %d", want, got)
+	}
+	if got, want := history.Previous("production").Number, int64(3); got != want {
+		t.Errorf("Want previous production build %d, got %d", want, got)
+	}
+	if got := history.Previous("staging"); got != nil {
+		t.Errorf("Want no previous staging build, got %d", got.Number)
+	}
+	if got := history.Current("qa"); got != nil {
+		t.Errorf("Want no current qa build, got %d", got.Number)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	diff := NewDiff(mockBuilds, mockBuilds[1], mockBuilds[4])
+	if got, want := diff.From.Number, int64(3); got != want {
+		t.Errorf("Want diff from build %d, got %d", want, got)
+	}
+	if got, want := diff.Base, "b2"; got != want {
+		t.Errorf("Want diff base %s, got %s", want, got)
+	}
+	if got, want := diff.Head, "d4"; got != want {
+		t.Errorf("Want diff head %s, got %s", want, got)
+	}
+	if diff := cmp.Diff(diff.Commits, []string{"d4"}); diff != "" {
+		t.Errorf("Unexpected commits")
+		t.Log(diff)
+	}
+}
+
+func TestDiff_Rollback(t *testing.T) {
+	rollback := &drone.Build{Number: 8, Event: drone.EventRollback, Deploy: "production", Parent: 3, After: "b2"}
+	builds := append([]*drone.Build{rollback}, mockBuilds...)
+
+	diff := NewDiff(builds, rollback, mockBuilds[1])
+	if got, want := len(diff.Builds), 1; got != want {
+		t.Errorf("Want %d builds between deployments, got %d", want, got)
+	}
+}
+
+func TestDiff_Branch(t *testing.T) {
+	builds := []*drone.Build{
+		{Number: 9, Event: drone.EventPromote, Deploy: "production", Parent: 7, Target: "master", After: "c3"},
+		{Number: 8, Event: drone.EventCron, Target: "master", After: "c3"},
+		{Number: 7, Event: drone.EventPush, Target: "master", Before: "b2", After: "c3"},
+		{Number: 6, Event: drone.EventPush, Target: "develop", Before: "x1", After: "x2"},
+		{Number: 5, Event: drone.EventPullRequest, Target: "master", After: "p1"},
+		{Number: 4, Event: drone.EventPush, Target: "master", Before: "a1", After: "b2"},
+		{Number: 3, Event: drone.EventPromote, Deploy: "production", Parent: 1, Target: "master", After: "a1"},
+		{Number: 2, Event: drone.EventTag, Target: "master", After: "t1"},
+		{Number: 1, Event: drone.EventPush, Target: "master", After: "a1"},
+		nil,
+	}
+	diff := NewDiff(builds, builds[0], builds[6])
+	if diff := cmp.Diff(diff.Commits, []string{"b2", "c3"}); diff != "" {
+		t.Errorf("Want only commits pushed to the deployed branch")
+		t.Log(diff)
+	}
+	if got, want := len(diff.Builds), 2; got != want {
+		t.Errorf("Want %d builds between deployments, got %d", want, got)
+	}
+}
+
+func TestDiff_Nil(t *testing.T) {
+	if diff := NewDiff(mockBuilds, nil, mockBuilds[1]); diff != nil {
+		t.Errorf("Want nil diff for nil deployment")
+	}
+	tracker := New(nil)
+	if _, err := tracker.Diff("octocat", "hello-world", mockBuilds[1], nil); err != ErrNotFound {
+		t.Errorf("Want ErrNotFound, got %v", err)
+	}
+}
+
+func TestRollbackToPrevious(t *testing.T) {
+	var rollback string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/api/repos/octocat/hello-world/builds":
+			_ = json.NewEncoder(w).Encode(mockBuilds)
+		case r.Method == "POST" && r.URL.Path == "/api/repos/octocat/hello-world/builds/3/rollback":
+			rollback = r.URL.Query().Get("target")
+			_ = json.NewEncoder(w).Encode(&drone.Build{Number: 8, Event: drone.EventRollback})
+		default:
+			w.WriteHeader(404)
+		}
+	}))
+	defer ts.Close()
+
+	tracker := New(drone.New(ts.URL))
+	build, err := tracker.RollbackToPrevious("octocat", "hello-world", "production", nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if got, want := build.Number, int64(8); got != want {
+		t.Errorf("Want rollback build %d, got %d", want, got)
+	}
+	if got, want := rollback, "production"; got != want {
+		t.Errorf("Want rollback target %s, got %s", want, got)
+	}
+
+	_, err = tracker.RollbackToPrevious("octocat", "hello-world", "staging", nil)
+	if err != ErrNotFound {
+		t.Errorf("Want ErrNotFound, got %v", err)
+	}
+}
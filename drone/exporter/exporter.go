@@ -0,0 +1,396 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package exporter publishes Drone server metrics in the
+// Prometheus text exposition format.
+package exporter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/drone/drone-go/drone"
+)
+
+// ContentType is the media type of the text exposition format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultInterval is the default refresh interval.
+const DefaultInterval = time.Minute
+
+// DefaultPageSize is the default number of recent builds
+// inspected per repository.
+const DefaultPageSize = 25
+
+// repoPageSize is the number of repositories requested per
+// page when listing all repositories.
+const repoPageSize = 100
+
+// errInvalidInterval is returned when the Run interval is not
+// positive.
+var errInvalidInterval = errors.New("exporter: interval must be positive")
+
+// Exporter collects metrics from the Drone server and serves
+// the most recent snapshot over http. The exported fields
+// must be set before calling Run.
+type Exporter struct {
+	// Interval is the duration between refreshes.
+	Interval time.Duration
+
+	// PageSize is the number of recent builds inspected
+	// per repository when counting builds.
+	PageSize int
+
+	client drone.Client
+	now    func() time.Time
+
+	mu       sync.RWMutex
+	snapshot []byte
+	count    int
+
+	// first guards the refresh on the first scrape, so that
+	// concurrent scrapes do not each collect the metrics.
+	first sync.Once
+}
+
+// New returns a new Exporter backed by the Drone client. The
+// client must authenticate as an administrator, since the
+// exporter lists all repositories and users.
+func New(client drone.Client) *Exporter {
+	return &Exporter{
+		Interval: DefaultInterval,
+		PageSize: DefaultPageSize,
+		client:   client,
+		now:      time.Now,
+	}
+}
+
+// Run refreshes the metrics snapshot at the configured
+// interval until the context is canceled. It returns an error
+// if the interval is not positive.
+func (e *Exporter) Run(ctx context.Context) error {
+	if e.Interval <= 0 {
+		return errInvalidInterval
+	}
+	_ = e.Refresh()
+
+	ticker := time.NewTicker(e.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			_ = e.Refresh()
+		}
+	}
+}
+
+// Refresh collects the metrics from the Drone server and
+// replaces the cached snapshot. Metrics that cannot be
+// collected are omitted and reported through the
+// drone_exporter_up gauge.
+func (e *Exporter) Refresh() error {
+	families, err := e.collect()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.count++
+
+	up := &family{
+		name: "drone_exporter_up",
+		help: "Whether the last refresh collected all metrics successfully.",
+		kind: typeGauge,
+	}
+	if err != nil {
+		up.add(0)
+	} else {
+		up.add(1)
+	}
+	refreshes := &family{
+		name: "drone_exporter_refreshes_total",
+		help: "Total number of metric refreshes.",
+		kind: typeCounter,
+	}
+	refreshes.add(float64(e.count))
+	timestamp := &family{
+		name: "drone_exporter_last_refresh_timestamp_seconds",
+		help: "Unix time of the last metric refresh.",
+		kind: typeGauge,
+	}
+	timestamp.add(float64(e.now().Unix()))
+	families = append(families, up, refreshes, timestamp)
+
+	buf := new(bytes.Buffer)
+	for _, f := range families {
+		f.sortSamples()
+		f.write(buf)
+	}
+	e.snapshot = buf.Bytes()
+	return err
+}
+
+// ServeHTTP writes the cached metrics snapshot to the http
+// response. If the metrics have not yet been collected, the
+// snapshot is refreshed once before it is written, and
+// concurrent requests wait for that refresh.
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.first.Do(func() {
+		e.mu.RLock()
+		out := e.snapshot
+		e.mu.RUnlock()
+		if out == nil {
+			_ = e.Refresh()
+		}
+	})
+
+	e.mu.RLock()
+	out := e.snapshot
+	e.mu.RUnlock()
+
+	w.Header().Set("Content-Type", ContentType)
+	_, _ = w.Write(out)
+}
+
+// collect gathers all metric families. Collection continues
+// when an individual endpoint fails, and the first error is
+// returned. The nodes are listed once and shared by the node
+// and queue metrics.
+func (e *Exporter) collect() ([]*family, error) {
+	var families []*family
+	var first error
+	add := func(res []*family, err error) {
+		if err != nil && first == nil {
+			first = err
+		}
+		families = append(families, res...)
+	}
+	add(e.collectBuilds())
+	add(e.collectStages())
+	if nodes, err := e.client.NodeList(); err != nil {
+		add(nil, err)
+	} else {
+		add(e.collectNodes(nodes), nil)
+		add(e.collectQueue(nodes))
+	}
+	add(e.collectUsers())
+	return families, first
+}
+
+// listRepos returns all repositories, requesting one page at
+// a time until a partial page is returned.
+func (e *Exporter) listRepos() ([]*drone.Repo, error) {
+	var out []*drone.Repo
+	for page := 1; ; page++ {
+		repos, err := e.client.RepoListAll(drone.ListOptions{
+			Page: page,
+			Size: repoPageSize,
+		})
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, repos...)
+		if len(repos) < repoPageSize {
+			return out, nil
+		}
+	}
+}
+
+// collectBuilds counts recent builds by status and event
+// and reports the age of the latest build per repository. A
+// repository whose builds cannot be listed is skipped and
+// counted, and the first error is returned.
+func (e *Exporter) collectBuilds() ([]*family, error) {
+	repos, err := e.listRepos()
+	if err != nil {
+		return nil, err
+	}
+
+	type key struct{ status, event string }
+	counts := map[key]int{}
+	age := &family{
+		name: "drone_repo_last_build_age_seconds",
+		help: "Seconds since the latest build was created, by repository.",
+		kind: typeGauge,
+	}
+
+	now := e.now().Unix()
+	var failed int
+	var first error
+	for _, repo := range repos {
+		if !repo.Active {
+			continue
+		}
+		builds, err := e.client.BuildList(repo.Namespace, repo.Name, drone.ListOptions{Size: e.PageSize})
+		if err != nil {
+			if first == nil {
+				first = fmt.Errorf("exporter: cannot list builds for %s: %w", repo.Slug, err)
+			}
+			failed++
+			continue
+		}
+		var latest int64
+		for _, build := range builds {
+			counts[key{build.Status, build.Event}]++
+			if build.Created > latest {
+				latest = build.Created
+			}
+		}
+		if latest != 0 {
+			age.add(float64(now-latest), "repo", repo.Slug)
+		}
+	}
+
+	total := &family{
+		name: "drone_builds",
+		help: "Number of recent builds by status and event.",
+		kind: typeGauge,
+	}
+	for k, v := range counts {
+		total.add(float64(v), "status", k.status, "event", k.event)
+	}
+	errs := &family{
+		name: "drone_repo_build_errors",
+		help: "Number of repositories whose builds could not be listed.",
+		kind: typeGauge,
+	}
+	errs.add(float64(failed))
+	return []*family{total, age, errs}, first
+}
+
+// collectStages counts the running and pending stages.
+func (e *Exporter) collectStages() ([]*family, error) {
+	items, err := e.client.IncompleteV2()
+	if err != nil {
+		return nil, err
+	}
+	counts := map[string]int{
+		drone.StatusRunning: 0,
+		drone.StatusPending: 0,
+	}
+	for _, item := range items {
+		if _, ok := counts[item.StageStatus]; ok {
+			counts[item.StageStatus]++
+		}
+	}
+	stages := &family{
+		name: "drone_stages",
+		help: "Number of incomplete stages by status.",
+		kind: typeGauge,
+	}
+	for status, v := range counts {
+		stages.add(float64(v), "status", status)
+	}
+	return []*family{stages}, nil
+}
+
+// collectNodes counts the registered nodes by state.
+func (e *Exporter) collectNodes(nodes []*drone.Node) []*family {
+	counts := map[string]int{}
+	paused := 0
+	for _, node := range nodes {
+		counts[node.State]++
+		if node.Paused {
+			paused++
+		}
+	}
+	states := &family{
+		name: "drone_nodes",
+		help: "Number of nodes by state.",
+		kind: typeGauge,
+	}
+	for state, v := range counts {
+		states.add(float64(v), "state", state)
+	}
+	pausedNodes := &family{
+		name: "drone_nodes_paused",
+		help: "Number of paused nodes.",
+		kind: typeGauge,
+	}
+	pausedNodes.add(float64(paused))
+	return []*family{states, pausedNodes}
+}
+
+// collectQueue reports the queue depth and whether the queue
+// is paused. The Drone API does not expose the paused flag
+// directly, so the queue is reported as paused when at least
+// one node is registered and every registered node is paused.
+func (e *Exporter) collectQueue(nodes []*drone.Node) ([]*family, error) {
+	items, err := e.client.Queue()
+	if err != nil {
+		return nil, err
+	}
+	depth := &family{
+		name: "drone_queue_items",
+		help: "Number of stages in the queue.",
+		kind: typeGauge,
+	}
+	depth.add(float64(len(items)))
+
+	paused := len(nodes) != 0
+	for _, node := range nodes {
+		if !node.Paused {
+			paused = false
+			break
+		}
+	}
+	state := &family{
+		name: "drone_queue_paused",
+		help: "Whether queue processing is paused.",
+		kind: typeGauge,
+	}
+	if paused {
+		state.add(1)
+	} else {
+		state.add(0)
+	}
+	return []*family{depth, state}, nil
+}
+
+// collectUsers counts the registered users by kind.
+func (e *Exporter) collectUsers() ([]*family, error) {
+	users, err := e.client.UserList()
+	if err != nil {
+		return nil, err
+	}
+	counts := map[string]int{
+		"admin":   0,
+		"machine": 0,
+		"user":    0,
+	}
+	for _, user := range users {
+		switch {
+		case user.Machine:
+			counts["machine"]++
+		case user.Admin:
+			counts["admin"]++
+		default:
+			counts["user"]++
+		}
+	}
+	total := &family{
+		name: "drone_users",
+		help: "Number of registered users by kind.",
+		kind: typeGauge,
+	}
+	for kind, v := range counts {
+		total.add(float64(v), "kind", kind)
+	}
+	return []*family{total}, nil
+}
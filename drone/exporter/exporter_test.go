@@ -0,0 +1,239 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/drone/drone-go/drone"
+)
+
+func TestExporter(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(mockHandler))
+	defer ts.Close()
+
+	exporter := New(drone.New(ts.URL))
+	exporter.now = func() time.Time { return time.Unix(1000, 0) }
+
+	res := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	exporter.ServeHTTP(res, req)
+
+	if got, want := res.Header().Get("Content-Type"), ContentType; got != want {
+		t.Errorf("Want Content-Type %q, got %q", want, got)
+	}
+
+	body := res.Body.String()
+	for _, want := range []string{
+		"# TYPE drone_builds gauge\n",
+		`drone_builds{event="push",status="success"} 2` + "\n",
+		`drone_builds{event="pull_request",status="failure"} 1` + "\n",
+		`drone_repo_last_build_age_seconds{repo="octocat/hello-world"} 100` + "\n",
+		`drone_stages{status="running"} 1` + "\n",
+		`drone_stages{status="pending"} 2` + "\n",
+		`drone_nodes{state="running"} 2` + "\n",
+		"drone_nodes_paused 1\n",
+		"drone_repo_build_errors 0\n",
+		"drone_queue_items 2\n",
+		"drone_queue_paused 0\n",
+		`drone_users{kind="admin"} 1` + "\n",
+		`drone_users{kind="machine"} 1` + "\n",
+		`drone_users{kind="user"} 0` + "\n",
+		"drone_exporter_up 1\n",
+		"drone_exporter_refreshes_total 1\n",
+		"drone_exporter_last_refresh_timestamp_seconds 1000\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Want metric %q in response\n%s", want, body)
+		}
+	}
+}
+
+func TestExporter_Error(t *testing.T) {
+	ts := httptest.NewServer(http.NotFoundHandler())
+	defer ts.Close()
+
+	exporter := New(drone.New(ts.URL))
+	if err := exporter.Refresh(); err == nil {
+		t.Errorf("Want error when the server is unavailable")
+	}
+
+	res := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	exporter.ServeHTTP(res, req)
+
+	if body := res.Body.String(); !strings.Contains(body, "drone_exporter_up 0\n") {
+		t.Errorf("Want drone_exporter_up 0, got\n%s", body)
+	}
+}
+
+func TestExporter_RepoError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/repos" {
+			_ = json.NewEncoder(w).Encode([]*drone.Repo{
+				{Namespace: "octocat", Name: "broken", Slug: "octocat/broken", Active: true},
+				{Namespace: "octocat", Name: "hello-world", Slug: "octocat/hello-world", Active: true},
+			})
+			return
+		}
+		mockHandler(w, r)
+	}))
+	defer ts.Close()
+
+	exporter := New(drone.New(ts.URL))
+	exporter.now = func() time.Time { return time.Unix(1000, 0) }
+	if err := exporter.Refresh(); err == nil || !strings.Contains(err.Error(), "octocat/broken") {
+		t.Errorf("Want error for the failing repository, got %v", err)
+	}
+
+	res := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	exporter.ServeHTTP(res, req)
+
+	body := res.Body.String()
+	for _, want := range []string{
+		`drone_builds{event="push",status="success"} 2` + "\n",
+		`drone_repo_last_build_age_seconds{repo="octocat/hello-world"} 100` + "\n",
+		"drone_repo_build_errors 1\n",
+		"drone_exporter_up 0\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Want metric %q in response\n%s", want, body)
+		}
+	}
+}
+
+func TestExporter_Requests(t *testing.T) {
+	var mu sync.Mutex
+	requests := map[string]int{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path]++
+		mu.Unlock()
+		// the first page is full, so the exporter requests the
+		// next page.
+		if r.URL.Path == "/api/repos" && r.URL.Query().Get("page") == "1" {
+			var repos []*drone.Repo
+			for i := 0; i < repoPageSize; i++ {
+				repos = append(repos, &drone.Repo{Namespace: "octocat", Name: "inactive"})
+			}
+			_ = json.NewEncoder(w).Encode(repos)
+			return
+		}
+		mockHandler(w, r)
+	}))
+	defer ts.Close()
+
+	exporter := New(drone.New(ts.URL))
+	exporter.now = func() time.Time { return time.Unix(1000, 0) }
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/metrics", nil)
+			exporter.ServeHTTP(res, req)
+			if body := res.Body.String(); !strings.Contains(body, "drone_exporter_refreshes_total 1\n") {
+				t.Errorf("Want a single refresh, got\n%s", body)
+			}
+		}()
+	}
+	wg.Wait()
+
+	for path, want := range map[string]int{
+		"/api/repos":                            2,
+		"/api/repos/octocat/hello-world/builds": 1,
+		"/api/nodes":                            1,
+		"/api/queue":                            1,
+		"/api/users":                            1,
+	} {
+		if got := requests[path]; got != want {
+			t.Errorf("Want %d requests to %s, got %d", want, path, got)
+		}
+	}
+}
+
+func TestRun_Interval(t *testing.T) {
+	exporter := New(drone.New("http://localhost"))
+	exporter.Interval = 0
+	if err := exporter.Run(context.Background()); err != errInvalidInterval {
+		t.Errorf("Want errInvalidInterval, got %v", err)
+	}
+}
+
+func TestEscapeLabel(t *testing.T) {
+	f := &family{name: "test", help: "help\ntext", kind: typeGauge}
+	f.add(1.5, "name", "a\"b\\c\nd")
+
+	buf := new(bytes.Buffer)
+	f.write(buf)
+
+	want := "# HELP test help\\ntext\n# TYPE test gauge\ntest{name=\"a\\\"b\\\\c\\nd\"} 1.5\n"
+	if got := buf.String(); got != want {
+		t.Errorf("Want output %q, got %q", want, got)
+	}
+}
+
+func mockHandler(w http.ResponseWriter, r *http.Request) {
+	var out interface{}
+	switch r.URL.Path {
+	case "/api/repos":
+		out = []*drone.Repo{
+			{Namespace: "octocat", Name: "hello-world", Slug: "octocat/hello-world", Active: true},
+			{Namespace: "octocat", Name: "inactive", Slug: "octocat/inactive"},
+		}
+	case "/api/repos/octocat/hello-world/builds":
+		out = []*drone.Build{
+			{Number: 3, Status: drone.StatusPassing, Event: drone.EventPush, Created: 900},
+			{Number: 2, Status: drone.StatusFailing, Event: drone.EventPullRequest, Created: 800},
+			{Number: 1, Status: drone.StatusPassing, Event: drone.EventPush, Created: 700},
+		}
+	case "/api/builds/incomplete/v2":
+		out = []*drone.RepoBuildStage{
+			{RepoSlug: "octocat/hello-world", StageStatus: drone.StatusRunning},
+			{RepoSlug: "octocat/hello-world", StageStatus: drone.StatusPending},
+			{RepoSlug: "octocat/hello-world", StageStatus: drone.StatusPending},
+		}
+	case "/api/nodes":
+		out = []*drone.Node{
+			{Name: "node1", State: "running"},
+			{Name: "node2", State: "running", Paused: true},
+		}
+	case "/api/queue":
+		out = []*drone.Stage{
+			{Status: drone.StatusPending},
+			{Status: drone.StatusPending},
+		}
+	case "/api/users":
+		out = []*drone.User{
+			{Login: "octocat", Admin: true},
+			{Login: "robot", Machine: true},
+		}
+	default:
+		w.WriteHeader(404)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(out)
+}
@@ -0,0 +1,130 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// metric types supported by the text exposition format.
+const (
+	typeGauge   = "gauge"
+	typeCounter = "counter"
+)
+
+// family is a named group of samples that share the same
+// help text and metric type.
+type family struct {
+	name    string
+	help    string
+	kind    string
+	samples []*sample
+}
+
+// sample is a single labeled value in a metric family.
+type sample struct {
+	labels map[string]string
+	value  float64
+}
+
+// add appends a sample with the given label pairs, where
+// pairs is a flat list of alternating names and values.
+func (f *family) add(value float64, pairs ...string) {
+	labels := map[string]string{}
+	for i := 0; i+1 < len(pairs); i += 2 {
+		labels[pairs[i]] = pairs[i+1]
+	}
+	f.samples = append(f.samples, &sample{labels: labels, value: value})
+}
+
+// write writes the family to the buffer using the
+// prometheus text exposition format.
+func (f *family) write(buf *bytes.Buffer) {
+	fmt.Fprintf(buf, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+	fmt.Fprintf(buf, "# TYPE %s %s\n", f.name, f.kind)
+	for _, s := range f.samples {
+		buf.WriteString(f.name)
+		if len(s.labels) != 0 {
+			keys := make([]string, 0, len(s.labels))
+			for k := range s.labels {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			buf.WriteByte('{')
+			for i, k := range keys {
+				if i != 0 {
+					buf.WriteByte(',')
+				}
+				fmt.Fprintf(buf, "%s=\"%s\"", k, escapeLabel(s.labels[k]))
+			}
+			buf.WriteByte('}')
+		}
+		buf.WriteByte(' ')
+		buf.WriteString(formatValue(s.value))
+		buf.WriteByte('\n')
+	}
+}
+
+// sortSamples sorts the samples by label values so that the
+// output is stable across refreshes.
+func (f *family) sortSamples() {
+	sort.SliceStable(f.samples, func(i, j int) bool {
+		return labelString(f.samples[i].labels) < labelString(f.samples[j].labels)
+	})
+}
+
+func labelString(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, k+"="+labels[k])
+	}
+	return strings.Join(parts, ",")
+}
+
+var (
+	helpReplacer  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpReplacer.Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return labelReplacer.Replace(s)
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, +1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
@@ -0,0 +1,36 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drone
+
+// Logger is the logger used by the packages that automate the
+// Drone server, such as approval and retry. It is a subset of
+// the plugin logger.Logger interface, so that the same logger
+// can be used for plugins and clients.
+type Logger interface {
+	Debugf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+// DiscardLogger returns a no-op Logger.
+func DiscardLogger() Logger {
+	return discardLogger{}
+}
+
+type discardLogger struct{}
+
+func (discardLogger) Debugf(format string, args ...interface{}) {}
+func (discardLogger) Infof(format string, args ...interface{})  {}
+func (discardLogger) Errorf(format string, args ...interface{}) {}
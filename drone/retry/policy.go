@@ -0,0 +1,128 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package retry
+
+import (
+	"path"
+	"regexp"
+	"time"
+
+	"github.com/drone/drone-go/drone"
+)
+
+// Default policy values.
+const (
+	DefaultMaxPerCommit = 2
+	DefaultMaxPerRepo   = 10
+	DefaultWindow       = time.Hour
+	DefaultMaxAge       = time.Hour
+	DefaultTail         = 50
+)
+
+type (
+	// Pattern identifies a known flaky failure. A failed step
+	// matches if its name matches one of the step patterns and
+	// its log tail matches one of the log expressions. Empty
+	// lists match any value, but a pattern must define at
+	// least one step or log condition.
+	Pattern struct {
+		// Name identifies the pattern in the decision log.
+		Name string
+
+		// Steps is a list of step name patterns using
+		// path.Match syntax.
+		Steps []string
+
+		// Logs is a list of regular expressions matched
+		// against the tail of the step logs.
+		Logs []*regexp.Regexp
+	}
+
+	// Policy defines which failures are retried and the retry
+	// budget. Zero and negative values are replaced with the
+	// defaults.
+	Policy struct {
+		// Patterns is the list of known flaky failures.
+		Patterns []*Pattern
+
+		// MaxPerCommit is the maximum number of automatic
+		// retries for a single commit.
+		MaxPerCommit int
+
+		// MaxPerRepo is the maximum number of automatic
+		// retries per repository within the Window.
+		MaxPerRepo int
+
+		// Window is the sliding window for MaxPerRepo.
+		Window time.Duration
+
+		// MaxAge is the maximum age of a failed build. Older
+		// failures are ignored.
+		MaxAge time.Duration
+
+		// Tail is the number of trailing log lines matched
+		// against the log expressions.
+		Tail int
+	}
+)
+
+// defaults returns a copy of the policy with zero and
+// negative values replaced by the defaults.
+func (p Policy) defaults() Policy {
+	if p.MaxPerCommit <= 0 {
+		p.MaxPerCommit = DefaultMaxPerCommit
+	}
+	if p.MaxPerRepo <= 0 {
+		p.MaxPerRepo = DefaultMaxPerRepo
+	}
+	if p.Window <= 0 {
+		p.Window = DefaultWindow
+	}
+	if p.MaxAge <= 0 {
+		p.MaxAge = DefaultMaxAge
+	}
+	if p.Tail <= 0 {
+		p.Tail = DefaultTail
+	}
+	return p
+}
+
+// matchStep returns true if the step name matches the pattern.
+func (p *Pattern) matchStep(step *drone.Step) bool {
+	if len(p.Steps) == 0 {
+		return true
+	}
+	for _, pattern := range p.Steps {
+		if ok, _ := path.Match(pattern, step.Name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// matchLogs returns true if any log line matches the pattern.
+func (p *Pattern) matchLogs(lines []*drone.Line) bool {
+	if len(p.Logs) == 0 {
+		return true
+	}
+	for _, re := range p.Logs {
+		for _, line := range lines {
+			if re.MatchString(line.Message) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,409 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package retry automatically restarts builds that failed
+// because of known flaky failures, within a retry budget.
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/drone/drone-go/drone"
+)
+
+// Param is the build parameter that records the automatic
+// retry attempt of a restarted build.
+const Param = "DRONE_AUTO_RETRY"
+
+// maxDecisions is the maximum number of decisions retained.
+const maxDecisions = 1000
+
+// pruneInterval is the minimum duration between removals of
+// the builds and commits that are older than the policy
+// MaxAge.
+const pruneInterval = time.Minute
+
+// errInvalidInterval is returned when the Run interval is not
+// positive.
+var errInvalidInterval = errors.New("retry: interval must be positive")
+
+// Action values.
+const (
+	ActionRetry = "retry"
+	ActionSkip  = "skip"
+)
+
+// Decision records the outcome of evaluating a failed build.
+type Decision struct {
+	Repo      string    `json:"repo"`
+	Build     int64     `json:"build"`
+	Commit    string    `json:"commit"`
+	Action    string    `json:"action"`
+	Pattern   string    `json:"pattern,omitempty"`
+	Step      string    `json:"step,omitempty"`
+	Attempt   int       `json:"attempt,omitempty"`
+	Restarted int64     `json:"restarted,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	Time      time.Time `json:"time"`
+}
+
+// Retrier restarts failed builds that match the policy. A
+// Retrier is safe for concurrent use.
+type Retrier struct {
+	client drone.Client
+	policy Policy
+	logger drone.Logger
+	now    func() time.Time
+
+	mu        sync.Mutex
+	seen      map[string]time.Time
+	commits   map[string]*attempts
+	restarts  map[string][]time.Time
+	decisions []*Decision
+	pruned    time.Time
+}
+
+// attempts records the retry attempts of a commit.
+type attempts struct {
+	count   int
+	updated time.Time
+}
+
+// New returns a new Retrier backed by the Drone client.
+func New(client drone.Client, policy Policy, logs drone.Logger) *Retrier {
+	if logs == nil {
+		logs = drone.DiscardLogger()
+	}
+	return &Retrier{
+		client:   client,
+		policy:   policy.defaults(),
+		logger:   logs,
+		now:      time.Now,
+		seen:     map[string]time.Time{},
+		commits:  map[string]*attempts{},
+		restarts: map[string][]time.Time{},
+	}
+}
+
+// Run checks the recent builds of the repositories at the
+// specified interval until the context is canceled. The
+// repositories are identified by slug. It returns an error if
+// the interval is not positive.
+func (r *Retrier) Run(ctx context.Context, interval time.Duration, repos ...string) error {
+	if interval <= 0 {
+		return errInvalidInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		for _, slug := range repos {
+			namespace, name := splitSlug(slug)
+			if _, err := r.Check(namespace, name); err != nil {
+				r.logger.Errorf("retry: %s: cannot check builds: %s", slug, err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check evaluates the recently failed builds of the repository
+// and restarts the builds that match the policy. A failed build
+// is only evaluated once.
+func (r *Retrier) Check(namespace, name string) ([]*Decision, error) {
+	r.prune()
+	builds, err := r.client.BuildList(namespace, name, drone.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	var out []*Decision
+	for _, build := range builds {
+		if !failed(build.Status) || r.expired(build) {
+			continue
+		}
+		key := fmt.Sprintf("%s/%s#%d", namespace, name, build.Number)
+		if r.markSeen(key) {
+			continue
+		}
+		decision, err := r.evaluate(namespace, name, build.Number)
+		if err != nil {
+			r.unmarkSeen(key)
+			return out, err
+		}
+		out = append(out, decision)
+	}
+	return out, nil
+}
+
+// Decisions returns the most recent decisions recorded by
+// the Retrier.
+func (r *Retrier) Decisions() []*Decision {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]*Decision, len(r.decisions))
+	copy(out, r.decisions)
+	return out
+}
+
+// evaluate fetches the failed build, matches the failed steps
+// against the policy and restarts the build if the budget
+// allows it.
+func (r *Retrier) evaluate(namespace, name string, number int64) (*Decision, error) {
+	build, err := r.client.Build(namespace, name, int(number))
+	if err != nil {
+		return nil, err
+	}
+	slug := namespace + "/" + name
+	decision := &Decision{
+		Repo:   slug,
+		Build:  build.Number,
+		Commit: build.After,
+		Action: ActionSkip,
+		Time:   r.now(),
+	}
+
+	pattern, step, err := r.match(namespace, name, build)
+	if err != nil {
+		return nil, err
+	}
+	if pattern == nil {
+		decision.Reason = "no matching flaky pattern"
+		r.record(decision)
+		return decision, nil
+	}
+	decision.Pattern = pattern.Name
+	decision.Step = step.Name
+
+	attempt, reserved, reason := r.reserve(slug, build)
+	if reason != "" {
+		decision.Reason = reason
+		r.record(decision)
+		return decision, nil
+	}
+	decision.Attempt = attempt
+
+	params := map[string]string{Param: strconv.Itoa(attempt)}
+	res, err := r.client.BuildRestart(namespace, name, int(build.Number), params)
+	if err != nil {
+		// the build was not restarted, so the attempt does
+		// not count against the budget.
+		r.release(slug, build, attempt, reserved)
+		decision.Error = err.Error()
+	} else {
+		decision.Action = ActionRetry
+		decision.Restarted = res.Number
+	}
+	r.record(decision)
+	return decision, nil
+}
+
+// match returns the first pattern that matches a failed step.
+func (r *Retrier) match(namespace, name string, build *drone.Build) (*Pattern, *drone.Step, error) {
+	for _, stage := range build.Stages {
+		for _, step := range stage.Steps {
+			if !failed(step.Status) || step.ErrIgnore {
+				continue
+			}
+			var lines []*drone.Line
+			var loaded bool
+			for _, pattern := range r.policy.Patterns {
+				if len(pattern.Steps) == 0 && len(pattern.Logs) == 0 {
+					continue
+				}
+				if !pattern.matchStep(step) {
+					continue
+				}
+				if len(pattern.Logs) != 0 && !loaded {
+					all, err := r.client.Logs(namespace, name, int(build.Number), stage.Number, step.Number)
+					if err != nil {
+						return nil, nil, err
+					}
+					lines, loaded = tail(all, r.policy.Tail), true
+				}
+				if pattern.matchLogs(lines) {
+					return pattern, step, nil
+				}
+			}
+		}
+	}
+	return nil, nil, nil
+}
+
+// reserve checks the retry budget for the build and reserves a
+// retry attempt. It returns the attempt and the time of the
+// reservation, or the reason if the budget is exhausted.
+func (r *Retrier) reserve(slug string, build *drone.Build) (int, time.Time, string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// the attempt number is carried by the restarted build
+	// parameters, which allows the budget to survive restarts
+	// of the retrier itself.
+	previous, _ := strconv.Atoi(build.Params[Param])
+	commit := slug + "@" + build.After
+	if a, ok := r.commits[commit]; ok && a.count > previous {
+		previous = a.count
+	}
+	attempt := previous + 1
+	if attempt > r.policy.MaxPerCommit {
+		return 0, time.Time{}, fmt.Sprintf("commit retry limit of %d reached", r.policy.MaxPerCommit)
+	}
+
+	now := r.now()
+	var recent []time.Time
+	for _, t := range r.restarts[slug] {
+		if now.Sub(t) < r.policy.Window {
+			recent = append(recent, t)
+		}
+	}
+	if len(recent) >= r.policy.MaxPerRepo {
+		r.restarts[slug] = recent
+		return 0, time.Time{}, fmt.Sprintf("repository retry limit of %d per %s reached", r.policy.MaxPerRepo, r.policy.Window)
+	}
+	r.restarts[slug] = append(recent, now)
+	r.commits[commit] = &attempts{count: attempt, updated: now}
+	return attempt, now, ""
+}
+
+// release returns the retry attempt reserved at the specified
+// time to the budget.
+func (r *Retrier) release(slug string, build *drone.Build, attempt int, reserved time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	commit := slug + "@" + build.After
+	if a, ok := r.commits[commit]; ok && a.count == attempt {
+		if a.count--; a.count == 0 {
+			delete(r.commits, commit)
+		}
+	}
+	restarts := r.restarts[slug]
+	for i := len(restarts) - 1; i >= 0; i-- {
+		if restarts[i].Equal(reserved) {
+			r.restarts[slug] = append(restarts[:i], restarts[i+1:]...)
+			break
+		}
+	}
+}
+
+// prune removes the builds and commits that were last evaluated
+// before the policy MaxAge, and the repositories without
+// restarts in the policy Window. Builds older than the MaxAge
+// are not evaluated again, so they need not be remembered.
+func (r *Retrier) prune() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	if now.Sub(r.pruned) < pruneInterval {
+		return
+	}
+	r.pruned = now
+	for key, t := range r.seen {
+		if now.Sub(t) > r.policy.MaxAge {
+			delete(r.seen, key)
+		}
+	}
+	for key, a := range r.commits {
+		if now.Sub(a.updated) > r.policy.MaxAge {
+			delete(r.commits, key)
+		}
+	}
+	for slug, restarts := range r.restarts {
+		if len(restarts) == 0 || now.Sub(restarts[len(restarts)-1]) >= r.policy.Window {
+			delete(r.restarts, slug)
+		}
+	}
+}
+
+func (r *Retrier) record(d *Decision) {
+	r.mu.Lock()
+	r.decisions = append(r.decisions, d)
+	if len(r.decisions) > maxDecisions {
+		r.decisions = r.decisions[len(r.decisions)-maxDecisions:]
+	}
+	r.mu.Unlock()
+
+	switch {
+	case d.Error != "":
+		r.logger.Errorf("retry: %s#%d: cannot restart build: %s", d.Repo, d.Build, d.Error)
+	case d.Action == ActionRetry:
+		r.logger.Infof("retry: %s#%d: restarted as #%d (attempt %d, pattern %q, step %q)",
+			d.Repo, d.Build, d.Restarted, d.Attempt, d.Pattern, d.Step)
+	default:
+		r.logger.Debugf("retry: %s#%d: skipped: %s", d.Repo, d.Build, d.Reason)
+	}
+}
+
+func (r *Retrier) markSeen(key string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.seen[key]; ok {
+		return true
+	}
+	r.seen[key] = r.now()
+	return false
+}
+
+func (r *Retrier) unmarkSeen(key string) {
+	r.mu.Lock()
+	delete(r.seen, key)
+	r.mu.Unlock()
+}
+
+// expired returns true if the build finished before the
+// maximum age of the policy.
+func (r *Retrier) expired(build *drone.Build) bool {
+	if build.Finished == 0 {
+		return false
+	}
+	finished := time.Unix(build.Finished, 0)
+	return r.now().Sub(finished) > r.policy.MaxAge
+}
+
+// failed returns true if the status is failure or error.
+func failed(status string) bool {
+	switch status {
+	case drone.StatusFailing, drone.StatusError:
+		return true
+	default:
+		return false
+	}
+}
+
+// tail returns the last n lines.
+func tail(lines []*drone.Line, n int) []*drone.Line {
+	if len(lines) > n {
+		return lines[len(lines)-n:]
+	}
+	return lines
+}
+
+func splitSlug(slug string) (namespace, name string) {
+	parts := strings.SplitN(slug, "/", 2)
+	if len(parts) != 2 {
+		return slug, ""
+	}
+	return parts[0], parts[1]
+}
@@ -0,0 +1,339 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package retry
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/drone/drone-go/drone"
+)
+
+var flaky = []*Pattern{
+	{
+		Name:  "network",
+		Steps: []string{"test*"},
+		Logs:  []*regexp.Regexp{regexp.MustCompile(`connection reset by peer`)},
+	},
+}
+
+func TestCheck(t *testing.T) {
+	server := newMockServer()
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	retrier := New(drone.New(ts.URL), Policy{Patterns: flaky}, nil)
+	retrier.now = func() time.Time { return time.Unix(1000, 0) }
+
+	decisions, err := retrier.Check("octocat", "hello-world")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if got, want := len(decisions), 2; got != want {
+		t.Errorf("Want %d decisions, got %d", want, got)
+		return
+	}
+
+	want := map[int64]string{
+		1: ActionRetry,
+		2: ActionSkip,
+	}
+	for _, d := range decisions {
+		if got := d.Action; got != want[d.Build] {
+			t.Errorf("Want build %d action %s, got %s: %s", d.Build, want[d.Build], got, d.Reason)
+		}
+	}
+	if got, want := server.restarts["1"], "1"; got != want {
+		t.Errorf("Want restart with %s=%s, got %q", Param, want, got)
+	}
+
+	// a second check must not re-evaluate the same builds.
+	decisions, err = retrier.Check("octocat", "hello-world")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if got, want := len(decisions), 0; got != want {
+		t.Errorf("Want %d decisions on second check, got %d", want, got)
+	}
+	if got, want := len(retrier.Decisions()), 2; got != want {
+		t.Errorf("Want %d recorded decisions, got %d", want, got)
+	}
+}
+
+func TestCheck_CommitLimit(t *testing.T) {
+	server := newMockServer()
+	server.builds[1].Params = map[string]string{Param: "2"}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	retrier := New(drone.New(ts.URL), Policy{Patterns: flaky}, nil)
+	retrier.now = func() time.Time { return time.Unix(1000, 0) }
+
+	decisions, err := retrier.Check("octocat", "hello-world")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for _, d := range decisions {
+		if d.Action != ActionSkip {
+			t.Errorf("Want build %d skipped, got %s", d.Build, d.Action)
+		}
+	}
+	if len(server.restarts) != 0 {
+		t.Errorf("Want no restarts when the commit limit is reached")
+	}
+}
+
+func TestCheck_RepoLimit(t *testing.T) {
+	server := newMockServer()
+	server.builds[2] = server.builds[1].copy(2, "b2")
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	retrier := New(drone.New(ts.URL), Policy{Patterns: flaky, MaxPerRepo: 1}, nil)
+	retrier.now = func() time.Time { return time.Unix(1000, 0) }
+
+	_, err := retrier.Check("octocat", "hello-world")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if got, want := len(server.restarts), 1; got != want {
+		t.Errorf("Want %d restarts, got %d", want, got)
+	}
+}
+
+func TestCheck_Expired(t *testing.T) {
+	server := newMockServer()
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	retrier := New(drone.New(ts.URL), Policy{Patterns: flaky}, nil)
+	retrier.now = func() time.Time { return time.Unix(1000, 0).Add(2 * time.Hour) }
+
+	decisions, err := retrier.Check("octocat", "hello-world")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if got, want := len(decisions), 0; got != want {
+		t.Errorf("Want %d decisions for expired builds, got %d", want, got)
+	}
+}
+
+func TestCheck_RestartError(t *testing.T) {
+	server := newMockServer()
+	server.builds[2] = server.builds[1].copy(2, "b2")
+	server.fail = true
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	retrier := New(drone.New(ts.URL), Policy{Patterns: flaky, MaxPerRepo: 1}, nil)
+	retrier.now = func() time.Time { return time.Unix(1000, 0) }
+
+	decisions, err := retrier.Check("octocat", "hello-world")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	// a failed restart does not spend the repository budget,
+	// so the second build is also attempted.
+	for _, d := range decisions {
+		if d.Error == "" {
+			t.Errorf("Want build %d restart error, got %s: %s", d.Build, d.Action, d.Reason)
+		}
+	}
+	if got, want := len(decisions), 2; got != want {
+		t.Errorf("Want %d decisions, got %d", want, got)
+	}
+	if got := len(retrier.commits); got != 0 {
+		t.Errorf("Want commit attempts released, got %d commits", got)
+	}
+	if got := len(retrier.restarts["octocat/hello-world"]); got != 0 {
+		t.Errorf("Want repository restarts released, got %d restarts", got)
+	}
+}
+
+func TestCheck_Prune(t *testing.T) {
+	server := newMockServer()
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	now := time.Unix(1000, 0)
+	retrier := New(drone.New(ts.URL), Policy{Patterns: flaky}, nil)
+	retrier.now = func() time.Time { return now }
+
+	if _, err := retrier.Check("octocat", "hello-world"); err != nil {
+		t.Error(err)
+		return
+	}
+	if len(retrier.seen) == 0 || len(retrier.commits) == 0 || len(retrier.restarts) == 0 {
+		t.Errorf("Want evaluated builds and commits recorded")
+	}
+
+	now = now.Add(2 * time.Hour)
+	if _, err := retrier.Check("octocat", "hello-world"); err != nil {
+		t.Error(err)
+		return
+	}
+	if got := len(retrier.seen); got != 0 {
+		t.Errorf("Want expired builds removed, got %d", got)
+	}
+	if got := len(retrier.commits); got != 0 {
+		t.Errorf("Want expired commits removed, got %d", got)
+	}
+	if got := len(retrier.restarts); got != 0 {
+		t.Errorf("Want repositories without recent restarts removed, got %d", got)
+	}
+}
+
+func TestCheck_NegativePolicy(t *testing.T) {
+	server := newMockServer()
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	policy := Policy{
+		Patterns:     flaky,
+		MaxPerCommit: -1,
+		MaxPerRepo:   -1,
+		Window:       -time.Hour,
+		MaxAge:       -time.Hour,
+		Tail:         -1,
+	}
+	retrier := New(drone.New(ts.URL), policy, nil)
+	retrier.now = func() time.Time { return time.Unix(1000, 0) }
+
+	decisions, err := retrier.Check("octocat", "hello-world")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if got, want := len(decisions), 2; got != want {
+		t.Errorf("Want %d decisions, got %d", want, got)
+	}
+	if got, want := server.restarts["1"], "1"; got != want {
+		t.Errorf("Want negative values replaced with the defaults, got restart %q", got)
+	}
+}
+
+func TestRun_Interval(t *testing.T) {
+	retrier := New(drone.New("http://localhost"), Policy{}, nil)
+	if err := retrier.Run(context.Background(), 0, "octocat/hello-world"); err != errInvalidInterval {
+		t.Errorf("Want errInvalidInterval, got %v", err)
+	}
+}
+
+type mockBuild struct {
+	*drone.Build
+	logs []*drone.Line
+}
+
+func (b *mockBuild) copy(number int64, commit string) *mockBuild {
+	build := *b.Build
+	build.Number = number
+	build.After = commit
+	return &mockBuild{Build: &build, logs: b.logs}
+}
+
+type mockServer struct {
+	sync.Mutex
+	builds   map[int64]*mockBuild
+	restarts map[string]string
+	fail     bool
+}
+
+func newMockServer() *mockServer {
+	failed := func(number int64, commit, step string, logs ...string) *mockBuild {
+		var lines []*drone.Line
+		for i, line := range logs {
+			lines = append(lines, &drone.Line{Number: i, Message: line})
+		}
+		return &mockBuild{
+			Build: &drone.Build{
+				Number:   number,
+				After:    commit,
+				Status:   drone.StatusFailing,
+				Finished: 900,
+				Stages: []*drone.Stage{
+					{
+						Number: 1,
+						Status: drone.StatusFailing,
+						Steps: []*drone.Step{
+							{Number: 1, Name: "clone", Status: drone.StatusPassing},
+							{Number: 2, Name: step, Status: drone.StatusFailing},
+						},
+					},
+				},
+			},
+			logs: lines,
+		}
+	}
+	return &mockServer{
+		builds: map[int64]*mockBuild{
+			1: failed(1, "a1", "test", "go test ./...", "read tcp: connection reset by peer"),
+			2: failed(2, "b2", "test", "go test ./...", "--- FAIL: TestFoo"),
+			3: {Build: &drone.Build{Number: 3, After: "c3", Status: drone.StatusPassing}},
+		},
+		restarts: map[string]string{},
+	}
+}
+
+func (m *mockServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.Lock()
+	defer m.Unlock()
+
+	const prefix = "/api/repos/octocat/hello-world/builds"
+	path := r.URL.Path
+	if path == prefix {
+		var out []*drone.Build
+		for i := int64(len(m.builds)); i > 0; i-- {
+			if b, ok := m.builds[i]; ok {
+				out = append(out, b.Build)
+			}
+		}
+		_ = json.NewEncoder(w).Encode(out)
+		return
+	}
+
+	// path format is /builds/:build or /builds/:build/logs/:stage/:step
+	parts := strings.Split(strings.TrimPrefix(path, prefix+"/"), "/")
+	number, _ := strconv.ParseInt(parts[0], 10, 64)
+	build, ok := m.builds[number]
+	if !ok {
+		w.WriteHeader(404)
+		return
+	}
+	switch {
+	case r.Method == "POST" && m.fail:
+		w.WriteHeader(500)
+	case r.Method == "POST":
+		m.restarts[parts[0]] = r.URL.Query().Get(Param)
+		_ = json.NewEncoder(w).Encode(&drone.Build{Number: 100 + number})
+	case len(parts) == 4 && parts[1] == "logs":
+		_ = json.NewEncoder(w).Encode(build.logs)
+	default:
+		_ = json.NewEncoder(w).Encode(build.Build)
+	}
+}
@@ -0,0 +1,183 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drone
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// Build errors returned by Run and Follow. Use errors.Is to
+// test the returned *BuildError against these values.
+var (
+	ErrBuildFailed   = errors.New("build failed")
+	ErrBuildKilled   = errors.New("build killed")
+	ErrBuildErrored  = errors.New("build errored")
+	ErrBuildDeclined = errors.New("build declined")
+)
+
+// DefaultRunInterval is the default polling interval used by
+// Run and Follow.
+const DefaultRunInterval = 2 * time.Second
+
+// RunOptions provides options for Run and Follow.
+type RunOptions struct {
+	// Commit is the commit sha to build.
+	Commit string
+
+	// Branch is the branch to build.
+	Branch string
+
+	// Params are the custom build parameters.
+	Params map[string]string
+
+	// Output receives the step logs. Each line is prefixed
+	// with the stage and step name. If nil, logs are not
+	// fetched.
+	Output io.Writer
+
+	// Interval is the polling interval. If zero, the
+	// DefaultRunInterval is used.
+	Interval time.Duration
+}
+
+// BuildError is returned when a build does not complete
+// successfully.
+type BuildError struct {
+	Build *Build
+}
+
+func (e *BuildError) Error() string {
+	msg := fmt.Sprintf("build #%d %s", e.Build.Number, e.Build.Status)
+	if e.Build.Error != "" {
+		msg += ": " + e.Build.Error
+	}
+	return msg
+}
+
+// Is returns true if the build status matches the target
+// build error.
+func (e *BuildError) Is(target error) bool {
+	switch target {
+	case ErrBuildFailed:
+		return e.Build.Status == StatusFailing
+	case ErrBuildKilled:
+		return e.Build.Status == StatusKilled
+	case ErrBuildErrored:
+		return e.Build.Status == StatusError
+	case ErrBuildDeclined:
+		return e.Build.Status == StatusDeclined
+	default:
+		return false
+	}
+}
+
+// Run creates a new build by branch or commit and follows the
+// build to completion, streaming the step logs to the output.
+// A *BuildError is returned if the build does not succeed.
+func Run(ctx context.Context, client Client, owner, name string, opts RunOptions) (*Build, error) {
+	build, err := client.BuildCreate(owner, name, opts.Commit, opts.Branch, opts.Params)
+	if err != nil {
+		return nil, err
+	}
+	return Follow(ctx, client, owner, name, int(build.Number), opts)
+}
+
+// Follow polls the build until completion, streaming the step
+// logs to the output. A *BuildError is returned if the build
+// does not succeed.
+func Follow(ctx context.Context, client Client, owner, name string, number int, opts RunOptions) (*Build, error) {
+	interval := opts.Interval
+	if interval == 0 {
+		interval = DefaultRunInterval
+	}
+
+	printed := map[int64]int{}
+	for {
+		build, err := client.Build(owner, name, number)
+		if err != nil {
+			return nil, err
+		}
+		if opts.Output != nil {
+			streamLogs(client, owner, name, build, printed, opts.Output)
+		}
+		if done(build.Status) {
+			if build.Status != StatusPassing {
+				return build, &BuildError{Build: build}
+			}
+			return build, nil
+		}
+		select {
+		case <-ctx.Done():
+			return build, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// streamLogs writes the log lines that have not yet been
+// printed, in stage and step order. Logs are streamed on a
+// best-effort basis; steps with unavailable logs, for example
+// a step that is still starting, are retried on the next poll.
+func streamLogs(client Client, owner, name string, build *Build, printed map[int64]int, w io.Writer) {
+	stages := make([]*Stage, len(build.Stages))
+	copy(stages, build.Stages)
+	sort.Slice(stages, func(i, j int) bool {
+		return stages[i].Number < stages[j].Number
+	})
+	for _, stage := range stages {
+		steps := make([]*Step, len(stage.Steps))
+		copy(steps, stage.Steps)
+		sort.Slice(steps, func(i, j int) bool {
+			return steps[i].Number < steps[j].Number
+		})
+		for _, step := range steps {
+			switch step.Status {
+			case StatusPending, StatusSkipped, StatusBlocked, StatusWaiting:
+				continue
+			}
+			lines, err := client.Logs(owner, name, int(build.Number), stage.Number, step.Number)
+			if err != nil {
+				continue
+			}
+			key := int64(stage.Number)<<32 | int64(step.Number)
+			offset := printed[key]
+			if offset > len(lines) {
+				offset = len(lines)
+			}
+			for _, line := range lines[offset:] {
+				fmt.Fprintf(w, "[%s:%s] %s", stage.Name, step.Name, line.Message)
+				if n := len(line.Message); n == 0 || line.Message[n-1] != '\n' {
+					fmt.Fprintln(w)
+				}
+			}
+			printed[key] = len(lines)
+		}
+	}
+}
+
+// done returns true if the build status is final.
+func done(status string) bool {
+	switch status {
+	case StatusPending, StatusRunning, StatusBlocked, StatusWaiting:
+		return false
+	default:
+		return true
+	}
+}
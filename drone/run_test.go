@@ -0,0 +1,123 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drone
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	ts := httptest.NewServer(newRunHandler(StatusPassing))
+	defer ts.Close()
+
+	buf := new(bytes.Buffer)
+	client := New(ts.URL)
+	build, err := Run(context.Background(), client, "octocat", "hello-world", RunOptions{
+		Branch:   "master",
+		Output:   buf,
+		Interval: time.Millisecond,
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if got, want := build.Status, StatusPassing; got != want {
+		t.Errorf("Want build status %s, got %s", want, got)
+	}
+
+	want := "[default:clone] + git clone\n[default:test] + go test\n[default:test] ok\n"
+	if got := buf.String(); got != want {
+		t.Errorf("Want output %q, got %q", want, got)
+	}
+}
+
+func TestRun_Failed(t *testing.T) {
+	tests := []struct {
+		status string
+		want   error
+	}{
+		{StatusFailing, ErrBuildFailed},
+		{StatusKilled, ErrBuildKilled},
+		{StatusError, ErrBuildErrored},
+		{StatusDeclined, ErrBuildDeclined},
+	}
+	for _, test := range tests {
+		ts := httptest.NewServer(newRunHandler(test.status))
+
+		client := New(ts.URL)
+		_, err := Run(context.Background(), client, "octocat", "hello-world", RunOptions{
+			Interval: time.Millisecond,
+		})
+		ts.Close()
+
+		if !errors.Is(err, test.want) {
+			t.Errorf("Want error %v for status %s, got %v", test.want, test.status, err)
+		}
+		if _, ok := err.(*BuildError); !ok {
+			t.Errorf("Want *BuildError for status %s, got %T", test.status, err)
+		}
+	}
+}
+
+// newRunHandler returns a handler that simulates a build that
+// is running on the first poll and completes with the given
+// status on the second poll.
+func newRunHandler(status string) http.Handler {
+	polls := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/repos/octocat/hello-world/builds", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(&Build{Number: 1, Status: StatusPending})
+	})
+	mux.HandleFunc("/api/repos/octocat/hello-world/builds/1", func(w http.ResponseWriter, r *http.Request) {
+		polls++
+		build := &Build{
+			Number: 1,
+			Status: StatusRunning,
+			Stages: []*Stage{
+				{
+					Number: 1,
+					Name:   "default",
+					Steps: []*Step{
+						{Number: 2, Name: "test", Status: StatusRunning},
+						{Number: 1, Name: "clone", Status: StatusPassing},
+					},
+				},
+			},
+		}
+		if polls > 1 {
+			build.Status = status
+			build.Stages[0].Steps[0].Status = status
+		}
+		_ = json.NewEncoder(w).Encode(build)
+	})
+	mux.HandleFunc("/api/repos/octocat/hello-world/builds/1/logs/1/1", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode([]*Line{{Number: 0, Message: "+ git clone\n"}})
+	})
+	mux.HandleFunc("/api/repos/octocat/hello-world/builds/1/logs/1/2", func(w http.ResponseWriter, r *http.Request) {
+		lines := []*Line{{Number: 0, Message: "+ go test\n"}}
+		if polls > 1 {
+			lines = append(lines, &Line{Number: 1, Message: "ok\n"})
+		}
+		_ = json.NewEncoder(w).Encode(lines)
+	})
+	return mux
+}
@@ -390,10 +390,64 @@ type (
 
 // Error represents a json-encoded API error.
 type Error struct {
-	Code    int    `json:"code"`
-	Message string `json:"message"`
+	Code      int           `json:"code"`
+	Message   string        `json:"message"`
+	Retryable bool          `json:"retryable,omitempty"`
+	Details   *ErrorDetails `json:"details,omitempty"`
 }
 
+// ErrorDetails provides additional error details. It is
+// referenced by pointer so that Error remains comparable.
+type ErrorDetails map[string]string
+
 func (e *Error) Error() string {
 	return e.Message
 }
+
+// Is reports whether the target is an *Error with the same
+// non-zero status code and the same message, or a *Sentinel
+// with the same non-zero status code.
+func (e *Error) Is(target error) bool {
+	switch t := target.(type) {
+	case *Error:
+		return t.Code != 0 && t.Code == e.Code && t.Message == e.Message
+	case *Sentinel:
+		return t.Code != 0 && t.Code == e.Code
+	}
+	return false
+}
+
+// Sentinel is an error that matches, using errors.Is, any
+// *Error or *Sentinel with the same non-zero status code,
+// regardless of the message. It is used to define errors that
+// are compared to errors decoded from a response, whose message
+// may have been wrapped by the server. errors.As returns a copy
+// of the Sentinel as an *Error.
+type Sentinel Error
+
+func (s *Sentinel) Error() string {
+	return s.Message
+}
+
+// Is reports whether the target is an *Error or *Sentinel
+// with the same non-zero status code.
+func (s *Sentinel) Is(target error) bool {
+	switch t := target.(type) {
+	case *Error:
+		return t.Code != 0 && t.Code == s.Code
+	case *Sentinel:
+		return t.Code != 0 && t.Code == s.Code
+	}
+	return false
+}
+
+// As sets the target to a copy of the Sentinel if the target
+// is an **Error.
+func (s *Sentinel) As(target interface{}) bool {
+	t, ok := target.(**Error)
+	if ok {
+		e := Error(*s)
+		*t = &e
+	}
+	return ok
+}
@@ -0,0 +1,67 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drone
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestError_Is(t *testing.T) {
+	notFound := &Error{Code: 404, Message: "Not Found"}
+	sentinel := &Sentinel{Code: 404, Message: "Not Found"}
+
+	tests := []struct {
+		err    error
+		target error
+		want   bool
+	}{
+		{&Error{Code: 404, Message: "Not Found"}, notFound, true},
+		{&Error{Code: 404, Message: "repository not found"}, notFound, false},
+		{&Error{Code: 401, Message: "Not Found"}, notFound, false},
+		{&Error{Code: 404, Message: "repository not found"}, sentinel, true},
+		{fmt.Errorf("lookup: %w", &Error{Code: 404, Message: "no such secret"}), sentinel, true},
+		{&Error{Code: 500, Message: "Not Found"}, sentinel, false},
+		{&Error{Message: "Not Found"}, &Error{Message: "Not Found"}, false},
+		{sentinel, &Error{Code: 404, Message: "repository not found"}, true},
+		{fmt.Errorf("lookup: %w", sentinel), sentinel, true},
+		{&Sentinel{Code: 404}, sentinel, true},
+		{&Sentinel{Code: 403}, sentinel, false},
+	}
+	for i, test := range tests {
+		if got := errors.Is(test.err, test.target); got != test.want {
+			t.Errorf("Want errors.Is %v for test %d, got %v", test.want, i, got)
+		}
+	}
+}
+
+func TestSentinel_As(t *testing.T) {
+	sentinel := &Sentinel{Code: 503, Message: "Service Unavailable", Retryable: true}
+
+	var err *Error
+	if !errors.As(fmt.Errorf("vault: %w", sentinel), &err) {
+		t.Fatalf("Want sentinel returned as *Error")
+	}
+	if got, want := *err, (Error{Code: 503, Message: "Service Unavailable", Retryable: true}); got != want {
+		t.Errorf("Want error %v, got %v", want, got)
+	}
+
+	// the returned error is a copy of the sentinel.
+	err.Message = "vault sealed"
+	if sentinel.Message != "Service Unavailable" {
+		t.Errorf("Want sentinel not modified, got %q", sentinel.Message)
+	}
+}
@@ -5,4 +5,5 @@ go 1.14
 require (
 	github.com/99designs/httpsignatures-go v0.0.0-20170731043157-88528bf4ca7e
 	github.com/google/go-cmp v0.2.0
+	gopkg.in/yaml.v2 v2.4.0
 )
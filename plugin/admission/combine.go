@@ -0,0 +1,63 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package admission
+
+import (
+	"context"
+	"sync"
+
+	"github.com/drone/drone-go/drone"
+)
+
+// All returns a Plugin that invokes the plugins in parallel and
+// admits the user only if all plugins admit the user. If any
+// plugin returns an error, the error of the first plugin is
+// returned. Otherwise the user returned by the last plugin that
+// returns a non-nil user is returned.
+func All(plugins ...Plugin) Plugin {
+	return &all{plugins: plugins}
+}
+
+type all struct {
+	plugins []Plugin
+}
+
+func (p *all) Admit(ctx context.Context, req *Request) (*drone.User, error) {
+	users := make([]*drone.User, len(p.plugins))
+	errs := make([]error, len(p.plugins))
+
+	var wg sync.WaitGroup
+	for i, plugin := range p.plugins {
+		wg.Add(1)
+		go func(i int, plugin Plugin) {
+			defer wg.Done()
+			users[i], errs[i] = plugin.Admit(ctx, req)
+		}(i, plugin)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	var out *drone.User
+	for _, user := range users {
+		if user != nil {
+			out = user
+		}
+	}
+	return out, nil
+}
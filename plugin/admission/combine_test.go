@@ -0,0 +1,55 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package admission
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/drone/drone-go/drone"
+)
+
+func TestAll(t *testing.T) {
+	plugin := All(
+		&mockPlugin{res: &drone.User{Login: "octocat"}},
+		&mockPlugin{},
+		&mockPlugin{res: &drone.User{Login: "octocat", Admin: true}},
+	)
+	res, err := plugin.Admit(context.Background(), &Request{})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if res == nil || !res.Admin {
+		t.Errorf("Want user from the last plugin that returns a user, got %v", res)
+	}
+
+	res, err = All(&mockPlugin{}, &mockPlugin{}).Admit(context.Background(), &Request{})
+	if res != nil || err != nil {
+		t.Errorf("Want nil user when no plugin returns a user")
+	}
+
+	errFoo := errors.New("foo")
+	errBar := errors.New("bar")
+	plugin = All(
+		&mockPlugin{res: &drone.User{Login: "octocat"}},
+		&mockPlugin{err: errFoo},
+		&mockPlugin{err: errBar},
+	)
+	if _, err := plugin.Admit(context.Background(), &Request{}); err != errFoo {
+		t.Errorf("Want error of the first plugin, got %v", err)
+	}
+}
@@ -21,13 +21,11 @@ import (
 	"errors"
 	"net/http"
 	"net/http/httptest"
-	"strings"
 	"testing"
 	"time"
 
 	"github.com/drone/drone-go/drone"
-
-	"github.com/99designs/httpsignatures-go"
+	"github.com/drone/drone-go/plugin/internal/testutil"
 )
 
 func TestHandler(t *testing.T) {
@@ -40,7 +38,7 @@ func TestHandler(t *testing.T) {
 	req := httptest.NewRequest("GET", "/", buf)
 	req.Header.Add("Date", time.Now().UTC().Format(http.TimeFormat))
 
-	err := httpsignatures.DefaultSha256Signer.AuthRequest("hmac-key", key, req)
+	err := testutil.Sign(req, key)
 	if err != nil {
 		t.Error(err)
 		return
@@ -79,7 +77,7 @@ func TestHandler_NoContent(t *testing.T) {
 	req := httptest.NewRequest("GET", "/", buf)
 	req.Header.Add("Date", time.Now().UTC().Format(http.TimeFormat))
 
-	err := httpsignatures.DefaultSha256Signer.AuthRequest("hmac-key", key, req)
+	err := testutil.Sign(req, key)
 	if err != nil {
 		t.Error(err)
 		return
@@ -108,7 +106,7 @@ func TestHandler_AccessDenied(t *testing.T) {
 	req := httptest.NewRequest("GET", "/", buf)
 	req.Header.Add("Date", time.Now().UTC().Format(http.TimeFormat))
 
-	err := httpsignatures.DefaultSha256Signer.AuthRequest("hmac-key", key, req)
+	err := testutil.Sign(req, key)
 	if err != nil {
 		t.Error(err)
 		return
@@ -126,8 +124,9 @@ func TestHandler_AccessDenied(t *testing.T) {
 		t.Errorf("Want status code %d, got %d", want, got)
 	}
 
-	got, want := strings.TrimSpace(res.Body.String()), plugin.err.Error()
-	if got != want {
+	out := new(drone.Error)
+	json.Unmarshal(res.Body.Bytes(), out)
+	if got, want := out.Message, plugin.err.Error(); got != want {
 		t.Errorf("Want error %q, got %q", want, got)
 	}
 }
@@ -139,7 +138,7 @@ func TestHandler_MissingSignature(t *testing.T) {
 	handler := Handler(nil, "xVKAGlWQiY3sOp8JVc0nbuNId3PNCgWh", nil)
 	handler.ServeHTTP(res, req)
 
-	got, want := res.Body.String(), "Invalid or Missing Signature\n"
+	got, want := res.Body.String(), `{"code":400,"message":"Invalid or Missing Signature"}`+"\n"
 	if got != want {
 		t.Errorf("Want response body %q, got %q", want, got)
 	}
@@ -154,7 +153,7 @@ func TestHandler_InvalidSignature(t *testing.T) {
 	handler := Handler(nil, "xVKAGlWQiY3sOp8JVc0nbuNId3PNCgWh", nil)
 	handler.ServeHTTP(res, req)
 
-	got, want := res.Body.String(), "Invalid Signature\n"
+	got, want := res.Body.String(), `{"code":400,"message":"Invalid Signature"}`+"\n"
 	if got != want {
 		t.Errorf("Want response body %q, got %q", want, got)
 	}
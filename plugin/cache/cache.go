@@ -0,0 +1,322 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cache provides a size-bounded, expiring cache used
+// by the plugin caching decorators, such as secret.Cached.
+package cache
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/drone/drone-go/drone"
+)
+
+// Default cache configuration.
+const (
+	DefaultTTL         = time.Minute
+	DefaultSize        = 1000
+	DefaultLoadTimeout = time.Minute
+)
+
+// errNotFound is used to match not found errors returned by
+// the plugin, which are cached as negative results.
+var errNotFound = &drone.Sentinel{Code: http.StatusNotFound}
+
+// errLoad is returned to concurrent lookups if the lookup
+// they are waiting for panics.
+var errLoad = errors.New("cache: lookup failed")
+
+// Config configures the cache.
+type Config struct {
+	// TTL is the duration a result is cached. If zero, the
+	// DefaultTTL is used.
+	TTL time.Duration
+
+	// NegativeTTL is the duration a negative result is cached.
+	// A result is negative if the plugin returns a nil pointer,
+	// or returns an error that matches a 404 *drone.Error. If
+	// zero, negative results are not cached. Other errors are
+	// never cached. Each caller receives its own copy of a
+	// cached *drone.Error.
+	NegativeTTL time.Duration
+
+	// Size is the maximum number of cached results. When the
+	// cache is full the least recently used result is evicted.
+	// If zero, the DefaultSize is used.
+	Size int
+
+	// LoadTimeout is the maximum duration of a lookup. The
+	// lookup is not canceled when the caller that started it
+	// is canceled, since concurrent callers wait for the same
+	// result. If zero, the DefaultLoadTimeout is used.
+	LoadTimeout time.Duration
+}
+
+// Stats provides cache metrics.
+type Stats struct {
+	// Hits is the number of lookups served from the cache.
+	Hits uint64
+
+	// Misses is the number of lookups that invoked the plugin.
+	Misses uint64
+
+	// Shared is the number of lookups that waited for a
+	// concurrent, identical lookup instead of invoking the
+	// plugin.
+	Shared uint64
+
+	// Evictions is the number of results evicted because the
+	// cache was full.
+	Evictions uint64
+
+	// Size is the number of cached results.
+	Size int
+}
+
+// Func loads the value for a cache miss.
+type Func func(context.Context) (interface{}, error)
+
+// Cache is a size-bounded, expiring cache that de-duplicates
+// concurrent lookups for the same key. A Cache is safe for
+// concurrent use.
+type Cache struct {
+	ttl         time.Duration
+	negativeTTL time.Duration
+	size        int
+	loadTimeout time.Duration
+	now         func() time.Time
+
+	mu       sync.Mutex
+	entries  map[string]*list.Element
+	lru      *list.List
+	inflight map[string]*call
+
+	hits      uint64
+	misses    uint64
+	shared    uint64
+	evictions uint64
+}
+
+type entry struct {
+	key     string
+	value   interface{}
+	err     error
+	expires time.Time
+}
+
+type call struct {
+	done  chan struct{}
+	value interface{}
+	err   error
+	panic interface{}
+}
+
+// New returns a new Cache.
+func New(config Config) *Cache {
+	c := &Cache{
+		ttl:         config.TTL,
+		negativeTTL: config.NegativeTTL,
+		size:        config.Size,
+		loadTimeout: config.LoadTimeout,
+		now:         time.Now,
+		entries:     map[string]*list.Element{},
+		lru:         list.New(),
+		inflight:    map[string]*call{},
+	}
+	if c.ttl <= 0 {
+		c.ttl = DefaultTTL
+	}
+	if c.size <= 0 {
+		c.size = DefaultSize
+	}
+	if c.loadTimeout <= 0 {
+		c.loadTimeout = DefaultLoadTimeout
+	}
+	return c
+}
+
+// Get returns the cached value for the key. On a cache miss
+// the value is loaded using the function and cached. If a
+// lookup for the same key is in progress, Get waits for and
+// returns its result.
+//
+// The function is invoked with a context that carries the
+// values of the caller context, but is not canceled with it,
+// so that canceling one caller does not fail the lookup for
+// the other callers. Get returns early if the caller context
+// is canceled.
+func (c *Cache) Get(ctx context.Context, key string, fn Func) (interface{}, error) {
+	c.mu.Lock()
+	if elem, ok := c.entries[key]; ok {
+		e := elem.Value.(*entry)
+		if c.now().Before(e.expires) {
+			c.lru.MoveToFront(elem)
+			c.mu.Unlock()
+			atomic.AddUint64(&c.hits, 1)
+			return e.value, copyError(e.err)
+		}
+		c.remove(elem)
+	}
+	if cl, ok := c.inflight[key]; ok {
+		c.mu.Unlock()
+		atomic.AddUint64(&c.shared, 1)
+		select {
+		case <-cl.done:
+			return cl.value, copyError(cl.err)
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	cl := &call{done: make(chan struct{})}
+	c.inflight[key] = cl
+	c.mu.Unlock()
+
+	atomic.AddUint64(&c.misses, 1)
+	go c.load(ctx, key, cl, fn)
+	select {
+	case <-cl.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	// the panic is propagated to the caller that started the
+	// lookup.
+	if cl.panic != nil {
+		panic(cl.panic)
+	}
+	return cl.value, copyError(cl.err)
+}
+
+// load invokes the function and caches the result. Waiting
+// lookups are released even if the function panics.
+func (c *Cache) load(parent context.Context, key string, cl *call, fn Func) {
+	ctx, cancel := context.WithTimeout(detached{parent}, c.loadTimeout)
+	defer cancel()
+
+	stored := false
+	defer func() {
+		if rec := recover(); rec != nil {
+			cl.panic = rec
+		}
+		c.mu.Lock()
+		delete(c.inflight, key)
+		if stored {
+			c.store(key, cl.value, cl.err)
+		}
+		c.mu.Unlock()
+		close(cl.done)
+	}()
+	cl.err = errLoad
+	cl.value, cl.err = fn(ctx)
+	stored = true
+}
+
+// detached is a context that carries the values of the parent
+// context, but is never canceled.
+type detached struct {
+	parent context.Context
+}
+
+func (detached) Deadline() (time.Time, bool)         { return time.Time{}, false }
+func (detached) Done() <-chan struct{}               { return nil }
+func (detached) Err() error                          { return nil }
+func (d detached) Value(key interface{}) interface{} { return d.parent.Value(key) }
+
+// Stats returns the cache metrics.
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	size := c.lru.Len()
+	c.mu.Unlock()
+	return Stats{
+		Hits:      atomic.LoadUint64(&c.hits),
+		Misses:    atomic.LoadUint64(&c.misses),
+		Shared:    atomic.LoadUint64(&c.shared),
+		Evictions: atomic.LoadUint64(&c.evictions),
+		Size:      size,
+	}
+}
+
+// Purge removes all cached results.
+func (c *Cache) Purge() {
+	c.mu.Lock()
+	c.entries = map[string]*list.Element{}
+	c.lru.Init()
+	c.mu.Unlock()
+}
+
+// store caches the result. The caller must hold the lock.
+func (c *Cache) store(key string, value interface{}, err error) {
+	ttl := c.ttl
+	switch {
+	case err != nil && !errors.Is(err, errNotFound):
+		return
+	case err != nil || isNil(value):
+		ttl = c.negativeTTL
+	}
+	if ttl <= 0 {
+		return
+	}
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+	c.entries[key] = c.lru.PushFront(&entry{
+		key:     key,
+		value:   value,
+		err:     err,
+		expires: c.now().Add(ttl),
+	})
+	for c.lru.Len() > c.size {
+		c.remove(c.lru.Back())
+		atomic.AddUint64(&c.evictions, 1)
+	}
+}
+
+// remove removes the element. The caller must hold the lock.
+func (c *Cache) remove(elem *list.Element) {
+	c.lru.Remove(elem)
+	delete(c.entries, elem.Value.(*entry).key)
+}
+
+// copyError returns a copy of a *drone.Error, so that callers
+// sharing a cached result cannot modify each other's error.
+func copyError(err error) error {
+	e, ok := err.(*drone.Error)
+	if !ok {
+		return err
+	}
+	copy := *e
+	if e.Details != nil {
+		details := make(drone.ErrorDetails, len(*e.Details))
+		for k, v := range *e.Details {
+			details[k] = v
+		}
+		copy.Details = &details
+	}
+	return &copy
+}
+
+// isNil returns true if the value is nil or a nil pointer.
+func isNil(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	return rv.Kind() == reflect.Ptr && rv.IsNil()
+}
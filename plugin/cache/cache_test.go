@@ -0,0 +1,257 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/drone/drone-go/drone"
+)
+
+func TestGet(t *testing.T) {
+	now := time.Now()
+	c := New(Config{TTL: time.Minute})
+	c.now = func() time.Time { return now }
+
+	var calls int
+	fn := func(context.Context) (interface{}, error) {
+		calls++
+		return calls, nil
+	}
+
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		if v, _ := c.Get(ctx, "foo", fn); v != 1 {
+			t.Errorf("Want cached value 1, got %v", v)
+		}
+	}
+
+	now = now.Add(2 * time.Minute)
+	if v, _ := c.Get(ctx, "foo", fn); v != 2 {
+		t.Errorf("Want value reloaded after the ttl, got %v", v)
+	}
+
+	stats := c.Stats()
+	if stats.Hits != 2 || stats.Misses != 2 || stats.Size != 1 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
+
+func TestGet_Negative(t *testing.T) {
+	ctx := context.Background()
+	notFound := fmt.Errorf("no such secret: %w", &drone.Error{Code: 404, Message: "Not Found"})
+	unavailable := &drone.Error{Code: 503, Message: "Service Unavailable"}
+
+	tests := []struct {
+		name        string
+		negativeTTL time.Duration
+		value       interface{}
+		err         error
+		calls       int
+	}{
+		{"nil pointer not cached", 0, (*drone.Secret)(nil), nil, 2},
+		{"nil pointer cached", time.Minute, (*drone.Secret)(nil), nil, 1},
+		{"not found cached", time.Minute, nil, notFound, 1},
+		{"not found not cached", 0, nil, notFound, 2},
+		{"error never cached", time.Minute, nil, unavailable, 2},
+		{"other error never cached", time.Minute, nil, errors.New("boom"), 2},
+	}
+	for _, test := range tests {
+		c := New(Config{NegativeTTL: test.negativeTTL})
+		var calls int
+		fn := func(context.Context) (interface{}, error) {
+			calls++
+			return test.value, test.err
+		}
+		for i := 0; i < 2; i++ {
+			if _, err := c.Get(ctx, "foo", fn); !errors.Is(err, test.err) {
+				t.Errorf("%s: want error %v, got %v", test.name, test.err, err)
+			}
+		}
+		if calls != test.calls {
+			t.Errorf("%s: want %d calls, got %d", test.name, test.calls, calls)
+		}
+	}
+}
+
+func TestGet_NegativeCopy(t *testing.T) {
+	ctx := context.Background()
+	c := New(Config{NegativeTTL: time.Minute})
+	fn := func(context.Context) (interface{}, error) {
+		return nil, &drone.Error{
+			Code:    404,
+			Message: "Not Found",
+			Details: &drone.ErrorDetails{"name": "password"},
+		}
+	}
+	_, err := c.Get(ctx, "foo", fn)
+	first := err.(*drone.Error)
+	first.Message = "modified"
+	(*first.Details)["name"] = "modified"
+
+	_, err = c.Get(ctx, "foo", fn)
+	second := err.(*drone.Error)
+	if first == second {
+		t.Errorf("Expect a fresh error for each caller")
+	}
+	if got, want := second.Message, "Not Found"; got != want {
+		t.Errorf("Want message %q, got %q", want, got)
+	}
+	if got, want := (*second.Details)["name"], "password"; got != want {
+		t.Errorf("Want detail %q, got %q", want, got)
+	}
+}
+
+func TestGet_Evict(t *testing.T) {
+	c := New(Config{Size: 2})
+	ctx := context.Background()
+	fn := func(context.Context) (interface{}, error) { return true, nil }
+
+	c.Get(ctx, "a", fn)
+	c.Get(ctx, "b", fn)
+	c.Get(ctx, "a", fn) // a is now the most recently used
+	c.Get(ctx, "c", fn) // evicts b
+
+	if _, ok := c.entries["b"]; ok {
+		t.Errorf("Want least recently used entry evicted")
+	}
+	if _, ok := c.entries["a"]; !ok {
+		t.Errorf("Want recently used entry retained")
+	}
+	if got := c.Stats().Evictions; got != 1 {
+		t.Errorf("Want 1 eviction, got %d", got)
+	}
+}
+
+func TestGet_Singleflight(t *testing.T) {
+	c := New(Config{})
+	release := make(chan struct{})
+	var calls int
+	fn := func(context.Context) (interface{}, error) {
+		calls++
+		<-release
+		return "bar", nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v, _ := c.Get(context.Background(), "foo", fn); v != "bar" {
+				t.Errorf("Want value bar, got %v", v)
+			}
+		}()
+	}
+	// wait until every lookup is in progress or waiting.
+	for {
+		stats := c.Stats()
+		if stats.Misses+stats.Shared == 10 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("Want concurrent lookups de-duplicated, got %d calls", calls)
+	}
+	if got := c.Stats().Shared; got != 9 {
+		t.Errorf("Want 9 shared lookups, got %d", got)
+	}
+}
+
+func TestGet_Panic(t *testing.T) {
+	c := New(Config{})
+	func() {
+		defer func() { recover() }()
+		c.Get(context.Background(), "foo", func(context.Context) (interface{}, error) {
+			panic("boom")
+		})
+	}()
+	v, err := c.Get(context.Background(), "foo", func(context.Context) (interface{}, error) {
+		return "bar", nil
+	})
+	if v != "bar" || err != nil {
+		t.Errorf("Want lookup to succeed after a panic, got %v %v", v, err)
+	}
+}
+
+func TestGet_Canceled(t *testing.T) {
+	c := New(Config{})
+	release := make(chan struct{})
+	fn := func(ctx context.Context) (interface{}, error) {
+		select {
+		case <-release:
+			return "bar", nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	// the caller that started the lookup is canceled.
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		_, err := c.Get(ctx, "foo", fn)
+		done <- err
+	}()
+	for c.Stats().Misses == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	result := make(chan interface{})
+	go func() {
+		v, _ := c.Get(context.Background(), "foo", fn)
+		result <- v
+	}()
+	for c.Stats().Shared == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Want canceled caller to return context.Canceled, got %v", err)
+	}
+
+	// the waiting caller receives the result.
+	close(release)
+	if v := <-result; v != "bar" {
+		t.Errorf("Want waiting caller to receive the result, got %v", v)
+	}
+}
+
+func TestKey(t *testing.T) {
+	build := drone.Build{Number: 1, Event: drone.EventPush, Status: drone.StatusPending}
+	running := build
+	running.Status = drone.StatusRunning
+	running.Started = 1577836800
+	running.Stages = []*drone.Stage{{Number: 1}}
+	if Key("secret", Build(build)) != Key("secret", Build(running)) {
+		t.Errorf("Want key to ignore the build status, timestamps and stages")
+	}
+	rebuild := build
+	rebuild.Number = 2
+	if Key("secret", Build(build)) == Key("secret", Build(rebuild)) {
+		t.Errorf("Want key to include the build number")
+	}
+	if Key("secret", "a", "bc") == Key("secret", "ab", "c") {
+		t.Errorf("Want key values delimited")
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/drone/drone-go/drone"
+)
+
+// Key returns a cache key for the JSON-encoded values.
+func Key(values ...interface{}) string {
+	data, err := json.Marshal(values)
+	if err != nil {
+		panic("cache: cannot encode key: " + err.Error())
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Repo returns a copy of the repository without the fields
+// that change as the repository is built, for use in a cache
+// key.
+func Repo(repo drone.Repo) drone.Repo {
+	repo.Counter = 0
+	repo.Synced = 0
+	repo.Updated = 0
+	repo.Version = 0
+	return repo
+}
+
+// Build returns a copy of the build without the fields that
+// change while the build runs, such as the status, timestamps
+// and stages, for use in a cache key. A key that includes the
+// build is shared by the stages of the build, but not by
+// other builds.
+func Build(build drone.Build) drone.Build {
+	build.Status = ""
+	build.Error = ""
+	build.Started = 0
+	build.Finished = 0
+	build.Updated = 0
+	build.Version = 0
+	build.Stages = nil
+	return build
+}
@@ -0,0 +1,108 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"crypto/tls"
+	"os"
+	"sync"
+	"time"
+)
+
+// certCheckInterval is the minimum interval between checks
+// for a modified certificate or key file.
+const certCheckInterval = 10 * time.Second
+
+// certLoader loads the tls certificate and reloads the
+// certificate when the certificate or key file is modified,
+// so that renewed certificates are served without a restart.
+type certLoader struct {
+	certFile string
+	keyFile  string
+	now      func() time.Time
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modtime time.Time
+	checked time.Time
+}
+
+func newCertLoader(certFile, keyFile string) (*certLoader, error) {
+	c := &certLoader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		now:      time.Now,
+	}
+	if _, err := c.load(); err != nil {
+		return nil, err
+	}
+	c.checked = c.now()
+	return c, nil
+}
+
+// GetCertificate returns the current certificate, reloading
+// it from disk if the files were modified. The files are
+// checked at most once per certCheckInterval. If the reload
+// fails the previous certificate continues to be served.
+func (c *certLoader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	if c.cert != nil && now.Sub(c.checked) < certCheckInterval {
+		return c.cert, nil
+	}
+	c.checked = now
+	cert, err := c.load()
+	if err != nil && c.cert != nil {
+		return c.cert, nil
+	}
+	return cert, err
+}
+
+// load loads the certificate if the files were modified since
+// the last load. The caller must hold the lock, except when
+// called from the constructor.
+func (c *certLoader) load() (*tls.Certificate, error) {
+	modtime, err := c.latest()
+	if err != nil {
+		return nil, err
+	}
+	if c.cert != nil && !modtime.After(c.modtime) {
+		return c.cert, nil
+	}
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return nil, err
+	}
+	c.cert = &cert
+	c.modtime = modtime
+	return c.cert, nil
+}
+
+// latest returns the most recent modification time of the
+// certificate and key files.
+func (c *certLoader) latest() (time.Time, error) {
+	var latest time.Time
+	for _, path := range []string{c.certFile, c.keyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return latest, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
@@ -0,0 +1,59 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/drone/drone-go/drone"
+)
+
+func TestFallback(t *testing.T) {
+	errFoo := errors.New("foo")
+	plugin := Fallback(
+		&mockPlugin{err: errFoo},
+		&mockPlugin{},
+		&mockPlugin{res: &drone.Config{Data: "a"}},
+		&mockPlugin{res: &drone.Config{Data: "b"}},
+	)
+	res, err := plugin.Find(context.Background(), &Request{})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if got, want := res.Data, "a"; got != want {
+		t.Errorf("Want config from the first plugin with a config, got %s", got)
+	}
+
+	res, err = Fallback(&mockPlugin{}).Find(context.Background(), &Request{})
+	if res != nil || err != nil {
+		t.Errorf("Want nil config when no plugin returns a config")
+	}
+
+	plugin = Fallback(&mockPlugin{}, &mockPlugin{err: errFoo}, &mockPlugin{err: errors.New("bar")})
+	if _, err := plugin.Find(context.Background(), &Request{}); err != errFoo {
+		t.Errorf("Want first error when no plugin returns a config, got %v", err)
+	}
+
+	// the fallback stops if the context is canceled.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	plugin = Fallback(&mockPlugin{err: errFoo}, &mockPlugin{res: &drone.Config{Data: "a"}})
+	if _, err := plugin.Find(ctx, &Request{}); err != context.Canceled {
+		t.Errorf("Want context error, got %v", err)
+	}
+}
@@ -24,8 +24,7 @@ import (
 	"time"
 
 	"github.com/drone/drone-go/drone"
-
-	"github.com/99designs/httpsignatures-go"
+	"github.com/drone/drone-go/plugin/internal/testutil"
 )
 
 func TestHandler(t *testing.T) {
@@ -38,7 +37,7 @@ func TestHandler(t *testing.T) {
 	req := httptest.NewRequest("GET", "/", buf)
 	req.Header.Add("Date", time.Now().UTC().Format(http.TimeFormat))
 
-	err := httpsignatures.DefaultSha256Signer.AuthRequest("hmac-key", key, req)
+	err := testutil.Sign(req, key)
 	if err != nil {
 		t.Error(err)
 		return
@@ -74,7 +73,7 @@ func TestHandler_MissingSignature(t *testing.T) {
 	handler := Handler(nil, "xVKAGlWQiY3sOp8JVc0nbuNId3PNCgWh", nil)
 	handler.ServeHTTP(res, req)
 
-	got, want := res.Body.String(), "Invalid or Missing Signature\n"
+	got, want := res.Body.String(), `{"code":400,"message":"Invalid or Missing Signature"}`+"\n"
 	if got != want {
 		t.Errorf("Want response body %q, got %q", want, got)
 	}
@@ -89,7 +88,7 @@ func TestHandler_InvalidSignature(t *testing.T) {
 	handler := Handler(nil, "xVKAGlWQiY3sOp8JVc0nbuNId3PNCgWh", nil)
 	handler.ServeHTTP(res, req)
 
-	got, want := res.Body.String(), "Invalid Signature\n"
+	got, want := res.Body.String(), `{"code":400,"message":"Invalid Signature"}`+"\n"
 	if got != want {
 		t.Errorf("Want response body %q, got %q", want, got)
 	}
@@ -0,0 +1,58 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package converter
+
+import (
+	"context"
+
+	"github.com/drone/drone-go/drone"
+)
+
+// Chain returns a Plugin that invokes the plugins in order,
+// passing the configuration returned by each plugin as the
+// input to the next plugin. A plugin that returns a nil
+// configuration leaves the configuration unchanged. The chain
+// returns nil if no plugin converts the configuration, and
+// stops at the first error.
+func Chain(plugins ...Plugin) Plugin {
+	return &chain{plugins: plugins}
+}
+
+type chain struct {
+	plugins []Plugin
+}
+
+func (p *chain) Convert(ctx context.Context, req *Request) (*drone.Config, error) {
+	// copy the request so that the caller's request is
+	// not modified.
+	in := *req
+	var out *drone.Config
+	for _, plugin := range p.plugins {
+		res, err := plugin.Convert(ctx, &in)
+		if err != nil {
+			return nil, err
+		}
+		if res == nil {
+			continue
+		}
+		in.Config = *res
+		out = &in.Config
+	}
+	if out == nil {
+		return nil, nil
+	}
+	res := *out
+	return &res, nil
+}
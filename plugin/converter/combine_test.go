@@ -0,0 +1,61 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package converter
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/drone/drone-go/drone"
+)
+
+func TestChain(t *testing.T) {
+	appendFn := func(s string) Plugin {
+		return pluginFunc(func(ctx context.Context, req *Request) (*drone.Config, error) {
+			return &drone.Config{Data: req.Config.Data + s}, nil
+		})
+	}
+	plugin := Chain(appendFn("b"), &mockPlugin{}, appendFn("c"))
+
+	req := &Request{Config: drone.Config{Data: "a"}}
+	res, err := plugin.Convert(context.Background(), req)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if got, want := res.Data, "abc"; got != want {
+		t.Errorf("Want converted config %q, got %q", want, got)
+	}
+	if got, want := req.Config.Data, "a"; got != want {
+		t.Errorf("Want request not modified, got %q", got)
+	}
+
+	res, err = Chain(&mockPlugin{}).Convert(context.Background(), req)
+	if res != nil || err != nil {
+		t.Errorf("Want nil config when no plugin converts the config")
+	}
+
+	errFoo := errors.New("foo")
+	if _, err := Chain(appendFn("b"), &mockPlugin{err: errFoo}).Convert(context.Background(), req); err != errFoo {
+		t.Errorf("Want error returned, got %v", err)
+	}
+}
+
+type pluginFunc func(context.Context, *Request) (*drone.Config, error)
+
+func (f pluginFunc) Convert(ctx context.Context, req *Request) (*drone.Config, error) {
+	return f(ctx, req)
+}
@@ -15,15 +15,18 @@
 package converter
 
 import (
-	"encoding/json"
 	"io/ioutil"
 	"net/http"
 
 	"github.com/drone/drone-go/plugin/logger"
-
-	"github.com/99designs/httpsignatures-go"
+	"github.com/drone/drone-go/plugin/middleware"
 )
 
+// versions are the supported versions of the converter API.
+var versions = middleware.NewVersions(map[string]middleware.Codec{
+	V1: middleware.JSON,
+})
+
 // Handler returns a http.Handler that accepts JSON-encoded
 // HTTP requests to convert the raw format to a yaml configuration
 // file, invokes the underlying plugin, and writes the
@@ -31,12 +34,18 @@ import (
 //
 // The handler verifies the authenticity of the HTTP request
 // using the http-signature, and returns a 400 Bad Request if
-// the signature is missing or invalid.
+// the signature is missing or invalid. The handler also
+// verifies the request body matches the signed digest and the
+// signed date is within the allowed clock skew.
+//
+// The handler negotiates the API version using the Accept
+// header, and returns a 406 Not Acceptable if the client does
+// not accept a supported version.
 //
 // The handler can optionally encrypt the response body using
 // aesgcm if the HTTP request includes the Accept-Encoding header
 // set to aesgcm.
-func Handler(plugin Plugin, secret string, logs logger.Logger) http.Handler {
+func Handler(plugin Plugin, secret string, logs logger.Logger, opts ...middleware.Option) http.Handler {
 	handler := &handler{
 		secret: secret,
 		plugin: plugin,
@@ -45,7 +54,7 @@ func Handler(plugin Plugin, secret string, logs logger.Logger) http.Handler {
 	if handler.logger == nil {
 		handler.logger = logger.Discard()
 	}
-	return handler
+	return middleware.Wrap("converter", secret, handler.logger, handler, opts...)
 }
 
 type handler struct {
@@ -55,30 +64,25 @@ type handler struct {
 }
 
 func (p *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	signature, err := httpsignatures.FromRequest(r)
+	codec, err := versions.Negotiate(w, r)
 	if err != nil {
-		p.logger.Debugf("converter: invalid or missing signature in http.Request")
-		http.Error(w, "Invalid or Missing Signature", http.StatusBadRequest)
-		return
-	}
-	if !signature.IsValid(p.secret, r) {
-		p.logger.Debugf("converter: invalid signature in http.Request")
-		http.Error(w, "Invalid Signature", http.StatusBadRequest)
+		p.logger.Debugf("converter: unsupported media type: %s", r.Header.Get("Accept"))
+		middleware.WriteError(w, err, http.StatusNotAcceptable)
 		return
 	}
 
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		p.logger.Debugf("converter: cannot read http.Request body")
-		w.WriteHeader(http.StatusBadRequest)
+		middleware.WriteError(w, err, http.StatusBadRequest)
 		return
 	}
 
 	req := &Request{}
-	err = json.Unmarshal(body, req)
+	err = codec.Decode(body, req)
 	if err != nil {
 		p.logger.Debugf("converter: cannot unmarshal http.Request body")
-		http.Error(w, "Invalid Input", http.StatusBadRequest)
+		middleware.WriteError(w, middleware.ErrInvalidInput, http.StatusBadRequest)
 		return
 	}
 
@@ -89,14 +93,14 @@ func (p *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			req.Build.Target,
 			err,
 		)
-		http.Error(w, err.Error(), http.StatusNotFound)
+		middleware.WriteError(w, err, http.StatusNotFound)
 		return
 	}
 	if res == nil {
 		w.WriteHeader(http.StatusNoContent)
 		return
 	}
-	out, _ := json.Marshal(res)
+	out, _ := codec.Encode(res)
 	w.Header().Set("Content-Type", "application/json")
 	_, _ = w.Write(out)
 }
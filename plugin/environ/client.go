@@ -18,12 +18,16 @@ import (
 	"context"
 
 	"github.com/drone/drone-go/plugin/internal/client"
+	"github.com/drone/drone-go/plugin/transport"
 )
 
 // Client returns a new plugin client.
-func Client(endpoint, secret string, skipverify bool) Plugin {
-	client := client.New(endpoint, secret, skipverify)
-	client.Accept = V2
+func Client(endpoint, secret string, skipverify bool, opts ...transport.Option) Plugin {
+	client := client.New(endpoint, secret, skipverify, opts...)
+	client.Idempotent = true
+	if client.Accept == "" {
+		client.Accept = V2
+	}
 	return &pluginClient{
 		client: client,
 	}
@@ -34,6 +38,13 @@ type pluginClient struct {
 }
 
 func (c *pluginClient) List(ctx context.Context, in *Request) ([]*Variable, error) {
+	// If the client requests the legacy V1 format we
+	// convert the V1 output to V2 output.
+	if c.client.Accept == V1 {
+		res := map[string]string{}
+		err := c.client.Do(ctx, in, &res)
+		return fromMap(res), err
+	}
 	res := []*Variable{}
 	err := c.client.Do(ctx, in, &res)
 	return res, err
@@ -0,0 +1,71 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package environ
+
+import (
+	"context"
+	"sync"
+)
+
+// Merge returns a Plugin that queries the plugins in parallel
+// and concatenates the variables in plugin order. If multiple
+// plugins return a variable with the same name, the variable
+// returned by the later plugin takes precedence. If any plugin
+// returns an error, the first error is returned.
+func Merge(plugins ...Plugin) Plugin {
+	return &merge{plugins: plugins}
+}
+
+type merge struct {
+	plugins []Plugin
+}
+
+func (p *merge) List(ctx context.Context, req *Request) ([]*Variable, error) {
+	results := make([][]*Variable, len(p.plugins))
+	errs := make([]error, len(p.plugins))
+
+	var wg sync.WaitGroup
+	for i, plugin := range p.plugins {
+		wg.Add(1)
+		go func(i int, plugin Plugin) {
+			defer wg.Done()
+			results[i], errs[i] = plugin.List(ctx, req)
+		}(i, plugin)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var out []*Variable
+	index := map[string]int{}
+	for _, result := range results {
+		for _, v := range result {
+			if v == nil {
+				continue
+			}
+			if i, ok := index[v.Name]; ok {
+				out[i] = v
+				continue
+			}
+			index[v.Name] = len(out)
+			out = append(out, v)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,55 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package environ
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMerge(t *testing.T) {
+	plugin := Merge(
+		&mockPlugin{res: []*Variable{
+			{Name: "a", Data: "1"},
+			{Name: "b", Data: "2"},
+		}},
+		&mockPlugin{res: []*Variable{
+			{Name: "c", Data: "3"},
+			{Name: "a", Data: "4", Mask: true},
+		}},
+	)
+	got, err := plugin.List(context.Background(), &Request{})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	want := []*Variable{
+		{Name: "a", Data: "4", Mask: true},
+		{Name: "b", Data: "2"},
+		{Name: "c", Data: "3"},
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf(diff)
+	}
+
+	errFoo := errors.New("foo")
+	plugin = Merge(&mockPlugin{}, &mockPlugin{err: errFoo})
+	if _, err := plugin.List(context.Background(), &Request{}); err != errFoo {
+		t.Errorf("Want error returned, got %v", err)
+	}
+}
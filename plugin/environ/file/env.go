@@ -0,0 +1,132 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/drone-go/plugin/environ"
+)
+
+// env is the environment that the variables are added to and
+// interpolated with.
+type env struct {
+	build map[string]string
+	vars  []*environ.Variable
+	index map[string]int
+}
+
+func newEnv(req *environ.Request) *env {
+	return &env{
+		build: buildVars(req.Repo, req.Build),
+		index: map[string]int{},
+	}
+}
+
+// set adds the variable. A variable that is already defined is
+// replaced, and keeps its position.
+func (e *env) set(v *environ.Variable) {
+	if i, ok := e.index[v.Name]; ok {
+		e.vars[i] = v
+		return
+	}
+	e.index[v.Name] = len(e.vars)
+	e.vars = append(e.vars, v)
+}
+
+// expand interpolates the value. The build variables take
+// precedence over the variables defined in the environment.
+// Unknown variables are replaced with an empty string.
+func (e *env) expand(s string) string {
+	if !strings.Contains(s, "$") {
+		return s
+	}
+	return os.Expand(s, func(name string) string {
+		if name == "$" {
+			return "$"
+		}
+		if value, ok := e.build[name]; ok {
+			return value
+		}
+		if i, ok := e.index[name]; ok {
+			return e.vars[i].Data
+		}
+		return ""
+	})
+}
+
+func (e *env) list() []*environ.Variable {
+	return e.vars
+}
+
+// buildVars returns the build variables used for
+// interpolation.
+func buildVars(repo drone.Repo, build drone.Build) map[string]string {
+	vars := map[string]string{
+		"DRONE_REPO":                repo.Slug,
+		"DRONE_REPO_NAMESPACE":      repo.Namespace,
+		"DRONE_REPO_OWNER":          repo.Namespace,
+		"DRONE_REPO_NAME":           repo.Name,
+		"DRONE_REPO_BRANCH":         repo.Branch,
+		"DRONE_REPO_LINK":           repo.Link,
+		"DRONE_GIT_HTTP_URL":        repo.HTTPURL,
+		"DRONE_GIT_SSH_URL":         repo.SSHURL,
+		"DRONE_BUILD_NUMBER":        strconv.FormatInt(build.Number, 10),
+		"DRONE_BUILD_PARENT":        strconv.FormatInt(build.Parent, 10),
+		"DRONE_BUILD_EVENT":         build.Event,
+		"DRONE_BUILD_ACTION":        build.Action,
+		"DRONE_BUILD_LINK":          build.Link,
+		"DRONE_BRANCH":              build.Target,
+		"DRONE_SOURCE_BRANCH":       build.Source,
+		"DRONE_TARGET_BRANCH":       build.Target,
+		"DRONE_COMMIT":              build.After,
+		"DRONE_COMMIT_SHA":          build.After,
+		"DRONE_COMMIT_BEFORE":       build.Before,
+		"DRONE_COMMIT_AFTER":        build.After,
+		"DRONE_COMMIT_REF":          build.Ref,
+		"DRONE_COMMIT_BRANCH":       build.Target,
+		"DRONE_COMMIT_MESSAGE":      build.Message,
+		"DRONE_COMMIT_AUTHOR":       build.Author,
+		"DRONE_COMMIT_AUTHOR_NAME":  build.AuthorName,
+		"DRONE_COMMIT_AUTHOR_EMAIL": build.AuthorEmail,
+		"DRONE_DEPLOY_TO":           build.Deploy,
+		"DRONE_CRON":                build.Cron,
+	}
+	if strings.HasPrefix(build.Ref, "refs/tags/") {
+		vars["DRONE_TAG"] = strings.TrimPrefix(build.Ref, "refs/tags/")
+	}
+	if build.Event == drone.EventPullRequest {
+		vars["DRONE_PULL_REQUEST"] = pullRequest(build.Ref)
+	}
+	return vars
+}
+
+// pullRequest returns the pull request number from the ref,
+// for example refs/pull/42/head.
+func pullRequest(ref string) string {
+	for _, prefix := range []string{"refs/pull/", "refs/pull-requests/", "refs/merge-requests/"} {
+		if strings.HasPrefix(ref, prefix) {
+			ref = strings.TrimPrefix(ref, prefix)
+			if i := strings.Index(ref, "/"); i != -1 {
+				return ref[:i]
+			}
+			return ref
+		}
+	}
+	return ""
+}
@@ -0,0 +1,203 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package file provides an environment plugin that builds the
+// environment variables from layered dotenv or YAML files.
+//
+// The variables are loaded from the following layers in the
+// directory, where a variable defined in a later layer
+// overrides the variable defined in an earlier layer:
+//
+//	global
+//	orgs/<namespace>
+//	repos/<namespace>/<name>
+//	repos/<namespace>/<name>/branches/<branch>
+//	repos/<namespace>/<name>/events/<event>
+//
+// Each layer is loaded from the .env, .yml and .yaml files
+// with the layer name, if they exist. The branch is the build
+// target branch, and is path escaped, for example the
+// release/v1 branch is loaded from branches/release%2Fv1.env.
+//
+// A dotenv file contains NAME=value lines. A YAML file
+// contains a map of variable names to values, where a value
+// can be masked:
+//
+//	DOCKER_USERNAME: octocat
+//	DOCKER_PASSWORD:
+//	  value: correct-horse-battery-staple
+//	  mask: true
+//
+// Values are interpolated with the build variables, for
+// example ${DRONE_BRANCH} or ${DRONE_COMMIT_SHA}, and with
+// the variables defined in earlier layers or earlier in the
+// same file. Use $$ to escape the $ character.
+package file
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/drone/drone-go/plugin/environ"
+	"github.com/drone/drone-go/plugin/logger"
+	"github.com/drone/drone-go/plugin/policy"
+)
+
+// extensions are the supported file extensions, in load
+// order.
+var extensions = []string{".env", ".yml", ".yaml"}
+
+// Config configures the file environment plugin.
+type Config struct {
+	// Dir is the directory that contains the layers.
+	Dir string
+
+	// Mask is an optional list of variable name glob
+	// patterns, for example *_PASSWORD. Matching variables
+	// are masked.
+	Mask []string
+}
+
+// New returns an environment plugin that builds the
+// environment variables from layered files in the directory.
+//
+// The files are reloaded when modified. If the reload fails,
+// the error is logged and the previously loaded variables
+// continue to be served.
+func New(config Config, logs logger.Logger) (environ.Plugin, error) {
+	if logs == nil {
+		logs = logger.Discard()
+	}
+	info, err := os.Stat(config.Dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("environ: %s is not a directory", config.Dir)
+	}
+	for _, pattern := range config.Mask {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("environ: invalid mask pattern %q: %s", pattern, err)
+		}
+	}
+	return &provider{
+		config: config,
+		logger: logs,
+		files:  map[string]*file{},
+	}, nil
+}
+
+type provider struct {
+	config Config
+	logger logger.Logger
+
+	mu    sync.Mutex
+	files map[string]*file
+}
+
+// file is a loaded file.
+type file struct {
+	vars    []*environ.Variable
+	modtime time.Time
+}
+
+func (p *provider) List(ctx context.Context, req *environ.Request) ([]*environ.Variable, error) {
+	env := newEnv(req)
+	for _, layer := range layers(req) {
+		for _, ext := range extensions {
+			vars, err := p.load(filepath.Join(p.config.Dir, filepath.FromSlash(layer)+ext))
+			if err != nil {
+				return nil, err
+			}
+			for _, v := range vars {
+				env.set(&environ.Variable{
+					Name: v.Name,
+					Data: env.expand(v.Data),
+					Mask: v.Mask || policy.Match(p.config.Mask, v.Name),
+				})
+			}
+		}
+	}
+	return env.list(), nil
+}
+
+// load returns the variables in the file, or nil if the file
+// does not exist. The file is reloaded if it was modified since
+// the last load.
+func (p *provider) load(name string) ([]*environ.Variable, error) {
+	info, err := os.Stat(name)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	cached, ok := p.files[name]
+	if ok && cached.modtime.Equal(info.ModTime()) {
+		return cached.vars, nil
+	}
+	vars, err := parse(name)
+	if err != nil {
+		if ok {
+			p.logger.Errorf("environ: cannot reload %s: %s", name, err)
+			return cached.vars, nil
+		}
+		return nil, err
+	}
+	p.files[name] = &file{vars: vars, modtime: info.ModTime()}
+	return vars, nil
+}
+
+// layers returns the layer names for the request, in load
+// order.
+func layers(req *environ.Request) []string {
+	namespace := segment(req.Repo.Namespace)
+	name := segment(req.Repo.Name)
+	res := []string{"global"}
+	if namespace == "" {
+		return res
+	}
+	res = append(res, "orgs/"+namespace)
+	if name == "" {
+		return res
+	}
+	repo := "repos/" + namespace + "/" + name
+	res = append(res, repo)
+	if branch := segment(req.Build.Target); branch != "" {
+		res = append(res, repo+"/branches/"+branch)
+	}
+	if event := segment(req.Build.Event); event != "" {
+		res = append(res, repo+"/events/"+event)
+	}
+	return res
+}
+
+// segment returns the path escaped value, or an empty string
+// if the value cannot be used as a path segment.
+func segment(s string) string {
+	switch s {
+	case "", ".", "..":
+		return ""
+	}
+	return url.PathEscape(s)
+}
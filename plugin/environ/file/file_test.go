@@ -0,0 +1,251 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/drone/drone-go/plugin/environ"
+	"github.com/drone/drone-go/plugin/fixtures"
+	"github.com/drone/drone-go/plugin/plugintest"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var testdata = map[string]string{
+	"global.env": `
+# global defaults
+export REGISTRY=docker.io
+IMAGE=${REGISTRY}/${DRONE_REPO}
+TAG=latest
+GOPROXY='https://proxy.golang.org,$direct'
+GREETING="hello\nworld"
+`,
+	"orgs/octocat.yml": `
+REGISTRY: quay.io
+IMAGE: ${REGISTRY}/${DRONE_REPO}
+DOCKER_PASSWORD:
+  value: correct-horse-battery-staple
+  mask: true
+`,
+	"repos/octocat/hello-world.env": `
+TAG=${DRONE_COMMIT_SHA} # commit tag
+NPM_TOKEN=npm.token
+`,
+	"repos/octocat/hello-world/branches/release%2Fv1.env": `
+TAG=v1-$${DRONE_BUILD_NUMBER}
+`,
+	"repos/octocat/hello-world/events/pull_request.yml": `
+DEPLOY: false
+PULL_REQUEST: ${DRONE_PULL_REQUEST}
+`,
+}
+
+func setup(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "drone-environ-file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range testdata {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0700)
+		if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func TestList(t *testing.T) {
+	dir, cleanup := setup(t)
+	defer cleanup()
+
+	p, err := New(Config{Dir: dir, Mask: []string{"*_TOKEN"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo := fixtures.NewRepo("octocat/hello-world")
+	tests := []struct {
+		name string
+		f    *fixtures.Fixture
+		want []*environ.Variable
+	}{
+		{
+			name: "global",
+			f:    fixtures.New(fixtures.NewRepo("spaceghost/hello-world"), fixtures.NewBuild()),
+			want: []*environ.Variable{
+				{Name: "REGISTRY", Data: "docker.io"},
+				{Name: "IMAGE", Data: "docker.io/spaceghost/hello-world"},
+				{Name: "TAG", Data: "latest"},
+				{Name: "GOPROXY", Data: "https://proxy.golang.org,$direct"},
+				{Name: "GREETING", Data: "hello\nworld"},
+			},
+		},
+		{
+			name: "repo",
+			f:    fixtures.New(repo, fixtures.NewBuild()),
+			want: []*environ.Variable{
+				{Name: "REGISTRY", Data: "quay.io"},
+				{Name: "IMAGE", Data: "quay.io/octocat/hello-world"},
+				{Name: "TAG", Data: "7fd1a60b01f91b314f59955a4e4d4e80d8edf11d"},
+				{Name: "GOPROXY", Data: "https://proxy.golang.org,$direct"},
+				{Name: "GREETING", Data: "hello\nworld"},
+				{Name: "DOCKER_PASSWORD", Data: "correct-horse-battery-staple", Mask: true},
+				{Name: "NPM_TOKEN", Data: "npm.token", Mask: true},
+			},
+		},
+		{
+			name: "branch",
+			f:    fixtures.New(repo, fixtures.NewBuild().Push("release/v1")),
+			want: []*environ.Variable{
+				{Name: "REGISTRY", Data: "quay.io"},
+				{Name: "IMAGE", Data: "quay.io/octocat/hello-world"},
+				{Name: "TAG", Data: "v1-${DRONE_BUILD_NUMBER}"},
+				{Name: "GOPROXY", Data: "https://proxy.golang.org,$direct"},
+				{Name: "GREETING", Data: "hello\nworld"},
+				{Name: "DOCKER_PASSWORD", Data: "correct-horse-battery-staple", Mask: true},
+				{Name: "NPM_TOKEN", Data: "npm.token", Mask: true},
+			},
+		},
+		{
+			name: "pull request",
+			f:    fixtures.New(repo, fixtures.NewBuild().PullRequestNumber(42).PullRequest("feature", "master")),
+			want: []*environ.Variable{
+				{Name: "REGISTRY", Data: "quay.io"},
+				{Name: "IMAGE", Data: "quay.io/octocat/hello-world"},
+				{Name: "TAG", Data: "7fd1a60b01f91b314f59955a4e4d4e80d8edf11d"},
+				{Name: "GOPROXY", Data: "https://proxy.golang.org,$direct"},
+				{Name: "GREETING", Data: "hello\nworld"},
+				{Name: "DOCKER_PASSWORD", Data: "correct-horse-battery-staple", Mask: true},
+				{Name: "NPM_TOKEN", Data: "npm.token", Mask: true},
+				{Name: "DEPLOY", Data: "false"},
+				{Name: "PULL_REQUEST", Data: "42"},
+			},
+		},
+		{
+			// the repository cannot be used to load another
+			// layer.
+			name: "path traversal",
+			f:    fixtures.New(fixtures.NewRepo("../octocat"), fixtures.NewBuild().Push("../../../global")),
+			want: []*environ.Variable{
+				{Name: "REGISTRY", Data: "docker.io"},
+				{Name: "IMAGE", Data: "docker.io/../octocat"},
+				{Name: "TAG", Data: "latest"},
+				{Name: "GOPROXY", Data: "https://proxy.golang.org,$direct"},
+				{Name: "GREETING", Data: "hello\nworld"},
+			},
+		},
+	}
+	for _, test := range tests {
+		got, err := p.List(context.Background(), test.f.EnvironRequest())
+		if err != nil {
+			t.Errorf("Unexpected error for %s: %s", test.name, err)
+			continue
+		}
+		if diff := cmp.Diff(got, test.want); diff != "" {
+			t.Errorf("Unexpected variables for %s", test.name)
+			t.Log(diff)
+		}
+	}
+}
+
+// TestHandler verifies the variables are compatible with the
+// V1 and V2 environment API.
+func TestHandler(t *testing.T) {
+	dir, cleanup := setup(t)
+	defer cleanup()
+
+	const key = "xVKAGlWQiY3sOp8JVc0nbuNId3PNCgWh"
+	p, _ := New(Config{Dir: dir}, nil)
+	handler := environ.Handler(key, p, nil)
+	req := fixtures.New(fixtures.NewRepo("octocat/hello-world"), fixtures.NewBuild()).EnvironRequest()
+
+	v2, err := plugintest.DecodeVariables(plugintest.Do(handler, plugintest.EnvironRequest(key, req)), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(v2) != 7 || !v2[5].Mask {
+		t.Errorf("Want V2 variables with the mask flag, got %d variables", len(v2))
+	}
+
+	v1, err := plugintest.DecodeVariablesV1(plugintest.Do(handler, plugintest.EnvironV1Request(key, req)), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := v1["IMAGE"], "quay.io/octocat/hello-world"; got != want {
+		t.Errorf("Want V1 variable %s, got %s", want, got)
+	}
+	if len(v1) != len(v2) {
+		t.Errorf("Want %d V1 variables, got %d", len(v2), len(v1))
+	}
+}
+
+func TestList_Reload(t *testing.T) {
+	dir, cleanup := setup(t)
+	defer cleanup()
+
+	p, _ := New(Config{Dir: dir}, nil)
+	req := fixtures.New(fixtures.NewRepo("spaceghost/hello-world"), fixtures.NewBuild()).EnvironRequest()
+	p.List(context.Background(), req)
+
+	path := filepath.Join(dir, "global.env")
+	ioutil.WriteFile(path, []byte("TAG=stable"), 0600)
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(path, future, future)
+	got, _ := p.List(context.Background(), req)
+	if len(got) != 1 || got[0].Data != "stable" {
+		t.Errorf("Want variables reloaded, got %d variables", len(got))
+	}
+
+	// an invalid file is logged and the previous variables
+	// continue to be served.
+	ioutil.WriteFile(path, []byte("TAG"), 0600)
+	future = future.Add(time.Minute)
+	os.Chtimes(path, future, future)
+	got, err := p.List(context.Background(), req)
+	if err != nil || len(got) != 1 || got[0].Data != "stable" {
+		t.Errorf("Want previous variables served, got %v", err)
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	tests := map[string]string{
+		"missing.env":  "TAG",
+		"quote.env":    `TAG="latest`,
+		"name.env":     "1TAG=latest",
+		"space.env":    "MY TAG=latest",
+		"list.yml":     "TAG: [ latest ]",
+		"unknown.yml":  "TAG: { value: latest, masked: true }",
+		"invalid.yaml": "TAG: : :",
+	}
+	dir, err := ioutil.TempDir("", "drone-environ-file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for name, data := range tests {
+		path := filepath.Join(dir, name)
+		ioutil.WriteFile(path, []byte(data), 0600)
+		if _, err := parse(path); err == nil {
+			t.Errorf("Want error for %s", name)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/drone/drone-go/plugin/environ"
+
+	"gopkg.in/yaml.v2"
+)
+
+// parse parses the variables file. A .env file is parsed as a
+// dotenv file, and any other file is parsed as YAML.
+func parse(name string) ([]*environ.Variable, error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var vars []*environ.Variable
+	if filepath.Ext(name) == ".env" {
+		vars, err = parseDotenv(data)
+	} else {
+		vars, err = parseYAML(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", name, err)
+	}
+	for _, v := range vars {
+		if !valid(v.Name) {
+			return nil, fmt.Errorf("%s: invalid variable name %q", name, v.Name)
+		}
+	}
+	return vars, nil
+}
+
+// parseDotenv parses NAME=value lines. Blank lines and lines
+// that start with # are ignored, and the line can start with
+// export. A single quoted value is literal, and a double
+// quoted value can include the \n, \", \\ and \$ escapes.
+func parseDotenv(data []byte) ([]*environ.Variable, error) {
+	var vars []*environ.Variable
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		text = strings.TrimPrefix(text, "export ")
+		parts := strings.SplitN(text, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("line %d: missing =", line)
+		}
+		value, err := unquote(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", line, err)
+		}
+		vars = append(vars, &environ.Variable{
+			Name: strings.TrimSpace(parts[0]),
+			Data: value,
+		})
+	}
+	return vars, scanner.Err()
+}
+
+// unquote returns the unquoted dotenv value. The \$ escape is
+// preserved as $$ so that the $ is not interpolated.
+func unquote(s string) (string, error) {
+	if len(s) == 0 {
+		return s, nil
+	}
+	switch s[0] {
+	case '\'':
+		if len(s) < 2 || s[len(s)-1] != '\'' {
+			return "", fmt.Errorf("unterminated quoted value")
+		}
+		return strings.Replace(s[1:len(s)-1], "$", "$$", -1), nil
+	case '"':
+		if len(s) < 2 || s[len(s)-1] != '"' {
+			return "", fmt.Errorf("unterminated quoted value")
+		}
+		var b strings.Builder
+		s = s[1 : len(s)-1]
+		for i := 0; i < len(s); i++ {
+			if s[i] != '\\' || i == len(s)-1 {
+				b.WriteByte(s[i])
+				continue
+			}
+			i++
+			switch s[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case '$':
+				b.WriteString("$$")
+			case '"', '\\':
+				b.WriteByte(s[i])
+			default:
+				b.WriteByte('\\')
+				b.WriteByte(s[i])
+			}
+		}
+		return b.String(), nil
+	}
+	// an unquoted value can end with a comment.
+	if i := strings.Index(s, " #"); i != -1 {
+		s = strings.TrimSpace(s[:i])
+	}
+	return s, nil
+}
+
+// parseYAML parses a map of variable names to values, in file
+// order. A value is a scalar, or a map with the value and mask
+// keys.
+func parseYAML(data []byte) ([]*environ.Variable, error) {
+	var items yaml.MapSlice
+	if err := yaml.Unmarshal(data, &items); err != nil {
+		return nil, err
+	}
+	var vars []*environ.Variable
+	for _, item := range items {
+		name := fmt.Sprint(item.Key)
+		v := &environ.Variable{Name: name}
+		switch value := item.Value.(type) {
+		case nil:
+		case yaml.MapSlice:
+			masked := struct {
+				Value string `yaml:"value"`
+				Mask  bool   `yaml:"mask"`
+			}{}
+			out, _ := yaml.Marshal(value)
+			if err := yaml.UnmarshalStrict(out, &masked); err != nil {
+				return nil, fmt.Errorf("variable %s: %s", name, err)
+			}
+			v.Data, v.Mask = masked.Value, masked.Mask
+		case []interface{}:
+			return nil, fmt.Errorf("variable %s: invalid value", name)
+		default:
+			v.Data = fmt.Sprint(value)
+		}
+		vars = append(vars, v)
+	}
+	return vars, nil
+}
+
+// valid returns true if the variable name is valid.
+func valid(name string) bool {
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		return false
+	}
+	for _, c := range name {
+		switch {
+		case c == '_':
+		case c >= 'a' && c <= 'z':
+		case c >= 'A' && c <= 'Z':
+		case c >= '0' && c <= '9':
+		default:
+			return false
+		}
+	}
+	return true
+}
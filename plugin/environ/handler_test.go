@@ -24,8 +24,8 @@ import (
 	"time"
 
 	"github.com/drone/drone-go/plugin/internal/aesgcm"
+	"github.com/drone/drone-go/plugin/internal/testutil"
 
-	"github.com/99designs/httpsignatures-go"
 	"github.com/google/go-cmp/cmp"
 )
 
@@ -39,7 +39,7 @@ func TestHandler(t *testing.T) {
 	req := httptest.NewRequest("GET", "/", buf)
 	req.Header.Add("Date", time.Now().UTC().Format(http.TimeFormat))
 
-	err := httpsignatures.DefaultSha256Signer.AuthRequest("hmac-key", key, req)
+	err := testutil.Sign(req, key)
 	if err != nil {
 		t.Error(err)
 		return
@@ -82,7 +82,7 @@ func TestHandler_Encrypted(t *testing.T) {
 	req.Header.Add("Date", time.Now().UTC().Format(http.TimeFormat))
 	req.Header.Add("Accept-Encoding", "aesgcm")
 
-	err := httpsignatures.DefaultSha256Signer.AuthRequest("hmac-key", key, req)
+	err := testutil.Sign(req, key)
 	if err != nil {
 		t.Error(err)
 		return
@@ -137,7 +137,7 @@ func TestHandler_MissingSignature(t *testing.T) {
 	handler := Handler("xVKAGlWQiY3sOp8JVc0nbuNId3PNCgWh", nil, nil)
 	handler.ServeHTTP(res, req)
 
-	got, want := res.Body.String(), "Invalid or Missing Signature\n"
+	got, want := res.Body.String(), `{"code":400,"message":"Invalid or Missing Signature"}`+"\n"
 	if got != want {
 		t.Errorf("Want response body %q, got %q", want, got)
 	}
@@ -152,7 +152,7 @@ func TestHandler_InvalidSignature(t *testing.T) {
 	handler := Handler("xVKAGlWQiY3sOp8JVc0nbuNId3PNCgWh", nil, nil)
 	handler.ServeHTTP(res, req)
 
-	got, want := res.Body.String(), "Invalid Signature\n"
+	got, want := res.Body.String(), `{"code":400,"message":"Invalid Signature"}`+"\n"
 	if got != want {
 		t.Errorf("Want response body %q, got %q", want, got)
 	}
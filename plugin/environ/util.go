@@ -14,6 +14,13 @@
 
 package environ
 
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/drone/drone-go/plugin/middleware"
+)
+
 // toMap is a helper function that converts a list of
 // variables to a map.
 func toMap(src []*Variable) map[string]string {
@@ -23,3 +30,29 @@ func toMap(src []*Variable) map[string]string {
 	}
 	return dst
 }
+
+// fromMap is a helper function that converts a map to a
+// list of variables, sorted by name.
+func fromMap(src map[string]string) []*Variable {
+	dst := make([]*Variable, 0, len(src))
+	for k, v := range src {
+		dst = append(dst, &Variable{Name: k, Data: v})
+	}
+	sort.Slice(dst, func(i, j int) bool {
+		return dst[i].Name < dst[j].Name
+	})
+	return dst
+}
+
+// v1Codec is the codec for version 1 of the env API, which
+// encodes the variables as a map of names to values.
+type v1Codec struct{}
+
+func (v1Codec) Decode(data []byte, v interface{}) error {
+	return middleware.JSON.Decode(data, v)
+}
+
+func (v1Codec) Encode(v interface{}) ([]byte, error) {
+	src, _ := v.([]*Variable)
+	return json.Marshal(toMap(src))
+}
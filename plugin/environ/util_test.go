@@ -36,3 +36,19 @@ func TestToMap(t *testing.T) {
 		t.Errorf("Unexpected map value")
 	}
 }
+
+func TestFromMap(t *testing.T) {
+	in := map[string]string{
+		"foo": "bar",
+		"baz": "qux",
+	}
+	want := []*Variable{
+		{Name: "baz", Data: "qux"},
+		{Name: "foo", Data: "bar"},
+	}
+	got := fromMap(in)
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Log(diff)
+		t.Errorf("Unexpected variables")
+	}
+}
@@ -0,0 +1,43 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"net/http"
+
+	"github.com/drone/drone-go/drone"
+)
+
+// Typed errors that plugins can return, optionally wrapped,
+// to control the status code of the response. The client
+// decodes the error response so that the caller can compare
+// the returned error using errors.Is, which matches any error
+// with the same status code. Untyped errors are returned with
+// the default status code of the handler, for example, 404 Not
+// Found for the secret, registry, environ, config and converter
+// handlers.
+var (
+	// ErrNotFound indicates the requested resource does
+	// not exist.
+	ErrNotFound = &drone.Sentinel{Code: http.StatusNotFound, Message: "Not Found"}
+
+	// ErrDenied indicates the request is not permitted.
+	ErrDenied = &drone.Sentinel{Code: http.StatusForbidden, Message: "Forbidden"}
+
+	// ErrUnavailable indicates a temporary failure, for
+	// example, the plugin backend is unreachable. The
+	// request can be retried.
+	ErrUnavailable = &drone.Sentinel{Code: http.StatusServiceUnavailable, Message: "Service Unavailable", Retryable: true}
+)
@@ -0,0 +1,334 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fixtures
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/drone/drone-go/drone"
+)
+
+// BuildBuilder builds a drone.Build. The event specific
+// methods, such as Push and PullRequest, change the build
+// event, and the ref, source and target branches are derived
+// from the event when the build is created.
+type BuildBuilder struct {
+	number  int64
+	pull    int64
+	parent  int64
+	event   string
+	action  string
+	source  string
+	target  string
+	tag     string
+	fork    string
+	deploy  string
+	cron    string
+	trigger string
+	title   string
+	message string
+	before  string
+	after   string
+	status  string
+	params  map[string]string
+	debug   bool
+
+	author string
+	name   string
+	email  string
+}
+
+// NewBuild returns a BuildBuilder for a push to the master
+// branch.
+func NewBuild() *BuildBuilder {
+	return &BuildBuilder{
+		number:  1,
+		pull:    1,
+		event:   drone.EventPush,
+		source:  "master",
+		target:  "master",
+		message: "Update README.md",
+		before:  "553c2077f0edc3d5dc5d17262f6aa498e69d6f8e",
+		after:   "7fd1a60b01f91b314f59955a4e4d4e80d8edf11d",
+		status:  drone.StatusPending,
+		author:  "octocat",
+		name:    "The Octocat",
+		email:   "octocat@github.com",
+	}
+}
+
+// Number sets the build number.
+func (b *BuildBuilder) Number(number int64) *BuildBuilder {
+	b.number = number
+	return b
+}
+
+// PullRequestNumber sets the pull request number, which is
+// used in the ref and link of a pull_request build. The
+// number defaults to 1, and is independent of the build
+// number.
+func (b *BuildBuilder) PullRequestNumber(number int64) *BuildBuilder {
+	b.pull = number
+	return b
+}
+
+// Push sets the build event to push, to the branch.
+func (b *BuildBuilder) Push(branch string) *BuildBuilder {
+	b.event = drone.EventPush
+	b.action = ""
+	b.source = branch
+	b.target = branch
+	return b
+}
+
+// PullRequest sets the build event to pull_request, from the
+// source branch to the target branch. The action is opened.
+func (b *BuildBuilder) PullRequest(from, to string) *BuildBuilder {
+	b.event = drone.EventPullRequest
+	b.action = drone.ActionOpened
+	b.source = from
+	b.target = to
+	if b.title == "" {
+		b.title = b.message
+	}
+	return b
+}
+
+// Fork sets the source repository of a pull request from a
+// fork. The fork is ignored unless the build event is
+// pull_request.
+func (b *BuildBuilder) Fork(slug string) *BuildBuilder {
+	b.fork = slug
+	return b
+}
+
+// Tag sets the build event to tag.
+func (b *BuildBuilder) Tag(name string) *BuildBuilder {
+	b.event = drone.EventTag
+	b.action = ""
+	b.tag = name
+	return b
+}
+
+// Promote sets the build event to promote, promoting the
+// parent build to the target environment. If the parent is
+// not set, the parent is the previous build.
+func (b *BuildBuilder) Promote(environment string) *BuildBuilder {
+	b.event = drone.EventPromote
+	b.action = ""
+	b.deploy = environment
+	return b
+}
+
+// Rollback sets the build event to rollback, rolling back the
+// target environment to the parent build. If the parent is not
+// set, the parent is the previous build.
+func (b *BuildBuilder) Rollback(environment string) *BuildBuilder {
+	b.event = drone.EventRollback
+	b.action = ""
+	b.deploy = environment
+	return b
+}
+
+// Cron sets the build event to cron, triggered by the named
+// cron job.
+func (b *BuildBuilder) Cron(name string) *BuildBuilder {
+	b.event = drone.EventCron
+	b.action = ""
+	b.cron = name
+	return b
+}
+
+// Custom sets the build event to custom, triggered by the
+// build author.
+func (b *BuildBuilder) Custom() *BuildBuilder {
+	b.event = drone.EventCustom
+	b.action = ""
+	return b
+}
+
+// Branch sets the branch of a push, cron, custom, promote or
+// rollback build.
+func (b *BuildBuilder) Branch(branch string) *BuildBuilder {
+	b.source = branch
+	b.target = branch
+	return b
+}
+
+// Action sets the pull request action, for example
+// synchronized. The action is ignored unless the build event
+// is pull_request.
+func (b *BuildBuilder) Action(action string) *BuildBuilder {
+	b.action = action
+	return b
+}
+
+// Parent sets the parent build number of a promote or
+// rollback build.
+func (b *BuildBuilder) Parent(number int64) *BuildBuilder {
+	b.parent = number
+	return b
+}
+
+// Author sets the commit author.
+func (b *BuildBuilder) Author(login, name, email string) *BuildBuilder {
+	b.author = login
+	b.name = name
+	b.email = email
+	return b
+}
+
+// Trigger sets the login of the user that triggered the
+// build. The default trigger is @hook, or @cron for a cron
+// build, and the author for a promote, rollback or custom
+// build.
+func (b *BuildBuilder) Trigger(login string) *BuildBuilder {
+	b.trigger = login
+	return b
+}
+
+// Commit sets the commit sha.
+func (b *BuildBuilder) Commit(sha string) *BuildBuilder {
+	b.after = sha
+	return b
+}
+
+// Before sets the previous commit sha.
+func (b *BuildBuilder) Before(sha string) *BuildBuilder {
+	b.before = sha
+	return b
+}
+
+// Message sets the commit message.
+func (b *BuildBuilder) Message(message string) *BuildBuilder {
+	b.message = message
+	return b
+}
+
+// Title sets the pull request title.
+func (b *BuildBuilder) Title(title string) *BuildBuilder {
+	b.title = title
+	return b
+}
+
+// Param adds a build parameter.
+func (b *BuildBuilder) Param(key, value string) *BuildBuilder {
+	if b.params == nil {
+		b.params = map[string]string{}
+	}
+	b.params[key] = value
+	return b
+}
+
+// Status sets the build status.
+func (b *BuildBuilder) Status(status string) *BuildBuilder {
+	b.status = status
+	return b
+}
+
+// Debug enables debug mode.
+func (b *BuildBuilder) Debug() *BuildBuilder {
+	b.debug = true
+	return b
+}
+
+// Build returns the build. The build is not linked to a
+// repository; use New to create a build for a repository.
+func (b *BuildBuilder) Build() drone.Build {
+	return b.build(nil)
+}
+
+// build returns the build for the repository, if not nil.
+func (b *BuildBuilder) build(repo *drone.Repo) drone.Build {
+	out := drone.Build{
+		Number:       b.number,
+		Parent:       b.parent,
+		Trigger:      b.trigger,
+		Status:       b.status,
+		Event:        b.event,
+		Message:      b.message,
+		Before:       b.before,
+		After:        b.after,
+		Ref:          "refs/heads/" + b.source,
+		Source:       b.source,
+		Target:       b.target,
+		Author:       b.author,
+		AuthorName:   b.name,
+		AuthorEmail:  b.email,
+		AuthorAvatar: avatar(b.author),
+		Sender:       b.author,
+		Params:       b.params,
+		Debug:        b.debug,
+		Timestamp:    timestamp,
+		Created:      timestamp,
+		Updated:      timestamp,
+		Version:      1,
+	}
+
+	switch b.event {
+	case drone.EventPullRequest:
+		out.Action = b.action
+		out.Title = b.title
+		out.Ref = fmt.Sprintf("refs/pull/%d/head", b.pull)
+		out.Fork = b.fork
+	case drone.EventTag:
+		out.Ref = "refs/tags/" + b.tag
+		out.Source = b.tag
+		out.Target = b.tag
+	case drone.EventPromote, drone.EventRollback:
+		out.Deploy = b.deploy
+		if out.Parent == 0 && out.Number > 1 {
+			out.Parent = out.Number - 1
+		}
+	case drone.EventCron:
+		out.Cron = b.cron
+	}
+
+	if out.Trigger == "" {
+		switch b.event {
+		case drone.EventCron:
+			out.Trigger = "@cron"
+		case drone.EventPromote, drone.EventRollback, drone.EventCustom:
+			out.Trigger = b.author
+		default:
+			out.Trigger = "@hook"
+		}
+	}
+
+	if repo != nil {
+		out.RepoID = repo.ID
+		out.Fork = repo.Slug
+		out.Link = repo.Link + "/commit/" + out.After
+		switch b.event {
+		case drone.EventPullRequest:
+			if b.fork != "" {
+				out.Fork = b.fork
+			}
+			out.Link = fmt.Sprintf("%s/pull/%d", repo.Link, b.pull)
+		case drone.EventTag:
+			out.Link = repo.Link + "/releases/tag/" + b.tag
+		}
+	}
+	return out
+}
+
+// avatar returns the avatar url for the login.
+func avatar(login string) string {
+	if login == "" || strings.Contains(login, "@") {
+		return ""
+	}
+	return "https://github.com/" + login + ".png"
+}
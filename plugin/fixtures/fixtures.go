@@ -0,0 +1,160 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fixtures provides builders for realistic repository,
+// build and user values, and the plugin requests created from
+// them, for use in plugin tests.
+//
+//	f := fixtures.New(
+//		fixtures.NewRepo("octocat/hello-world").Private().Trusted(),
+//		fixtures.NewBuild().PullRequest("feature", "master").Fork("spaceghost/hello-world"),
+//	)
+//	req := f.SecretRequest("docker", "password")
+package fixtures
+
+import (
+	"strconv"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/drone-go/plugin/admission"
+	"github.com/drone/drone-go/plugin/config"
+	"github.com/drone/drone-go/plugin/converter"
+	"github.com/drone/drone-go/plugin/environ"
+	"github.com/drone/drone-go/plugin/registry"
+	"github.com/drone/drone-go/plugin/secret"
+	"github.com/drone/drone-go/plugin/validator"
+	"github.com/drone/drone-go/plugin/webhook"
+)
+
+// timestamp is the fixed timestamp used for all fixtures, so
+// that fixtures are deterministic.
+const timestamp = 1577836800
+
+// Fixture is a build in a repository.
+type Fixture struct {
+	Repo  drone.Repo
+	Build drone.Build
+}
+
+// New returns a Fixture for the build in the repository. The
+// build is linked to the repository: the repository id, the
+// build links and the pull request source repository are
+// derived from the repository. If repo or build is nil, the
+// default repository or build is used.
+func New(repo *RepoBuilder, build *BuildBuilder) *Fixture {
+	if repo == nil {
+		repo = NewRepo("octocat/hello-world")
+	}
+	if build == nil {
+		build = NewBuild()
+	}
+	f := &Fixture{Repo: repo.Repo()}
+	f.Build = build.build(&f.Repo)
+	f.Repo.Counter = f.Build.Number
+	return f
+}
+
+// IsFork returns true if the build is a pull request from a
+// fork.
+func (f *Fixture) IsFork() bool {
+	return f.Build.Event == drone.EventPullRequest && f.Build.Fork != f.Repo.Slug
+}
+
+// SecretRequest returns a secret request for the named secret
+// at the path.
+func (f *Fixture) SecretRequest(path, name string) *secret.Request {
+	return &secret.Request{
+		Path:  path,
+		Name:  name,
+		Repo:  f.Repo,
+		Build: f.Build,
+	}
+}
+
+// EnvironRequest returns an environ request.
+func (f *Fixture) EnvironRequest() *environ.Request {
+	return &environ.Request{
+		Repo:  f.Repo,
+		Build: f.Build,
+	}
+}
+
+// RegistryRequest returns a registry request.
+func (f *Fixture) RegistryRequest() *registry.Request {
+	return &registry.Request{
+		Repo:  f.Repo,
+		Build: f.Build,
+	}
+}
+
+// ConfigRequest returns a config request.
+func (f *Fixture) ConfigRequest() *config.Request {
+	return &config.Request{
+		Repo:  f.Repo,
+		Build: f.Build,
+		Token: token(),
+	}
+}
+
+// ConverterRequest returns a converter request for the
+// configuration data.
+func (f *Fixture) ConverterRequest(data string) *converter.Request {
+	return &converter.Request{
+		Repo:   f.Repo,
+		Build:  f.Build,
+		Config: drone.Config{Data: data},
+		Token:  token(),
+	}
+}
+
+// ValidatorRequest returns a validator request for the
+// configuration data.
+func (f *Fixture) ValidatorRequest(data string) *validator.Request {
+	return &validator.Request{
+		Repo:   f.Repo,
+		Build:  f.Build,
+		Config: drone.Config{Data: data},
+	}
+}
+
+// WebhookRequest returns a build webhook request with the
+// action, for example webhook.ActionCreated.
+func (f *Fixture) WebhookRequest(action string) *webhook.Request {
+	repo, build := f.Repo, f.Build
+	return &webhook.Request{
+		Event:  webhook.EventBuild,
+		Action: action,
+		Repo:   &repo,
+		Build:  &build,
+		System: &drone.System{
+			Proto: "https",
+			Host:  "drone.company.com",
+			Link:  "https://drone.company.com/" + repo.Slug + "/" + strconv.FormatInt(build.Number, 10),
+		},
+	}
+}
+
+// AdmissionRequest returns an admission request for the user
+// and event, for example admission.EventLogin.
+func AdmissionRequest(user *UserBuilder, event string) *admission.Request {
+	return &admission.Request{
+		Event: event,
+		User:  user.User(),
+	}
+}
+
+// token returns a placeholder oauth token.
+func token() drone.Token {
+	return drone.Token{Access: "d7e4b1c2a0f3"}
+}
@@ -0,0 +1,201 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fixtures
+
+import (
+	"testing"
+
+	"github.com/drone/drone-go/drone"
+)
+
+func TestRepo(t *testing.T) {
+	repo := NewRepo("gitlab-org/subgroup/project").Host("gitlab.com").Private().Trusted().Repo()
+	if got, want := repo.Namespace, "gitlab-org/subgroup"; got != want {
+		t.Errorf("Want namespace %s, got %s", want, got)
+	}
+	if got, want := repo.Name, "project"; got != want {
+		t.Errorf("Want name %s, got %s", want, got)
+	}
+	if got, want := repo.Slug, "gitlab-org/subgroup/project"; got != want {
+		t.Errorf("Want slug %s, got %s", want, got)
+	}
+	if got, want := repo.HTTPURL, "https://gitlab.com/gitlab-org/subgroup/project.git"; got != want {
+		t.Errorf("Want clone url %s, got %s", want, got)
+	}
+	if !repo.Private || repo.Visibility != "private" {
+		t.Errorf("Want private repository")
+	}
+	if !repo.Trusted {
+		t.Errorf("Want trusted repository")
+	}
+
+	repo = NewRepo("octocat/hello-world").Private().Public().Repo()
+	if repo.Private || repo.Visibility != "public" {
+		t.Errorf("Want public repository")
+	}
+}
+
+func TestBuild(t *testing.T) {
+	tests := []struct {
+		name   string
+		build  *BuildBuilder
+		event  string
+		action string
+		ref    string
+		source string
+		target string
+		fork   string
+		link   string
+	}{
+		{
+			name:   "push",
+			build:  NewBuild().Push("develop"),
+			event:  drone.EventPush,
+			ref:    "refs/heads/develop",
+			source: "develop",
+			target: "develop",
+			fork:   "octocat/hello-world",
+			link:   "https://github.com/octocat/hello-world/commit/7fd1a60b01f91b314f59955a4e4d4e80d8edf11d",
+		},
+		{
+			name:   "pull request",
+			build:  NewBuild().Number(7).PullRequestNumber(42).PullRequest("feature", "master"),
+			event:  drone.EventPullRequest,
+			action: drone.ActionOpened,
+			ref:    "refs/pull/42/head",
+			source: "feature",
+			target: "master",
+			fork:   "octocat/hello-world",
+			link:   "https://github.com/octocat/hello-world/pull/42",
+		},
+		{
+			name:   "pull request from fork",
+			build:  NewBuild().Number(7).Fork("spaceghost/hello-world").PullRequest("feature", "master").Action(drone.ActionSynchronized),
+			event:  drone.EventPullRequest,
+			action: drone.ActionSynchronized,
+			ref:    "refs/pull/1/head",
+			source: "feature",
+			target: "master",
+			fork:   "spaceghost/hello-world",
+			link:   "https://github.com/octocat/hello-world/pull/1",
+		},
+		{
+			name:   "fork ignored for push",
+			build:  NewBuild().PullRequest("feature", "master").Fork("spaceghost/hello-world").Push("master"),
+			event:  drone.EventPush,
+			ref:    "refs/heads/master",
+			source: "master",
+			target: "master",
+			fork:   "octocat/hello-world",
+			link:   "https://github.com/octocat/hello-world/commit/7fd1a60b01f91b314f59955a4e4d4e80d8edf11d",
+		},
+		{
+			name:   "tag",
+			build:  NewBuild().Tag("v1.0.0"),
+			event:  drone.EventTag,
+			ref:    "refs/tags/v1.0.0",
+			source: "v1.0.0",
+			target: "v1.0.0",
+			fork:   "octocat/hello-world",
+			link:   "https://github.com/octocat/hello-world/releases/tag/v1.0.0",
+		},
+	}
+	for _, test := range tests {
+		f := New(nil, test.build)
+		build := f.Build
+		if got, want := build.Event, test.event; got != want {
+			t.Errorf("%s: want event %s, got %s", test.name, want, got)
+		}
+		if got, want := build.Action, test.action; got != want {
+			t.Errorf("%s: want action %q, got %q", test.name, want, got)
+		}
+		if got, want := build.Ref, test.ref; got != want {
+			t.Errorf("%s: want ref %s, got %s", test.name, want, got)
+		}
+		if got, want := build.Source, test.source; got != want {
+			t.Errorf("%s: want source %s, got %s", test.name, want, got)
+		}
+		if got, want := build.Target, test.target; got != want {
+			t.Errorf("%s: want target %s, got %s", test.name, want, got)
+		}
+		if got, want := build.Fork, test.fork; got != want {
+			t.Errorf("%s: want fork %s, got %s", test.name, want, got)
+		}
+		if got, want := build.Link, test.link; got != want {
+			t.Errorf("%s: want link %s, got %s", test.name, want, got)
+		}
+		if got, want := f.IsFork(), test.fork != "octocat/hello-world"; got != want {
+			t.Errorf("%s: want fork %v, got %v", test.name, want, got)
+		}
+	}
+}
+
+func TestBuild_Trigger(t *testing.T) {
+	tests := []struct {
+		build   *BuildBuilder
+		trigger string
+	}{
+		{NewBuild(), "@hook"},
+		{NewBuild().Cron("nightly"), "@cron"},
+		{NewBuild().Author("spaceghost", "Space Ghost", "spaceghost@example.com").Promote("production"), "spaceghost"},
+		{NewBuild().Custom().Trigger("admin"), "admin"},
+	}
+	for _, test := range tests {
+		if got, want := test.build.Build().Trigger, test.trigger; got != want {
+			t.Errorf("Want trigger %s, got %s", want, got)
+		}
+	}
+}
+
+func TestBuild_Promote(t *testing.T) {
+	build := NewBuild().Number(5).Branch("release").Promote("production").Build()
+	if got, want := build.Deploy, "production"; got != want {
+		t.Errorf("Want deploy target %s, got %s", want, got)
+	}
+	if got, want := build.Parent, int64(4); got != want {
+		t.Errorf("Want parent build %d, got %d", want, got)
+	}
+	if got, want := build.Ref, "refs/heads/release"; got != want {
+		t.Errorf("Want ref %s, got %s", want, got)
+	}
+}
+
+func TestFixture_Requests(t *testing.T) {
+	f := New(
+		NewRepo("octocat/hello-world").ID(7),
+		NewBuild().Number(3).Cron("nightly"),
+	)
+	req := f.SecretRequest("docker", "password")
+	if req.Path != "docker" || req.Name != "password" {
+		t.Errorf("Want secret path and name set")
+	}
+	if got, want := req.Build.RepoID, int64(7); got != want {
+		t.Errorf("Want build linked to repository %d, got %d", want, got)
+	}
+	if got, want := req.Repo.Counter, int64(3); got != want {
+		t.Errorf("Want repository counter %d, got %d", want, got)
+	}
+	if got, want := f.ConverterRequest("kind: pipeline").Config.Data, "kind: pipeline"; got != want {
+		t.Errorf("Want converter config %q, got %q", want, got)
+	}
+	hook := f.WebhookRequest("created")
+	hook.Build.Number = 10
+	if f.Build.Number != 3 {
+		t.Errorf("Want webhook request to copy the build")
+	}
+	if got, want := AdmissionRequest(NewUser("octocat").Admin(), "login").User.Admin, true; got != want {
+		t.Errorf("Want admin user")
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fixtures
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/drone/drone-go/drone"
+)
+
+// RepoBuilder builds a drone.Repo.
+type RepoBuilder struct {
+	id         int64
+	namespace  string
+	name       string
+	host       string
+	branch     string
+	config     string
+	visibility string
+	trusted    bool
+	protected  bool
+	timeout    int64
+}
+
+// NewRepo returns a RepoBuilder for a public repository with
+// the slug, in the format namespace/name, hosted on GitHub.
+func NewRepo(slug string) *RepoBuilder {
+	namespace, name := split(slug)
+	return &RepoBuilder{
+		id:         1,
+		namespace:  namespace,
+		name:       name,
+		host:       "github.com",
+		branch:     "master",
+		config:     ".drone.yml",
+		visibility: "public",
+		timeout:    60,
+	}
+}
+
+// ID sets the repository id.
+func (b *RepoBuilder) ID(id int64) *RepoBuilder {
+	b.id = id
+	return b
+}
+
+// Host sets the hostname used to generate the repository
+// links. The default host is github.com.
+func (b *RepoBuilder) Host(host string) *RepoBuilder {
+	b.host = host
+	return b
+}
+
+// Branch sets the default branch.
+func (b *RepoBuilder) Branch(branch string) *RepoBuilder {
+	b.branch = branch
+	return b
+}
+
+// Config sets the configuration file path.
+func (b *RepoBuilder) Config(path string) *RepoBuilder {
+	b.config = path
+	return b
+}
+
+// Public sets the repository visibility to public.
+func (b *RepoBuilder) Public() *RepoBuilder {
+	b.visibility = "public"
+	return b
+}
+
+// Private sets the repository visibility to private.
+func (b *RepoBuilder) Private() *RepoBuilder {
+	b.visibility = "private"
+	return b
+}
+
+// Internal sets the repository visibility to internal.
+func (b *RepoBuilder) Internal() *RepoBuilder {
+	b.visibility = "internal"
+	return b
+}
+
+// Trusted marks the repository as trusted.
+func (b *RepoBuilder) Trusted() *RepoBuilder {
+	b.trusted = true
+	return b
+}
+
+// Protected marks the repository as protected.
+func (b *RepoBuilder) Protected() *RepoBuilder {
+	b.protected = true
+	return b
+}
+
+// Timeout sets the build timeout in minutes.
+func (b *RepoBuilder) Timeout(minutes int64) *RepoBuilder {
+	b.timeout = minutes
+	return b
+}
+
+// Repo returns the repository. The slug, links and private
+// flag are derived from the namespace, name, host and
+// visibility.
+func (b *RepoBuilder) Repo() drone.Repo {
+	slug := b.slug()
+	link := "https://" + b.host + "/" + slug
+	return drone.Repo{
+		ID:         b.id,
+		UID:        strconv.FormatInt(b.id, 10),
+		UserID:     1,
+		Namespace:  b.namespace,
+		Name:       b.name,
+		Slug:       slug,
+		SCM:        "git",
+		HTTPURL:    link + ".git",
+		SSHURL:     "git@" + b.host + ":" + slug + ".git",
+		Link:       link,
+		Branch:     b.branch,
+		Private:    b.visibility != "public",
+		Visibility: b.visibility,
+		Active:     true,
+		Config:     b.config,
+		Trusted:    b.trusted,
+		Protected:  b.protected,
+		Timeout:    b.timeout,
+		Counter:    1,
+		Created:    timestamp,
+		Updated:    timestamp,
+		Version:    1,
+	}
+}
+
+func (b *RepoBuilder) slug() string {
+	if b.namespace == "" {
+		return b.name
+	}
+	return b.namespace + "/" + b.name
+}
+
+// split splits the slug into the namespace and name. The
+// namespace may contain slashes, for example for GitLab
+// subgroups.
+func split(slug string) (namespace, name string) {
+	if i := strings.LastIndex(slug, "/"); i != -1 {
+		return slug[:i], slug[i+1:]
+	}
+	return "", slug
+}
@@ -0,0 +1,84 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fixtures
+
+import "github.com/drone/drone-go/drone"
+
+// UserBuilder builds a drone.User.
+type UserBuilder struct {
+	id      int64
+	login   string
+	email   string
+	admin   bool
+	machine bool
+	active  bool
+}
+
+// NewUser returns a UserBuilder for an active user with the
+// login.
+func NewUser(login string) *UserBuilder {
+	return &UserBuilder{
+		id:     1,
+		login:  login,
+		email:  login + "@example.com",
+		active: true,
+	}
+}
+
+// ID sets the user id.
+func (b *UserBuilder) ID(id int64) *UserBuilder {
+	b.id = id
+	return b
+}
+
+// Email sets the user email.
+func (b *UserBuilder) Email(email string) *UserBuilder {
+	b.email = email
+	return b
+}
+
+// Admin marks the user as an administrator.
+func (b *UserBuilder) Admin() *UserBuilder {
+	b.admin = true
+	return b
+}
+
+// Machine marks the user as a machine account.
+func (b *UserBuilder) Machine() *UserBuilder {
+	b.machine = true
+	return b
+}
+
+// Inactive marks the user as inactive.
+func (b *UserBuilder) Inactive() *UserBuilder {
+	b.active = false
+	return b
+}
+
+// User returns the user.
+func (b *UserBuilder) User() drone.User {
+	return drone.User{
+		ID:        b.id,
+		Login:     b.login,
+		Email:     b.email,
+		Avatar:    avatar(b.login),
+		Active:    b.active,
+		Admin:     b.admin,
+		Machine:   b.machine,
+		Created:   timestamp,
+		Updated:   timestamp,
+		LastLogin: timestamp,
+	}
+}
@@ -29,6 +29,13 @@ var errInvalidKeyLength = errors.New("aesgcm: invalid key length")
 // Encrypt encrypts the plaintext with the provided key and
 // returns the raw, unencoded bytes.
 func Encrypt(plaintext []byte, key *[32]byte) (ciphertext []byte, err error) {
+	return EncryptWithData(plaintext, key, nil)
+}
+
+// EncryptWithData encrypts the plaintext with the provided key
+// and authenticates, but does not encrypt, the additional data.
+// The same additional data is required to decrypt.
+func EncryptWithData(plaintext []byte, key *[32]byte, data []byte) (ciphertext []byte, err error) {
 	block, err := aes.NewCipher(key[:])
 	if err != nil {
 		return nil, err
@@ -45,11 +52,17 @@ func Encrypt(plaintext []byte, key *[32]byte) (ciphertext []byte, err error) {
 		return nil, err
 	}
 
-	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+	return gcm.Seal(nonce, nonce, plaintext, data), nil
 }
 
 // Decrypt decrypts the raw, unencoded cihpertext with the provided key.
 func Decrypt(ciphertext []byte, key *[32]byte) (plaintext []byte, err error) {
+	return DecryptWithData(ciphertext, key, nil)
+}
+
+// DecryptWithData decrypts the raw, unencoded ciphertext with
+// the provided key and verifies the additional data.
+func DecryptWithData(ciphertext []byte, key *[32]byte, data []byte) (plaintext []byte, err error) {
 	block, err := aes.NewCipher(key[:])
 	if err != nil {
 		return nil, err
@@ -67,7 +80,7 @@ func Decrypt(ciphertext []byte, key *[32]byte) (plaintext []byte, err error) {
 	return gcm.Open(nil,
 		ciphertext[:gcm.NonceSize()],
 		ciphertext[gcm.NonceSize():],
-		nil,
+		data,
 	)
 }
 
@@ -50,3 +50,28 @@ func TestInvalidKey(t *testing.T) {
 		t.Errorf("Want Invalid Key Length error")
 	}
 }
+
+func TestEncryptDecrypt_Data(t *testing.T) {
+	key, err := Key("xVKAGlWQiY3sOp8JVc0nbuNId3PNCgWh")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	ciphertext, err := EncryptWithData([]byte("top-secret"), key, []byte("foo"))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err := DecryptWithData(ciphertext, key, []byte("bar")); err == nil {
+		t.Errorf("Want error when the additional data does not match")
+	}
+	plaintext, err := DecryptWithData(ciphertext, key, []byte("foo"))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if string(plaintext) != "top-secret" {
+		t.Errorf("Expect secret encrypted and decrypted")
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"sync"
+	"time"
+)
+
+// breaker is a circuit breaker for a single endpoint. The
+// circuit opens after a number of consecutive failures, and
+// after the cooldown a single trial request is allowed. The
+// circuit closes when the trial request succeeds.
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu       sync.Mutex
+	failures int
+	opened   time.Time
+}
+
+// allow returns true if a request may be sent to the endpoint.
+func (b *breaker) allow() bool {
+	if b == nil || b.threshold <= 0 {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < b.threshold {
+		return true
+	}
+	now := b.now()
+	if now.Sub(b.opened) < b.cooldown {
+		return false
+	}
+	// half-open: allow a single trial request and keep
+	// the circuit open for other requests until the trial
+	// request completes or the cooldown elapses again.
+	b.opened = now
+	return true
+}
+
+// success records a successful request.
+func (b *breaker) success() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	b.failures = 0
+	b.mu.Unlock()
+}
+
+// failure records a failed request.
+func (b *breaker) failure() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	b.failures++
+	if b.failures == b.threshold {
+		b.opened = b.now()
+	}
+	b.mu.Unlock()
+}
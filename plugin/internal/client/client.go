@@ -17,17 +17,26 @@ package client
 import (
 	"bytes"
 	"context"
+	"crypto"
+	"crypto/rand"
 	"crypto/sha256"
 	"crypto/tls"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"io"
 	"io/ioutil"
+	mathrand "math/rand"
 	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"sync/atomic"
 	"time"
 
 	"github.com/drone/drone-go/drone"
 	"github.com/drone/drone-go/plugin/internal/aesgcm"
+	"github.com/drone/drone-go/plugin/internal/httpsig"
+	"github.com/drone/drone-go/plugin/transport"
 
 	httpsignatures "github.com/99designs/httpsignatures-go"
 )
@@ -48,6 +57,7 @@ var headers = []string{
 	"content-type",
 	"date",
 	"digest",
+	"x-drone-nonce",
 }
 
 var signer = httpsignatures.NewSigner(
@@ -56,12 +66,31 @@ var signer = httpsignatures.NewSigner(
 )
 
 // New returns a new http.Client with signature verification.
-func New(endpoint, secret string, skipverify bool) *Client {
+func New(endpoint, secret string, skipverify bool, opts ...transport.Option) *Client {
+	config := transport.New(opts...)
 	client := &Client{
-		Accept:   "application/json",
-		Encoding: "identity",
-		Endpoint: endpoint,
-		Secret:   secret,
+		Accept:     config.Accept,
+		Encoding:   "identity",
+		Endpoint:   endpoint,
+		Endpoints:  config.Endpoints,
+		RoundRobin: config.RoundRobin,
+		KeyID:      config.KeyID,
+		Secret:     secret,
+		Signer:     config.PrivateKey,
+		Retries:    config.Retries,
+		MinBackoff: config.MinBackoff,
+		MaxBackoff: config.MaxBackoff,
+		breakers:   map[string]*breaker{},
+	}
+	if config.Encrypt {
+		client.Encoding = "aesgcm"
+	}
+	for _, endpoint := range client.endpoints() {
+		client.breakers[endpoint] = &breaker{
+			threshold: config.FailureThreshold,
+			cooldown:  config.Cooldown,
+			now:       time.Now,
+		}
 	}
 	if skipverify {
 		client.Client = &http.Client{
@@ -86,35 +115,113 @@ type Client struct {
 	Accept     string
 	Encoding   string
 	Endpoint   string
+	Endpoints  []string
+	RoundRobin bool
+	KeyID      string
 	Secret     string
+	Signer     crypto.Signer
 	SkipVerify bool
+	Retries    int
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// Idempotent indicates the plugin does not modify state,
+	// and requests that may have reached the plugin can be
+	// safely retried.
+	Idempotent bool
+
+	breakers map[string]*breaker
+	counter  uint32
 }
 
 // Do makes an http.Request to the target endpoint using the context provided.
+// The request is retried with exponential backoff after a connection error that
+// occurred before the request was sent, failing over to the next endpoint if the
+// client has multiple endpoints. If the client is idempotent, the request is also
+// retried after any connection error or a 502, 503 or 504 response.
 func (s *Client) Do(ctx context.Context, in, out interface{}) error {
 	data, err := json.Marshal(in)
 	if err != nil {
 		return err
 	}
 
+	endpoints := s.endpoints()
+	var start int
+	if s.RoundRobin {
+		start = int(atomic.AddUint32(&s.counter, 1)-1) % len(endpoints)
+	}
+
+	for attempt := 0; ; attempt++ {
+		endpoint, breaker := s.pick(endpoints, start+attempt)
+		if endpoint == "" {
+			if err == nil {
+				err = transport.ErrCircuitOpen
+			}
+			return err
+		}
+
+		var sent bool
+		sent, err = s.do(ctx, endpoint, data, out)
+		if ctx.Err() != nil {
+			return err
+		}
+		if !failed(err) {
+			breaker.success()
+			return err
+		}
+		breaker.failure()
+
+		// a request that may have reached the plugin is only
+		// retried if the plugin does not modify state.
+		if sent && !s.Idempotent {
+			return err
+		}
+		if attempt >= s.Retries {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(s.backoff(attempt)):
+		}
+	}
+}
+
+// do makes a single http.Request to the endpoint. It reports
+// whether the request was written to the connection, in which
+// case the plugin may have received it.
+func (s *Client) do(ctx context.Context, endpoint string, data []byte, out interface{}) (bool, error) {
 	buf := bytes.NewBuffer(data)
-	req, err := http.NewRequest("POST", s.Endpoint, buf)
+	req, err := http.NewRequest("POST", endpoint, buf)
 	if err != nil {
-		return err
+		return false, err
+	}
+
+	// the request is considered sent once the transport
+	// attempts to write it, even if the write fails.
+	var wrote int32
+	trace := &httptrace.ClientTrace{
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			atomic.StoreInt32(&wrote, 1)
+		},
 	}
+	req = req.WithContext(httptrace.WithClientTrace(ctx, trace))
 
-	req = req.WithContext(ctx)
-	req.Header.Add("Accept", s.Accept)
+	req.Header.Add("Accept", s.accept())
 	req.Header.Add("Accept-Encoding", s.Encoding)
 	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("Digest", "SHA-256="+digest(data))
-	req.Header.Add("Date", time.Now().UTC().Format(http.TimeFormat))
-	err = signer.SignRequest("hmac-key", s.Secret, req)
+	if s.Signer != nil {
+		SetHeaders(req, data)
+		err = httpsig.Sign(req, s.keyID(), s.Signer, headers)
+	} else {
+		err = Sign(req, s.keyID(), s.Secret, data)
+	}
 	if err != nil {
-		return err
+		return false, err
 	}
 
 	res, err := s.client().Do(req)
+	sent := atomic.LoadInt32(&wrote) == 1
 	if res != nil && res.Body != nil {
 		defer func() {
 			// drain the response body so we can reuse this connection.
@@ -123,31 +230,53 @@ func (s *Client) Do(ctx context.Context, in, out interface{}) error {
 		}()
 	}
 	if err != nil {
-		return err
+		return sent, err
 	}
 
 	body, err := ioutil.ReadAll(res.Body)
 	if err != nil {
-		return err
+		return true, err
 	}
 
-	if res.StatusCode > 299 {
-		err := new(drone.Error)
-		err.Code = res.StatusCode
-		err.Message = string(body)
+	return true, Decode(res, body, s.Secret, out)
+}
 
-		// if the response body is empty we should return
-		// the default status code text.
-		if len(body) == 0 {
-			err.Message = http.StatusText(res.StatusCode)
-		}
-		return err
+// Sign sets the Digest, Date and X-Drone-Nonce headers, if not
+// already set, and signs the request with the shared secret.
+// The data is the request body.
+func Sign(req *http.Request, keyID, secret string, data []byte) error {
+	SetHeaders(req, data)
+	return signer.SignRequest(keyID, secret, req)
+}
+
+// SetHeaders sets the Digest, Date and X-Drone-Nonce headers,
+// if not already set. The data is the request body.
+func SetHeaders(req *http.Request, data []byte) {
+	if req.Header.Get("Digest") == "" {
+		req.Header.Set("Digest", "SHA-256="+digest(data))
+	}
+	if req.Header.Get("Date") == "" {
+		req.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	}
+	if req.Header.Get("X-Drone-Nonce") == "" {
+		req.Header.Set("X-Drone-Nonce", nonce())
+	}
+}
+
+// Decode decodes the response body into out. If the response
+// status code is 4xx or 5xx, the decoded *drone.Error is
+// returned. If the response is 204 No Content or out is nil,
+// the body is not decoded. If the body is aesgcm encrypted, it
+// is decrypted using the shared secret.
+func Decode(res *http.Response, body []byte, secret string, out interface{}) error {
+	if res.StatusCode > 299 {
+		return DecodeError(res.StatusCode, body)
 	}
 
 	// if the response body return no content we exit
 	// immediately. We do not read or unmarshal the response
 	// and we do not return an error.
-	if res.StatusCode == http.StatusNoContent {
+	if res.StatusCode == http.StatusNoContent || out == nil {
 		return nil
 	}
 
@@ -155,21 +284,95 @@ func (s *Client) Do(ctx context.Context, in, out interface{}) error {
 	// using the aesgcm algorithm. If encrypted,
 	// decrypt using the shared secret.
 	if res.Header.Get("Content-Encoding") == "aesgcm" {
-		secret, err := aesgcm.Key(s.Secret)
+		key, err := aesgcm.Key(secret)
 		if err != nil {
 			return err
 		}
-		plaintext, err := aesgcm.Decrypt(body, secret)
+		plaintext, err := aesgcm.Decrypt(body, key)
 		if err != nil {
 			return err
 		}
 		body = plaintext
 	}
+	return json.Unmarshal(body, out)
+}
 
-	if out == nil {
-		return nil
+// endpoints returns the list of endpoints.
+func (s *Client) endpoints() []string {
+	return append([]string{s.Endpoint}, s.Endpoints...)
+}
+
+// pick returns the first endpoint, starting at the offset,
+// that is allowed by its circuit breaker. It returns an empty
+// string if the circuit is open for all endpoints.
+func (s *Client) pick(endpoints []string, offset int) (string, *breaker) {
+	for i := range endpoints {
+		endpoint := endpoints[(offset+i)%len(endpoints)]
+		breaker := s.breakers[endpoint]
+		if breaker.allow() {
+			return endpoint, breaker
+		}
 	}
-	return json.Unmarshal(body, out)
+	return "", nil
+}
+
+// backoff returns the duration to wait before the next retry,
+// using exponential backoff with jitter.
+func (s *Client) backoff(attempt int) time.Duration {
+	min, max := s.MinBackoff, s.MaxBackoff
+	if min <= 0 {
+		min = transport.DefaultMinBackoff
+	}
+	if max < min {
+		max = min
+	}
+	d := min << uint(attempt)
+	if d > max || d <= 0 {
+		d = max
+	}
+	// apply up to 50% jitter so that clients retrying at the
+	// same time do not overwhelm a recovering endpoint.
+	return d/2 + time.Duration(mathrand.Int63n(int64(d/2)+1))
+}
+
+// failed returns true if the request failed with a
+// connection error or a 502, 503 or 504 response.
+func failed(err error) bool {
+	if err == nil {
+		return false
+	}
+	if xerr, ok := err.(*drone.Error); ok {
+		switch xerr.Code {
+		case http.StatusBadGateway,
+			http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout:
+			return true
+		default:
+			return false
+		}
+	}
+	var uerr *url.Error
+	return errors.As(err, &uerr)
+}
+
+// DecodeError decodes the json-encoded error envelope from the
+// response body. If the body is not a json-encoded error, for
+// example, if the plugin was built with an older version of
+// this library, the raw body is used as the error message.
+func DecodeError(code int, body []byte) error {
+	err := new(drone.Error)
+	if json.Unmarshal(body, err) != nil || err.Message == "" {
+		err = new(drone.Error)
+		err.Message = string(body)
+	}
+	err.Code = code
+
+	// if the response body is empty we should return
+	// the default status code text.
+	if err.Message == "" {
+		err.Message = http.StatusText(code)
+	}
+	return err
 }
 
 func (s *Client) client() *http.Client {
@@ -179,6 +382,29 @@ func (s *Client) client() *http.Client {
 	return s.Client
 }
 
+// accept returns the media type requested by the client.
+func (s *Client) accept() string {
+	if s.Accept == "" {
+		return "application/json"
+	}
+	return s.Accept
+}
+
+func (s *Client) keyID() string {
+	if s.KeyID == "" {
+		return transport.DefaultKeyID
+	}
+	return s.KeyID
+}
+
+// nonce returns a random request identifier used by the
+// plugin to detect replayed requests.
+func nonce() string {
+	b := make([]byte, 16)
+	_, _ = io.ReadFull(rand.Reader, b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
 func digest(data []byte) string {
 	h := sha256.New()
 	h.Write(data)
@@ -0,0 +1,316 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/drone-go/plugin/transport"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDo_Error(t *testing.T) {
+	tests := []struct {
+		code int
+		body string
+		want *drone.Error
+	}{
+		{
+			code: 503,
+			body: `{"code":503,"message":"vault sealed","retryable":true,"details":{"backend":"vault"}}`,
+			want: &drone.Error{Code: 503, Message: "vault sealed", Retryable: true, Details: &drone.ErrorDetails{"backend": "vault"}},
+		},
+		// plugins built with older versions of this library
+		// return a plain text error message.
+		{
+			code: 404,
+			body: "secret not found\n",
+			want: &drone.Error{Code: 404, Message: "secret not found\n"},
+		},
+		{
+			code: 500,
+			body: "",
+			want: &drone.Error{Code: 500, Message: "Internal Server Error"},
+		},
+	}
+	for _, test := range tests {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(test.code)
+			w.Write([]byte(test.body))
+		}))
+		err := New(server.URL, "xVKAGlWQiY3sOp8JVc0nbuNId3PNCgWh", false, transport.WithRetries(-1)).Do(context.Background(), struct{}{}, nil)
+		server.Close()
+
+		got, ok := err.(*drone.Error)
+		if !ok {
+			t.Errorf("Want *drone.Error, got %T", err)
+			continue
+		}
+		if diff := cmp.Diff(got, test.want); diff != "" {
+			t.Errorf("Unexpected error for status code %d", test.code)
+			t.Log(diff)
+		}
+	}
+}
+
+func TestDo_Retry(t *testing.T) {
+	var count int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&count, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	client := New(server.URL, "xVKAGlWQiY3sOp8JVc0nbuNId3PNCgWh", false,
+		transport.WithRetries(2),
+		transport.WithBackoff(time.Millisecond, time.Millisecond),
+	)
+	client.Idempotent = true
+	if err := client.Do(context.Background(), struct{}{}, nil); err != nil {
+		t.Errorf("Want request to succeed after retries, got %s", err)
+	}
+	if got, want := atomic.LoadInt32(&count), int32(3); got != want {
+		t.Errorf("Want %d attempts, got %d", want, got)
+	}
+}
+
+func TestDo_RetryDefault(t *testing.T) {
+	var count int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client := New(server.URL, "xVKAGlWQiY3sOp8JVc0nbuNId3PNCgWh", false)
+	client.Idempotent = true
+	if err := client.Do(context.Background(), struct{}{}, nil); err == nil {
+		t.Errorf("Want error")
+	}
+	if got, want := atomic.LoadInt32(&count), int32(1); got != want {
+		t.Errorf("Want requests not retried by default, got %d attempts", got)
+	}
+}
+
+func TestDo_RetryNotIdempotent(t *testing.T) {
+	var count int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client := New(server.URL, "xVKAGlWQiY3sOp8JVc0nbuNId3PNCgWh", false,
+		transport.WithRetries(2),
+		transport.WithBackoff(time.Millisecond, time.Millisecond),
+	)
+	if err := client.Do(context.Background(), struct{}{}, nil); err == nil {
+		t.Errorf("Want error")
+	}
+	if got, want := atomic.LoadInt32(&count), int32(1); got != want {
+		t.Errorf("Want %d attempts, got %d", want, got)
+	}
+}
+
+func TestDo_RetryAfterSent(t *testing.T) {
+	var count int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+		// close the connection after the request is received
+		// and before a response is written.
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err == nil {
+			conn.Close()
+		}
+	}))
+	defer server.Close()
+
+	client := New(server.URL, "xVKAGlWQiY3sOp8JVc0nbuNId3PNCgWh", false,
+		transport.WithRetries(2),
+		transport.WithBackoff(time.Millisecond, time.Millisecond),
+	)
+	if err := client.Do(context.Background(), struct{}{}, nil); err == nil {
+		t.Errorf("Want error")
+	}
+	if got, want := atomic.LoadInt32(&count), int32(1); got != want {
+		t.Errorf("Want sent request not retried, got %d attempts", got)
+	}
+
+	atomic.StoreInt32(&count, 0)
+	client.Idempotent = true
+	client.Do(context.Background(), struct{}{}, nil)
+	if got, want := atomic.LoadInt32(&count), int32(3); got != want {
+		t.Errorf("Want idempotent request retried, got %d attempts", got)
+	}
+}
+
+func TestDo_NoRetry(t *testing.T) {
+	var count int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	client := New(server.URL, "xVKAGlWQiY3sOp8JVc0nbuNId3PNCgWh", false,
+		transport.WithRetries(2),
+		transport.WithBackoff(time.Millisecond, time.Millisecond),
+	)
+	if err := client.Do(context.Background(), struct{}{}, nil); err == nil {
+		t.Errorf("Want error")
+	}
+	if got, want := atomic.LoadInt32(&count), int32(1); got != want {
+		t.Errorf("Want %d attempts, got %d", want, got)
+	}
+}
+
+func TestDo_Failover(t *testing.T) {
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer up.Close()
+
+	client := New(down.URL, "xVKAGlWQiY3sOp8JVc0nbuNId3PNCgWh", false,
+		transport.WithEndpoints(up.URL),
+		transport.WithRetries(2),
+		transport.WithBackoff(time.Millisecond, time.Millisecond),
+	)
+	if err := client.Do(context.Background(), struct{}{}, nil); err != nil {
+		t.Errorf("Want request to fail over to the healthy endpoint, got %s", err)
+	}
+}
+
+func TestDo_RoundRobin(t *testing.T) {
+	var a, b int32
+	serverA := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&a, 1)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer serverA.Close()
+	serverB := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&b, 1)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer serverB.Close()
+
+	client := New(serverA.URL, "xVKAGlWQiY3sOp8JVc0nbuNId3PNCgWh", false,
+		transport.WithEndpoints(serverB.URL),
+		transport.WithRoundRobin(),
+	)
+	for i := 0; i < 4; i++ {
+		if err := client.Do(context.Background(), struct{}{}, nil); err != nil {
+			t.Error(err)
+		}
+	}
+	if a != 2 || b != 2 {
+		t.Errorf("Want requests distributed across endpoints, got %d and %d", a, b)
+	}
+}
+
+func TestDo_CircuitBreaker(t *testing.T) {
+	var count int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	client := New(server.URL, "xVKAGlWQiY3sOp8JVc0nbuNId3PNCgWh", false,
+		transport.WithRetries(-1),
+		transport.WithCircuitBreaker(2, time.Minute),
+	)
+	now := time.Now()
+	client.breakers[server.URL].now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		client.Do(context.Background(), struct{}{}, nil)
+	}
+	if got, want := atomic.LoadInt32(&count), int32(2); got != want {
+		t.Errorf("Want %d attempts before the circuit opens, got %d", want, got)
+	}
+	if err := client.Do(context.Background(), struct{}{}, nil); err != transport.ErrCircuitOpen {
+		t.Errorf("Want ErrCircuitOpen, got %v", err)
+	}
+
+	// after the cooldown a single trial request is allowed.
+	now = now.Add(2 * time.Minute)
+	client.Do(context.Background(), struct{}{}, nil)
+	client.Do(context.Background(), struct{}{}, nil)
+	if got, want := atomic.LoadInt32(&count), int32(3); got != want {
+		t.Errorf("Want a single trial request after the cooldown, got %d attempts", got)
+	}
+}
+
+func TestDo_Canceled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	client := New(server.URL, "xVKAGlWQiY3sOp8JVc0nbuNId3PNCgWh", false,
+		transport.WithBackoff(time.Hour, time.Hour),
+	)
+	done := make(chan error)
+	go func() { done <- client.Do(ctx, struct{}{}, nil) }()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Errorf("Want error for canceled context")
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("Want retries to stop when the context is canceled")
+	}
+}
+
+func TestDo_AcceptEncryption(t *testing.T) {
+	var accept, encoding string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accept = r.Header.Get("Accept")
+		encoding = r.Header.Get("Accept-Encoding")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	client := New(server.URL, "xVKAGlWQiY3sOp8JVc0nbuNId3PNCgWh", false,
+		transport.WithAccept("application/vnd.drone.env.v1+json"),
+		transport.WithEncryption(),
+	)
+	if err := client.Do(context.Background(), struct{}{}, nil); err != nil {
+		t.Error(err)
+		return
+	}
+	if got, want := accept, "application/vnd.drone.env.v1+json"; got != want {
+		t.Errorf("Want Accept %s, got %s", want, got)
+	}
+	if got, want := encoding, "aesgcm"; got != want {
+		t.Errorf("Want Accept-Encoding %s, got %s", want, got)
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package command runs the helper commands used by the exec
+// plugins.
+package command
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/drone/drone-go/plugin"
+)
+
+// DefaultTimeout is the default command timeout.
+const DefaultTimeout = 10 * time.Second
+
+// maxOutput is the maximum size of the command output.
+const maxOutput = 1 << 20
+
+// Command is a helper command.
+type Command struct {
+	// Path is the name or path of the command.
+	Path string
+
+	// Args are the command arguments.
+	Args []string
+
+	// Env is the environment allowlist. An entry in the form
+	// NAME passes the variable from the environment of the
+	// current process, and an entry in the form NAME=value
+	// sets the variable. Other variables are not passed to
+	// the command, so the allowlist should include PATH if
+	// the command depends on it.
+	Env []string
+
+	// Timeout is the maximum command duration. If zero, the
+	// DefaultTimeout is used.
+	Timeout time.Duration
+}
+
+// Run runs the command with the input on stdin and returns the
+// output written to stdout. If the command times out or exits
+// with a non-zero status, the returned error wraps
+// plugin.ErrUnavailable.
+func (c *Command) Run(ctx context.Context, stdin []byte) ([]byte, error) {
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	stdout := &limitedBuffer{max: maxOutput}
+	stderr := &limitedBuffer{max: maxOutput}
+	cmd := exec.CommandContext(ctx, c.Path, c.Args...)
+	cmd.Env = c.environ()
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	err := cmd.Run()
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		return nil, fmt.Errorf("exec: %s: timeout after %s: %w", c.Path, timeout, plugin.ErrUnavailable)
+	case ctx.Err() != nil:
+		return nil, ctx.Err()
+	case err != nil:
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return stdout.Bytes(), fmt.Errorf("exec: %s: %s: %s: %w", c.Path, err, msg, plugin.ErrUnavailable)
+		}
+		return stdout.Bytes(), fmt.Errorf("exec: %s: %s: %w", c.Path, err, plugin.ErrUnavailable)
+	case stdout.overflow:
+		return nil, fmt.Errorf("exec: %s: output exceeds %d bytes", c.Path, maxOutput)
+	}
+	return stdout.Bytes(), nil
+}
+
+// environ returns the command environment.
+func (c *Command) environ() []string {
+	env := []string{}
+	for _, name := range c.Env {
+		if strings.Contains(name, "=") {
+			env = append(env, name)
+		} else if value, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+value)
+		}
+	}
+	return env
+}
+
+// limitedBuffer is a buffer that discards writes that exceed
+// the maximum size.
+type limitedBuffer struct {
+	bytes.Buffer
+	max      int
+	overflow bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if n := b.max - b.Len(); len(p) > n {
+		b.overflow = true
+		b.Buffer.Write(p[:n])
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
@@ -0,0 +1,266 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package httpsig parses http signatures, and signs and verifies
+// requests using the ed25519 and rsa-sha256 algorithms. Requests
+// are signed using the hmac-sha256 algorithm by the httpsignatures
+// package, and verified by this package, so that the signature
+// header is parsed once for all algorithms.
+package httpsig
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// Signature algorithms.
+const (
+	AlgorithmEd25519    = "ed25519"
+	AlgorithmRsaSha256  = "rsa-sha256"
+	AlgorithmHmacSha256 = "hmac-sha256"
+)
+
+var (
+	errMissingSignature = errors.New("httpsig: missing signature")
+	errUnknownAlgorithm = errors.New("httpsig: unknown algorithm")
+	errInvalidSignature = errors.New("httpsig: invalid signature")
+	errInvalidKey       = errors.New("httpsig: unsupported key type")
+	errInvalidPEM       = errors.New("httpsig: invalid pem block")
+)
+
+var signatureRegex = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// Signature is a parsed http signature.
+type Signature struct {
+	KeyID     string
+	Algorithm string
+	Headers   []string
+	Signature string
+}
+
+// String returns the encoded form of the Signature.
+func (s *Signature) String() string {
+	return fmt.Sprintf(`keyId="%s",algorithm="%s",signature="%s",headers="%s"`,
+		s.KeyID,
+		s.Algorithm,
+		s.Signature,
+		strings.Join(s.Headers, " "),
+	)
+}
+
+// FromRequest parses the http signature from the Signature or
+// Authorization header.
+func FromRequest(r *http.Request) (*Signature, error) {
+	if s := r.Header.Get("Signature"); s != "" {
+		return Parse(s)
+	}
+	if s := r.Header.Get("Authorization"); s != "" {
+		return Parse(strings.TrimPrefix(s, "Signature "))
+	}
+	return nil, errMissingSignature
+}
+
+// Parse parses the encoded http signature.
+func Parse(s string) (*Signature, error) {
+	sig := new(Signature)
+	for _, m := range signatureRegex.FindAllStringSubmatch(s, -1) {
+		switch m[1] {
+		case "keyId":
+			sig.KeyID = m[2]
+		case "algorithm":
+			sig.Algorithm = m[2]
+		case "headers":
+			sig.Headers = strings.Split(strings.ToLower(m[2]), " ")
+		case "signature":
+			sig.Signature = m[2]
+		}
+	}
+	if sig.KeyID == "" || sig.Algorithm == "" || sig.Signature == "" {
+		return nil, errMissingSignature
+	}
+	return sig, nil
+}
+
+// Sign signs the request headers with the private key and
+// adds the Signature header to the request. The algorithm is
+// selected based on the key type.
+func Sign(r *http.Request, keyID string, key crypto.Signer, headers []string) error {
+	algorithm, err := algorithmFor(key.Public())
+	if err != nil {
+		return err
+	}
+	data, err := signingString(r, headers)
+	if err != nil {
+		return err
+	}
+	var raw []byte
+	switch algorithm {
+	case AlgorithmEd25519:
+		raw, err = key.Sign(rand.Reader, []byte(data), crypto.Hash(0))
+	case AlgorithmRsaSha256:
+		sum := sha256.Sum256([]byte(data))
+		raw, err = key.Sign(rand.Reader, sum[:], crypto.SHA256)
+	}
+	if err != nil {
+		return err
+	}
+	sig := &Signature{
+		KeyID:     keyID,
+		Algorithm: algorithm,
+		Headers:   headers,
+		Signature: base64.StdEncoding.EncodeToString(raw),
+	}
+	r.Header.Set("Signature", sig.String())
+	return nil
+}
+
+// Verify verifies the signature of the request using the
+// public key. The signature algorithm must match the key type.
+func (s *Signature) Verify(r *http.Request, key crypto.PublicKey) error {
+	algorithm, err := algorithmFor(key)
+	if err != nil {
+		return err
+	}
+	if algorithm != s.Algorithm {
+		return errUnknownAlgorithm
+	}
+	raw, err := base64.StdEncoding.DecodeString(s.Signature)
+	if err != nil {
+		return errInvalidSignature
+	}
+	data, err := signingString(r, s.Headers)
+	if err != nil {
+		return err
+	}
+	switch key := key.(type) {
+	case ed25519.PublicKey:
+		if !ed25519.Verify(key, []byte(data), raw) {
+			return errInvalidSignature
+		}
+	case *rsa.PublicKey:
+		sum := sha256.Sum256([]byte(data))
+		if rsa.VerifyPKCS1v15(key, crypto.SHA256, sum[:], raw) != nil {
+			return errInvalidSignature
+		}
+	}
+	return nil
+}
+
+// VerifySecret verifies the hmac-sha256 signature of the
+// request using the shared secret.
+func (s *Signature) VerifySecret(r *http.Request, secret string) error {
+	if s.Algorithm != AlgorithmHmacSha256 {
+		return errUnknownAlgorithm
+	}
+	data, err := signingString(r, s.Headers)
+	if err != nil {
+		return err
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(data))
+	want := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	if subtle.ConstantTimeCompare([]byte(s.Signature), []byte(want)) != 1 {
+		return errInvalidSignature
+	}
+	return nil
+}
+
+// ParsePrivateKey parses a PEM encoded ed25519 or rsa private
+// key in PKCS8 or PKCS1 form.
+func ParsePrivateKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errInvalidPEM
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errInvalidKey
+	}
+	if _, err := algorithmFor(signer.Public()); err != nil {
+		return nil, err
+	}
+	return signer, nil
+}
+
+// ParsePublicKey parses a PEM encoded ed25519 or rsa public
+// key in PKIX or PKCS1 form.
+func ParsePublicKey(data []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errInvalidPEM
+	}
+	if key, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := algorithmFor(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// algorithmFor returns the signature algorithm for the public
+// key type.
+func algorithmFor(key crypto.PublicKey) (string, error) {
+	switch key.(type) {
+	case ed25519.PublicKey:
+		return AlgorithmEd25519, nil
+	case *rsa.PublicKey:
+		return AlgorithmRsaSha256, nil
+	default:
+		return "", errInvalidKey
+	}
+}
+
+// signingString returns the string to sign for the request
+// headers, as defined by the http signatures specification.
+func signingString(r *http.Request, headers []string) (string, error) {
+	lines := make([]string, 0, len(headers))
+	for _, header := range headers {
+		if header == "(request-target)" {
+			lines = append(lines, fmt.Sprintf("%s: %s %s",
+				header, strings.ToLower(r.Method), r.URL.RequestURI()))
+			continue
+		}
+		value := r.Header.Get(header)
+		if value == "" {
+			return "", fmt.Errorf("httpsig: missing required header %q", header)
+		}
+		lines = append(lines, header+": "+value)
+	}
+	return strings.Join(lines, "\n"), nil
+}
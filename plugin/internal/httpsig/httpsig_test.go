@@ -0,0 +1,150 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsig
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/99designs/httpsignatures-go"
+)
+
+var headers = []string{"date", "digest"}
+
+func TestSignVerify(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		key       crypto.Signer
+		algorithm string
+	}{
+		{edKey, AlgorithmEd25519},
+		{rsaKey, AlgorithmRsaSha256},
+	} {
+		req := newRequest()
+		if err := Sign(req, "drone", test.key, headers); err != nil {
+			t.Error(err)
+			continue
+		}
+		sig, err := FromRequest(req)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if got, want := sig.Algorithm, test.algorithm; got != want {
+			t.Errorf("Want algorithm %s, got %s", want, got)
+		}
+		if got, want := sig.KeyID, "drone"; got != want {
+			t.Errorf("Want keyId %s, got %s", want, got)
+		}
+		if err := sig.Verify(req, test.key.Public()); err != nil {
+			t.Errorf("Want valid %s signature, got %s", test.algorithm, err)
+		}
+
+		req.Header.Set("Digest", "SHA-256=tampered")
+		if err := sig.Verify(req, test.key.Public()); err == nil {
+			t.Errorf("Want invalid %s signature for tampered request", test.algorithm)
+		}
+	}
+}
+
+func TestVerify_AlgorithmMismatch(t *testing.T) {
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	req := newRequest()
+	if err := Sign(req, "drone", edKey, headers); err != nil {
+		t.Fatal(err)
+	}
+	sig, _ := FromRequest(req)
+	if err := sig.Verify(req, rsaKey.Public()); err == nil {
+		t.Errorf("Want error verifying ed25519 signature with rsa key")
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	edPub, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	pkcs8, _ := x509.MarshalPKCS8PrivateKey(edKey)
+	pkix, _ := x509.MarshalPKIXPublicKey(edPub)
+	if _, err := ParsePrivateKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8})); err != nil {
+		t.Errorf("Want ed25519 private key parsed, got %s", err)
+	}
+	if _, err := ParsePublicKey(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pkix})); err != nil {
+		t.Errorf("Want ed25519 public key parsed, got %s", err)
+	}
+
+	pkcs1 := x509.MarshalPKCS1PrivateKey(rsaKey)
+	pkcs1pub := x509.MarshalPKCS1PublicKey(&rsaKey.PublicKey)
+	if _, err := ParsePrivateKey(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: pkcs1})); err != nil {
+		t.Errorf("Want rsa private key parsed, got %s", err)
+	}
+	if _, err := ParsePublicKey(pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: pkcs1pub})); err != nil {
+		t.Errorf("Want rsa public key parsed, got %s", err)
+	}
+
+	if _, err := ParsePublicKey([]byte("not a pem block")); err == nil {
+		t.Errorf("Want error parsing invalid pem block")
+	}
+}
+
+func newRequest() *http.Request {
+	req := httptest.NewRequest("POST", "/", nil)
+	req.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	req.Header.Set("Digest", "SHA-256=RBNvo1WzZ4oRRq0W9+hknpT7T8If536DEMBg9hyq/4o=")
+	return req
+}
+
+func TestVerifySecret(t *testing.T) {
+	req := newRequest()
+	signer := httpsignatures.NewSigner(httpsignatures.AlgorithmHmacSha256, headers...)
+	if err := signer.SignRequest("hmac-key", "correct-horse-battery-staple", req); err != nil {
+		t.Fatal(err)
+	}
+	sig, err := FromRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := sig.Algorithm, AlgorithmHmacSha256; got != want {
+		t.Errorf("Want algorithm %s, got %s", want, got)
+	}
+	if err := sig.VerifySecret(req, "correct-horse-battery-staple"); err != nil {
+		t.Errorf("Want valid hmac-sha256 signature, got %s", err)
+	}
+	if err := sig.VerifySecret(req, "incorrect-horse-battery-staple"); err == nil {
+		t.Errorf("Want invalid signature for the wrong secret")
+	}
+
+	req.Header.Set("Digest", "SHA-256=tampered")
+	if err := sig.VerifySecret(req, "correct-horse-battery-staple"); err == nil {
+		t.Errorf("Want invalid signature for tampered request")
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package testutil provides helpers for the plugin handler tests.
+package testutil
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/drone/drone-go/plugin/internal/client"
+
+	"github.com/99designs/httpsignatures-go"
+)
+
+// signer signs only the Date and Digest headers, which are the
+// headers required by the verifier.
+var signer = httpsignatures.NewSigner(
+	httpsignatures.AlgorithmHmacSha256,
+	"date",
+	"digest",
+)
+
+// Sign adds the Date, Digest and X-Drone-Nonce headers to the
+// request, if not already set, and signs the request with the
+// shared secret.
+func Sign(req *http.Request, secret string) error {
+	return SignKey(req, "hmac-key", secret)
+}
+
+// SignKey adds the Date, Digest and X-Drone-Nonce headers to
+// the request, if not already set, and signs the request with
+// the named key.
+func SignKey(req *http.Request, id, secret string) error {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		if err != nil {
+			return err
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	client.SetHeaders(req, body)
+	return signer.AuthRequest(id, secret, req)
+}
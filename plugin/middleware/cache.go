@@ -0,0 +1,66 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"sync"
+	"time"
+)
+
+// ReplayCache records request identifiers to detect replayed
+// requests.
+type ReplayCache interface {
+	// Seen records the key until the expiration time and
+	// returns true if the key was already recorded and has
+	// not yet expired.
+	Seen(key string, expires time.Time) bool
+}
+
+// NewReplayCache returns an in-memory ReplayCache. Expired
+// entries are removed as new entries are recorded.
+func NewReplayCache() ReplayCache {
+	return &memoryCache{
+		entries: map[string]time.Time{},
+		now:     time.Now,
+	}
+}
+
+type memoryCache struct {
+	sync.Mutex
+	entries map[string]time.Time
+	now     func() time.Time
+	next    time.Time
+}
+
+func (c *memoryCache) Seen(key string, expires time.Time) bool {
+	c.Lock()
+	defer c.Unlock()
+
+	now := c.now()
+	if now.After(c.next) {
+		for k, exp := range c.entries {
+			if now.After(exp) {
+				delete(c.entries, k)
+			}
+		}
+		c.next = now.Add(time.Minute)
+	}
+
+	if exp, ok := c.entries[key]; ok && !now.After(exp) {
+		return true
+	}
+	c.entries[key] = expires
+	return false
+}
@@ -0,0 +1,73 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/drone/drone-go/drone"
+)
+
+// ErrInvalidInput is returned when the request body cannot be
+// decoded.
+var ErrInvalidInput = &drone.Error{Code: http.StatusBadRequest, Message: "Invalid Input"}
+
+// WriteError writes the JSON-encoded error envelope to the
+// response. If the error is, or wraps, a *drone.Error, the
+// status code, retryable flag and details of the *drone.Error
+// are used. Otherwise the error is written with the default
+// status code. An error caused by the request context deadline
+// is written with 504 Gateway Timeout.
+func WriteError(w http.ResponseWriter, err error, code int) {
+	out := &drone.Error{
+		Code:    code,
+		Message: err.Error(),
+	}
+	var xerr *drone.Error
+	switch {
+	case errors.As(err, &xerr):
+		if xerr.Code != 0 {
+			out.Code = xerr.Code
+		}
+		out.Retryable = xerr.Retryable
+		out.Details = xerr.Details
+	case errors.Is(err, context.DeadlineExceeded):
+		out.Code = http.StatusGatewayTimeout
+	}
+	if !out.Retryable {
+		out.Retryable = isRetryable(out.Code)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(out.Code)
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// isRetryable returns true if the status code indicates a
+// temporary failure.
+func isRetryable(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
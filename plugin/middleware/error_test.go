@@ -0,0 +1,76 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/drone/drone-go/drone"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWriteError(t *testing.T) {
+	unavailable := &drone.Error{Code: 503, Message: "Service Unavailable"}
+	denied := &drone.Error{Code: 403, Message: "Forbidden", Details: &drone.ErrorDetails{"repo": "octocat/hello-world"}}
+
+	tests := []struct {
+		err  error
+		want *drone.Error
+	}{
+		{
+			err:  errors.New("pc load letter"),
+			want: &drone.Error{Code: 404, Message: "pc load letter"},
+		},
+		{
+			err:  fmt.Errorf("vault: %w", unavailable),
+			want: &drone.Error{Code: 503, Message: "vault: Service Unavailable", Retryable: true},
+		},
+		{
+			err:  denied,
+			want: &drone.Error{Code: 403, Message: "Forbidden", Details: &drone.ErrorDetails{"repo": "octocat/hello-world"}},
+		},
+		{
+			err:  &drone.Error{Message: "no code"},
+			want: &drone.Error{Code: 404, Message: "no code"},
+		},
+		{
+			err:  fmt.Errorf("find secret: %w", context.DeadlineExceeded),
+			want: &drone.Error{Code: 504, Message: "find secret: context deadline exceeded", Retryable: true},
+		},
+	}
+	for _, test := range tests {
+		res := httptest.NewRecorder()
+		WriteError(res, test.err, 404)
+
+		if got, want := res.Code, test.want.Code; got != want {
+			t.Errorf("Want status code %d, got %d", want, got)
+		}
+		if got, want := res.Header().Get("Content-Type"), "application/json"; got != want {
+			t.Errorf("Want Content-Type %s, got %s", want, got)
+		}
+		got := new(drone.Error)
+		json.Unmarshal(res.Body.Bytes(), got)
+		if diff := cmp.Diff(got, test.want); diff != "" {
+			t.Errorf("Unexpected error envelope for %q", test.err)
+			t.Log(diff)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"crypto"
+	"errors"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/drone/drone-go/plugin/internal/httpsig"
+)
+
+// Key is a named shared secret or public key.
+type Key struct {
+	// ID is the keyId included in the http signature.
+	ID string
+
+	// Secret is the shared secret used to verify hmac-sha256
+	// signatures.
+	Secret string
+
+	// PublicKey is the ed25519.PublicKey or *rsa.PublicKey
+	// used to verify ed25519 or rsa-sha256 signatures. If set,
+	// the Secret is ignored.
+	PublicKey crypto.PublicKey
+
+	// Expires is the time after which the key is no longer
+	// accepted. If zero, the key does not expire.
+	Expires time.Time
+}
+
+// Keyring maps keyId to shared secret or public key. A Keyring can be
+// used to rotate secrets without restarting Drone and every
+// plugin at the same time: the new key is added, the old key
+// is accepted for the duration of the rotation window, and
+// Drone is switched to sign requests with the new key.
+//
+// A Keyring is safe for concurrent use.
+type Keyring struct {
+	mu   sync.RWMutex
+	keys map[string]*Key
+	now  func() time.Time
+}
+
+// NewKeyring returns a Keyring with the given keys.
+func NewKeyring(keys ...*Key) *Keyring {
+	k := &Keyring{
+		keys: map[string]*Key{},
+		now:  time.Now,
+	}
+	for _, key := range keys {
+		copy := *key
+		k.keys[key.ID] = &copy
+	}
+	return k
+}
+
+// ParseKeyring parses a comma separated list of id:secret
+// pairs and returns the Keyring.
+func ParseKeyring(s string) (*Keyring, error) {
+	k := NewKeyring()
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		i := strings.Index(part, ":")
+		if i < 1 || i == len(part)-1 {
+			return nil, errors.New("middleware: invalid key format, expected id:secret")
+		}
+		k.Add(part[:i], part[i+1:])
+	}
+	return k, nil
+}
+
+// Add adds the key to the Keyring, replacing any existing key
+// with the same keyId.
+func (k *Keyring) Add(id, secret string) {
+	k.mu.Lock()
+	k.keys[id] = &Key{ID: id, Secret: secret}
+	k.mu.Unlock()
+}
+
+// AddPublicKey adds the public key to the Keyring, replacing
+// any existing key with the same keyId. Requests signed with
+// the matching private key are verified using the ed25519 or
+// rsa-sha256 algorithm, so that plugins do not need to know a
+// secret capable of signing requests.
+func (k *Keyring) AddPublicKey(id string, key crypto.PublicKey) {
+	k.mu.Lock()
+	k.keys[id] = &Key{ID: id, PublicKey: key}
+	k.mu.Unlock()
+}
+
+// Remove removes the key from the Keyring.
+func (k *Keyring) Remove(id string) {
+	k.mu.Lock()
+	delete(k.keys, id)
+	k.mu.Unlock()
+}
+
+// Rotate adds the key to the Keyring and expires all other
+// keys after the rotation window, during which requests signed
+// with the old and the new keys are both accepted.
+func (k *Keyring) Rotate(id, secret string, window time.Duration) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	expires := k.now().Add(window)
+	for _, key := range k.keys {
+		if key.ID == id {
+			continue
+		}
+		if key.Expires.IsZero() || key.Expires.After(expires) {
+			key.Expires = expires
+		}
+	}
+	k.keys[id] = &Key{ID: id, Secret: secret}
+}
+
+// Secret returns the secret for the keyId. It returns false if
+// the key does not exist, is expired, or is a public key.
+func (k *Keyring) Secret(id string) (string, bool) {
+	key, ok := k.Key(id)
+	if !ok || key.PublicKey != nil {
+		return "", false
+	}
+	return key.Secret, true
+}
+
+// PublicKey returns the public key for the keyId. It returns
+// false if the key does not exist, is expired, or is a shared
+// secret.
+func (k *Keyring) PublicKey(id string) (crypto.PublicKey, bool) {
+	key, ok := k.Key(id)
+	if !ok || key.PublicKey == nil {
+		return nil, false
+	}
+	return key.PublicKey, true
+}
+
+// Key returns a copy of the key for the keyId. It returns
+// false if the key does not exist or is expired.
+func (k *Keyring) Key(id string) (Key, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	key, ok := k.keys[id]
+	if !ok {
+		return Key{}, false
+	}
+	if !key.Expires.IsZero() && k.now().After(key.Expires) {
+		return Key{}, false
+	}
+	return *key, true
+}
+
+// IDs returns the sorted list of keys that are not expired.
+func (k *Keyring) IDs() []string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	var ids []string
+	for id, key := range k.keys {
+		if key.Expires.IsZero() || !k.now().After(key.Expires) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// ParsePublicKey parses a PEM encoded ed25519 or rsa public
+// key in PKIX or PKCS1 form.
+func ParsePublicKey(data []byte) (crypto.PublicKey, error) {
+	return httpsig.ParsePublicKey(data)
+}
+
+// LoadPublicKey reads and parses a PEM encoded ed25519 or rsa
+// public key from the file.
+func LoadPublicKey(path string) (crypto.PublicKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePublicKey(data)
+}
@@ -0,0 +1,150 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/drone/drone-go/plugin/internal/httpsig"
+	"github.com/drone/drone-go/plugin/internal/testutil"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestKeyring_Rotate(t *testing.T) {
+	now := time.Now()
+	keyring := NewKeyring(&Key{ID: "old", Secret: "foo"})
+	keyring.now = func() time.Time { return now }
+	keyring.Rotate("new", "bar", time.Hour)
+
+	if diff := cmp.Diff(keyring.IDs(), []string{"new", "old"}); diff != "" {
+		t.Errorf("Want old and new keys accepted during rotation")
+		t.Log(diff)
+	}
+	if secret, ok := keyring.Secret("old"); !ok || secret != "foo" {
+		t.Errorf("Want old key accepted during rotation window")
+	}
+
+	keyring.now = func() time.Time { return now.Add(2 * time.Hour) }
+	if _, ok := keyring.Secret("old"); ok {
+		t.Errorf("Want old key rejected after rotation window")
+	}
+	if secret, ok := keyring.Secret("new"); !ok || secret != "bar" {
+		t.Errorf("Want new key accepted after rotation window")
+	}
+	if diff := cmp.Diff(keyring.IDs(), []string{"new"}); diff != "" {
+		t.Errorf("Want only new key after rotation window")
+		t.Log(diff)
+	}
+}
+
+func TestParseKeyring(t *testing.T) {
+	keyring, err := ParseKeyring("old:foo, new:bar:baz")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if secret, _ := keyring.Secret("old"); secret != "foo" {
+		t.Errorf("Want secret foo, got %q", secret)
+	}
+	if secret, _ := keyring.Secret("new"); secret != "bar:baz" {
+		t.Errorf("Want secret bar:baz, got %q", secret)
+	}
+
+	for _, s := range []string{"foo", ":foo", "foo:"} {
+		if _, err := ParseKeyring(s); err == nil {
+			t.Errorf("Want error parsing keyring %q", s)
+		}
+	}
+}
+
+func TestVerify_Keyring(t *testing.T) {
+	verifier := NewVerifier("")
+	verifier.Keys = NewKeyring(
+		&Key{ID: "old", Secret: "foo"},
+		&Key{ID: "new", Secret: "bar"},
+	)
+
+	tests := []struct {
+		id, secret string
+		want       error
+	}{
+		{"old", "foo", nil},
+		{"new", "bar", nil},
+		{"new", "foo", ErrInvalidSignature},
+		{"hmac-key", "foo", ErrUnknownKey},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("POST", "/", strings.NewReader("{}"))
+		if err := testutil.SignKey(req, test.id, test.secret); err != nil {
+			t.Error(err)
+			return
+		}
+		if got := verifier.Verify(req); !errors.Is(got, test.want) {
+			t.Errorf("Want error %v for key %s, got %v", test.want, test.id, got)
+		}
+	}
+}
+
+func TestVerify_PublicKey(t *testing.T) {
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, other, _ := ed25519.GenerateKey(rand.Reader)
+
+	verifier := NewVerifier("")
+	verifier.Keys = NewKeyring(&Key{ID: "hmac-key", Secret: "foo"})
+	verifier.Keys.AddPublicKey("drone", pub)
+
+	tests := []struct {
+		id   string
+		key  crypto.Signer
+		want error
+	}{
+		{"drone", key, nil},
+		{"drone", other, ErrInvalidSignature},
+		{"unknown", key, ErrUnknownKey},
+		{"hmac-key", key, ErrUnknownKey},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("POST", "/", strings.NewReader("{}"))
+		req.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+		req.Header.Set("Digest", "SHA-256=RBNvo1WzZ4oRRq0W9+hknpT7T8If536DEMBg9hyq/4o=")
+		if err := httpsig.Sign(req, test.id, test.key, []string{"date", "digest"}); err != nil {
+			t.Error(err)
+			return
+		}
+		if got := verifier.Verify(req); !errors.Is(got, test.want) {
+			t.Errorf("Want error %v for key %s, got %v", test.want, test.id, got)
+		}
+	}
+
+	// the shared secret is still accepted for hmac-sha256
+	// signatures alongside the public key.
+	req := httptest.NewRequest("POST", "/", strings.NewReader("{}"))
+	testutil.Sign(req, "foo")
+	if err := verifier.Verify(req); err != nil {
+		t.Errorf("Want hmac-sha256 signature accepted, got %s", err)
+	}
+}
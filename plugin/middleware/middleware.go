@@ -0,0 +1,199 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package middleware provides the http middleware shared by
+// the plugin handlers.
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/drone-go/plugin/logger"
+)
+
+// DefaultMaxBodySize is the default maximum size of the
+// request body in bytes.
+const DefaultMaxBodySize = 10 << 20
+
+// ErrTooLarge is returned when the request body exceeds the
+// maximum body size.
+var ErrTooLarge = &drone.Error{Code: http.StatusRequestEntityTooLarge, Message: "Request Entity Too Large"}
+
+// ErrEncryptionUnsupported is returned when the client requests
+// an encrypted response and the request is signed with a
+// private key, because the response is encrypted with the
+// shared secret.
+var ErrEncryptionUnsupported = &drone.Error{Code: http.StatusNotAcceptable, Message: "Encryption Requires a Shared Secret"}
+
+// errPanic is written to the response when the handler panics.
+var errPanic = &drone.Error{Code: http.StatusInternalServerError, Message: "Internal Server Error"}
+
+// Config configures the handler middleware.
+type Config struct {
+	// Verifier verifies the authenticity of the request. If
+	// nil, a Verifier is created from the shared secret.
+	Verifier *Verifier
+
+	// Keyring is an optional Keyring used by the default
+	// Verifier to select the secret by keyId.
+	Keyring *Keyring
+
+	// MaxBodySize is the maximum size of the request body in
+	// bytes. If zero, the DefaultMaxBodySize is used. If
+	// negative, the body size is not limited.
+	MaxBodySize int64
+
+	// Timeout is the maximum duration of the plugin call. The
+	// timeout is applied to the request context passed to the
+	// plugin. If zero, no timeout is applied.
+	Timeout time.Duration
+}
+
+// Option configures the handler middleware.
+type Option func(*Config)
+
+// WithVerifier returns an option to set the request Verifier.
+func WithVerifier(v *Verifier) Option {
+	return func(c *Config) {
+		c.Verifier = v
+	}
+}
+
+// WithKeyring returns an option to verify requests using the
+// secret that matches the keyId of the signature.
+func WithKeyring(k *Keyring) Option {
+	return func(c *Config) {
+		c.Keyring = k
+	}
+}
+
+// WithMaxBodySize returns an option to limit the size of the
+// request body in bytes.
+func WithMaxBodySize(n int64) Option {
+	return func(c *Config) {
+		c.MaxBodySize = n
+	}
+}
+
+// WithTimeout returns an option to limit the duration of the
+// plugin call.
+func WithTimeout(d time.Duration) Option {
+	return func(c *Config) {
+		c.Timeout = d
+	}
+}
+
+// Wrap returns a http.Handler that verifies the request before
+// invoking the next handler. The name is used to prefix log
+// entries, and the secret is used to create the default
+// Verifier.
+//
+// The handler returns a 400 Bad Request if the signature,
+// digest or date is missing or invalid, and returns a 401
+// Unauthorized if the request is expired or replayed, or is
+// signed with an unknown or expired key. The handler returns a
+// 413 Request Entity Too Large if the request body exceeds the
+// maximum body size. If the next handler panics, the panic and
+// stack trace are logged and a JSON-encoded drone.Error is
+// returned with a 500 Internal Server Error.
+func Wrap(name, secret string, logs logger.Logger, next http.Handler, opts ...Option) http.Handler {
+	config := &Config{}
+	for _, opt := range opts {
+		opt(config)
+	}
+	if config.Verifier == nil {
+		config.Verifier = NewVerifier(secret)
+		config.Verifier.Keys = config.Keyring
+	}
+	if logs == nil {
+		logs = logger.Discard()
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if rec := recover(); rec != nil {
+				if rec == http.ErrAbortHandler {
+					panic(rec)
+				}
+				logs.Errorf("%s: panic: %v\n%s", name, rec, debug.Stack())
+				WriteError(w, errPanic, errPanic.Code)
+			}
+		}()
+
+		if err := limitBody(r, config.MaxBodySize); err != nil {
+			logs.Debugf("%s: cannot read http.Request body: %s", name, err)
+			WriteError(w, err, http.StatusBadRequest)
+			return
+		}
+
+		secret, err := config.Verifier.verify(r)
+		if err != nil {
+			logs.Debugf("%s: cannot verify http.Request: %s", name, err)
+			WriteError(w, err, http.StatusBadRequest)
+			return
+		}
+		ctx := context.WithValue(r.Context(), secretKey{}, secret)
+		if config.Timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, config.Timeout)
+			defer cancel()
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// limitBody reads the request body, up to the maximum size,
+// and replaces the body so that it can be read again.
+func limitBody(r *http.Request, max int64) error {
+	if max < 0 || r.Body == nil {
+		return nil
+	}
+	if max == 0 {
+		max = DefaultMaxBodySize
+	}
+	if r.ContentLength > max {
+		return ErrTooLarge
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, max+1))
+	if err != nil {
+		return err
+	}
+	r.Body.Close()
+	if int64(len(body)) > max {
+		return ErrTooLarge
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return nil
+}
+
+type secretKey struct{}
+
+// SecretFrom returns the secret used to verify the request,
+// which the handler should use to encrypt the response. If
+// the request was not verified by the middleware, the fallback
+// is returned. It returns false if the request was signed with
+// a private key, in which case there is no shared secret to
+// encrypt the response.
+func SecretFrom(ctx context.Context, fallback string) (string, bool) {
+	if secret, ok := ctx.Value(secretKey{}).(string); ok {
+		return secret, secret != ""
+	}
+	return fallback, fallback != ""
+}
@@ -0,0 +1,126 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/drone-go/plugin/internal/testutil"
+	"github.com/drone/drone-go/plugin/logger"
+)
+
+func TestWrap_MaxBodySize(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Write(body)
+	})
+	handler := Wrap("test", secret, nil, next, WithMaxBodySize(8))
+
+	tests := []struct {
+		body   string
+		length bool
+		code   int
+	}{
+		{`{"a":1}`, true, 200},
+		{`{"name":"password"}`, true, 413},
+		{`{"name":"password"}`, false, 413},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("POST", "/", strings.NewReader(test.body))
+		if err := testutil.Sign(req, secret); err != nil {
+			t.Error(err)
+			return
+		}
+		if !test.length {
+			req.ContentLength = -1
+		}
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		if got, want := res.Code, test.code; got != want {
+			t.Errorf("Want status code %d for body %s, got %d", want, test.body, got)
+		}
+		if test.code == 200 && res.Body.String() != test.body {
+			t.Errorf("Want request body readable by the next handler")
+		}
+	}
+}
+
+func TestWrap_Timeout(t *testing.T) {
+	var deadline time.Time
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		deadline, _ = r.Context().Deadline()
+	})
+	handler := Wrap("test", secret, nil, next, WithTimeout(time.Minute))
+
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{}`))
+	if err := testutil.Sign(req, secret); err != nil {
+		t.Error(err)
+		return
+	}
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if deadline.IsZero() || time.Until(deadline) > time.Minute {
+		t.Errorf("Want request context deadline set by the timeout")
+	}
+}
+
+func TestWrap_Recover(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+	logs := &recorder{Logger: logger.Discard()}
+	handler := Wrap("test", secret, logs, next)
+
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{}`))
+	if err := testutil.Sign(req, secret); err != nil {
+		t.Error(err)
+		return
+	}
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+
+	if got, want := res.Code, 500; got != want {
+		t.Errorf("Want status code %d, got %d", want, got)
+	}
+	if got, want := res.Header().Get("Content-Type"), "application/json"; got != want {
+		t.Errorf("Want Content-Type %s, got %s", want, got)
+	}
+	out := new(drone.Error)
+	if err := json.Unmarshal(res.Body.Bytes(), out); err != nil {
+		t.Errorf("Want JSON-encoded drone.Error, got %s", err)
+	} else if out.Code != 500 {
+		t.Errorf("Want error code 500, got %d", out.Code)
+	}
+	if !strings.Contains(logs.last, "test: panic: boom") || !strings.Contains(logs.last, "goroutine") {
+		t.Errorf("Want panic and stack trace logged, got %q", logs.last)
+	}
+}
+
+type recorder struct {
+	logger.Logger
+	last string
+}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.last = fmt.Sprintf(format, args...)
+}
@@ -0,0 +1,255 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/drone-go/plugin/internal/httpsig"
+)
+
+// DefaultSkew is the default maximum difference between the
+// request Date header and the server clock.
+const DefaultSkew = 5 * time.Minute
+
+// NonceHeader is the optional http header that carries a
+// unique, signed request identifier used for replay detection.
+const NonceHeader = "X-Drone-Nonce"
+
+// Verification errors. The error code is the http status code
+// written to the response. The Verifier returns a copy of the
+// error, which can be compared using errors.Is.
+var (
+	ErrMissingSignature = &drone.Error{Code: http.StatusBadRequest, Message: "Invalid or Missing Signature"}
+	ErrInvalidSignature = &drone.Error{Code: http.StatusBadRequest, Message: "Invalid Signature"}
+	ErrUnknownKey       = &drone.Error{Code: http.StatusUnauthorized, Message: "Unknown or Expired Key"}
+	ErrMissingDigest    = &drone.Error{Code: http.StatusBadRequest, Message: "Invalid or Missing Digest"}
+	ErrInvalidDigest    = &drone.Error{Code: http.StatusBadRequest, Message: "Digest Mismatch"}
+	ErrInvalidDate      = &drone.Error{Code: http.StatusBadRequest, Message: "Invalid or Missing Date"}
+	ErrExpired          = &drone.Error{Code: http.StatusUnauthorized, Message: "Request Expired"}
+	ErrReplayed         = &drone.Error{Code: http.StatusUnauthorized, Message: "Request Replayed"}
+)
+
+// Verifier verifies the authenticity of a plugin request. It
+// verifies the http signature, verifies the request body
+// matches the signed Digest header, and verifies the signed
+// Date header is within the allowed clock skew.
+type Verifier struct {
+	// Secret is the shared secret used to verify the
+	// hmac-sha256 signature.
+	Secret string
+
+	// Keys is an optional Keyring. If set, the secret or
+	// public key is selected using the keyId of the signature,
+	// and the Secret is ignored. Requests signed using the
+	// ed25519 or rsa-sha256 algorithms require a Keyring.
+	Keys *Keyring
+
+	// Skew is the maximum allowed difference between the
+	// request Date header and the server clock. If zero,
+	// the DefaultSkew is used.
+	Skew time.Duration
+
+	// Cache is an optional replay cache. If set, a request
+	// with a signed nonce is rejected if the nonce was already
+	// seen within the clock skew window.
+	Cache ReplayCache
+
+	// ReplaySignatures enables replay detection for requests
+	// without a signed nonce, using the signature as the
+	// request identifier. Identical requests signed within the
+	// same second have the same signature, so this should only
+	// be enabled if the client never sends identical requests
+	// concurrently.
+	ReplaySignatures bool
+
+	now func() time.Time
+}
+
+// NewVerifier returns a new Verifier for the shared secret.
+func NewVerifier(secret string) *Verifier {
+	return &Verifier{
+		Secret: secret,
+		Skew:   DefaultSkew,
+	}
+}
+
+// Verify verifies the http request. The request body is read
+// and replaced so that it can be read again by the caller. The
+// returned error is a *drone.Error with the http status code.
+func (v *Verifier) Verify(r *http.Request) error {
+	_, err := v.verify(r)
+	return err
+}
+
+// verify verifies the http request and returns the secret
+// used to verify the signature. The secret is empty if the
+// request is signed with a private key.
+func (v *Verifier) verify(r *http.Request) (string, error) {
+	secret, err := v.verifySignature(r)
+	if xerr, ok := err.(*drone.Error); ok {
+		// return a copy so that the caller cannot modify the
+		// shared error.
+		copy := *xerr
+		return secret, &copy
+	}
+	return secret, err
+}
+
+// verifySignature verifies the http request and returns the
+// secret used to verify the signature.
+func (v *Verifier) verifySignature(r *http.Request) (string, error) {
+	signature, err := httpsig.FromRequest(r)
+	if err != nil {
+		return "", ErrMissingSignature
+	}
+	if signature.Algorithm != httpsig.AlgorithmHmacSha256 {
+		return "", v.verifyPublicKey(r, signature)
+	}
+	secret, err := v.secret(signature.KeyID)
+	if err != nil {
+		return "", err
+	}
+	if err := signature.VerifySecret(r, secret); err != nil {
+		return "", ErrInvalidSignature
+	}
+	return secret, v.verifyRequest(r, signature.Headers, signature.Signature)
+}
+
+// verifyPublicKey verifies the http request signed using an
+// asymmetric algorithm.
+func (v *Verifier) verifyPublicKey(r *http.Request, signature *httpsig.Signature) error {
+	if v.Keys == nil {
+		return ErrUnknownKey
+	}
+	key, ok := v.Keys.PublicKey(signature.KeyID)
+	if !ok {
+		return ErrUnknownKey
+	}
+	if err := signature.Verify(r, key); err != nil {
+		return ErrInvalidSignature
+	}
+	return v.verifyRequest(r, signature.Headers, signature.Signature)
+}
+
+// secret returns the secret for the keyId.
+func (v *Verifier) secret(id string) (string, error) {
+	if v.Keys == nil {
+		return v.Secret, nil
+	}
+	secret, ok := v.Keys.Secret(id)
+	if !ok {
+		return "", ErrUnknownKey
+	}
+	return secret, nil
+}
+
+// verifyRequest verifies the request date, digest and nonce
+// after the signature has been verified.
+func (v *Verifier) verifyRequest(r *http.Request, signed []string, signature string) error {
+	if !contains(signed, "date") {
+		return ErrInvalidDate
+	}
+	date, err := http.ParseTime(r.Header.Get("Date"))
+	if err != nil {
+		return ErrInvalidDate
+	}
+	skew := v.skew()
+	now := v.clock()
+	if delta := now.Sub(date); delta > skew || delta < -skew {
+		return ErrExpired
+	}
+
+	if !contains(signed, "digest") {
+		return ErrMissingDigest
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return ErrInvalidDigest
+	}
+	r.Body.Close()
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err := verifyDigest(r.Header.Get("Digest"), body); err != nil {
+		return err
+	}
+
+	if v.Cache == nil {
+		return nil
+	}
+	key := ""
+	if nonce := r.Header.Get(NonceHeader); nonce != "" && contains(signed, strings.ToLower(NonceHeader)) {
+		key = "nonce:" + nonce
+	} else if v.ReplaySignatures {
+		key = "signature:" + signature
+	}
+	if key != "" && v.Cache.Seen(key, date.Add(skew)) {
+		return ErrReplayed
+	}
+	return nil
+}
+
+func (v *Verifier) skew() time.Duration {
+	if v.Skew == 0 {
+		return DefaultSkew
+	}
+	return v.Skew
+}
+
+func (v *Verifier) clock() time.Time {
+	if v.now == nil {
+		return time.Now()
+	}
+	return v.now()
+}
+
+// verifyDigest verifies the body matches the SHA-256 value of
+// the Digest header. The header may contain multiple comma
+// separated digests, in which case the SHA-256 value is used.
+func verifyDigest(header string, body []byte) error {
+	for _, part := range strings.Split(header, ",") {
+		part = strings.TrimSpace(part)
+		i := strings.Index(part, "=")
+		if i == -1 || !strings.EqualFold(part[:i], "SHA-256") {
+			continue
+		}
+		want, err := base64.StdEncoding.DecodeString(part[i+1:])
+		if err != nil {
+			return ErrMissingDigest
+		}
+		got := sha256.Sum256(body)
+		if subtle.ConstantTimeCompare(want, got[:]) != 1 {
+			return ErrInvalidDigest
+		}
+		return nil
+	}
+	return ErrMissingDigest
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
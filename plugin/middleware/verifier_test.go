@@ -0,0 +1,250 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/drone/drone-go/plugin/internal/testutil"
+
+	"github.com/99designs/httpsignatures-go"
+)
+
+const secret = "xVKAGlWQiY3sOp8JVc0nbuNId3PNCgWh"
+
+func TestVerify(t *testing.T) {
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{"name":"password"}`))
+	if err := testutil.Sign(req, secret); err != nil {
+		t.Error(err)
+		return
+	}
+	if err := NewVerifier(secret).Verify(req); err != nil {
+		t.Errorf("Want valid request, got %s", err)
+		return
+	}
+	body, _ := ioutil.ReadAll(req.Body)
+	if got, want := string(body), `{"name":"password"}`; got != want {
+		t.Errorf("Want request body %q to be readable after verification, got %q", want, got)
+	}
+}
+
+func TestVerify_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*http.Request)
+		sign   func(*http.Request) error
+		want   error
+	}{
+		{
+			name: "missing signature",
+			sign: func(*http.Request) error { return nil },
+			want: ErrMissingSignature,
+		},
+		{
+			name: "invalid signature",
+			sign: func(r *http.Request) error { return testutil.Sign(r, "wrong-secret") },
+			want: ErrInvalidSignature,
+		},
+		{
+			name: "tampered body",
+			sign: func(r *http.Request) error { return testutil.Sign(r, secret) },
+			modify: func(r *http.Request) {
+				r.Body = ioutil.NopCloser(strings.NewReader(`{"name":"other"}`))
+			},
+			want: ErrInvalidDigest,
+		},
+		{
+			name: "malformed digest",
+			sign: func(r *http.Request) error {
+				r.Header.Set("Digest", "MD5=foo")
+				return testutil.Sign(r, secret)
+			},
+			want: ErrMissingDigest,
+		},
+		{
+			name: "unsigned digest",
+			sign: func(r *http.Request) error {
+				r.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+				return httpsignatures.DefaultSha256Signer.AuthRequest("hmac-key", secret, r)
+			},
+			want: ErrMissingDigest,
+		},
+		{
+			name: "expired date",
+			sign: func(r *http.Request) error {
+				r.Header.Set("Date", time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat))
+				return testutil.Sign(r, secret)
+			},
+			want: ErrExpired,
+		},
+		{
+			name: "future date",
+			sign: func(r *http.Request) error {
+				r.Header.Set("Date", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+				return testutil.Sign(r, secret)
+			},
+			want: ErrExpired,
+		},
+		{
+			name: "malformed date",
+			sign: func(r *http.Request) error {
+				r.Header.Set("Date", "yesterday")
+				return testutil.Sign(r, secret)
+			},
+			want: ErrInvalidDate,
+		},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("POST", "/", strings.NewReader(`{"name":"password"}`))
+		if err := test.sign(req); err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		if test.modify != nil {
+			test.modify(req)
+		}
+		if got := NewVerifier(secret).Verify(req); !errors.Is(got, test.want) {
+			t.Errorf("%s: want error %v, got %v", test.name, test.want, got)
+		}
+	}
+}
+
+func TestVerify_Replay(t *testing.T) {
+	verifier := NewVerifier(secret)
+	verifier.Cache = NewReplayCache()
+
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{}`))
+	if err := testutil.Sign(req, secret); err != nil {
+		t.Error(err)
+		return
+	}
+	replay := req.Clone(req.Context())
+	replay.Body = ioutil.NopCloser(strings.NewReader(`{}`))
+
+	if err := verifier.Verify(req); err != nil {
+		t.Errorf("Want first request accepted, got %s", err)
+	}
+	// a request without a signed nonce is not checked for
+	// replay by default, since identical requests signed in
+	// the same second have the same signature.
+	if err := verifier.Verify(replay); err != nil {
+		t.Errorf("Want identical request accepted, got %s", err)
+	}
+
+	verifier.ReplaySignatures = true
+	for _, r := range []*http.Request{req, replay} {
+		r.Body = ioutil.NopCloser(strings.NewReader(`{}`))
+	}
+	if err := verifier.Verify(req); err != nil {
+		t.Errorf("Want first request accepted, got %s", err)
+	}
+	if err := verifier.Verify(replay); !errors.Is(err, ErrReplayed) {
+		t.Errorf("Want replayed request rejected, got %v", err)
+	}
+}
+
+func TestVerify_ErrorCopy(t *testing.T) {
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{}`))
+	err := NewVerifier(secret).Verify(req)
+	if !errors.Is(err, ErrMissingSignature) {
+		t.Fatalf("Want ErrMissingSignature, got %v", err)
+	}
+	if err == ErrMissingSignature {
+		t.Errorf("Want a copy of the shared error")
+	}
+}
+
+func TestVerify_Nonce(t *testing.T) {
+	verifier := NewVerifier(secret)
+	verifier.Cache = NewReplayCache()
+
+	signer := httpsignatures.NewSigner(httpsignatures.AlgorithmHmacSha256, "date", "digest", NonceHeader)
+	date := time.Now().UTC().Format(http.TimeFormat)
+	for i, nonce := range []string{"a", "b", "a"} {
+		req := httptest.NewRequest("POST", "/", strings.NewReader(`{}`))
+		req.Header.Set("Date", date)
+		req.Header.Set(NonceHeader, nonce)
+		req.Header.Set("Digest", "SHA-256=RBNvo1WzZ4oRRq0W9+hknpT7T8If536DEMBg9hyq/4o=")
+		if err := signer.AuthRequest("hmac-key", secret, req); err != nil {
+			t.Error(err)
+			return
+		}
+		err := verifier.Verify(req)
+		if i < 2 && err != nil {
+			t.Errorf("Want request with nonce %s accepted, got %s", nonce, err)
+		}
+		if i == 2 && !errors.Is(err, ErrReplayed) {
+			t.Errorf("Want request with reused nonce rejected, got %v", err)
+		}
+	}
+}
+
+func TestReplayCache_Expired(t *testing.T) {
+	now := time.Now()
+	cache := NewReplayCache().(*memoryCache)
+	cache.now = func() time.Time { return now }
+
+	if cache.Seen("foo", now.Add(time.Minute)) {
+		t.Errorf("Want key not seen")
+	}
+	if !cache.Seen("foo", now.Add(time.Minute)) {
+		t.Errorf("Want key seen")
+	}
+	cache.now = func() time.Time { return now.Add(2 * time.Minute) }
+	if cache.Seen("foo", now.Add(3*time.Minute)) {
+		t.Errorf("Want expired key not seen")
+	}
+}
+
+func TestWrap(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	handler := Wrap("test", secret, nil, next)
+
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{}`))
+	req.Header.Set("Date", time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat))
+	if err := testutil.Sign(req, secret); err != nil {
+		t.Error(err)
+		return
+	}
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+
+	if got, want := res.Code, http.StatusUnauthorized; got != want {
+		t.Errorf("Want status code %d, got %d", want, got)
+	}
+	if got, want := res.Body.String(), `{"code":401,"message":"Request Expired"}`+"\n"; got != want {
+		t.Errorf("Want response body %q, got %q", want, got)
+	}
+
+	req = httptest.NewRequest("POST", "/", strings.NewReader(`{}`))
+	if err := testutil.Sign(req, secret); err != nil {
+		t.Error(err)
+		return
+	}
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+
+	if got, want := res.Code, http.StatusNoContent; got != want {
+		t.Errorf("Want status code %d, got %d", want, got)
+	}
+}
@@ -0,0 +1,203 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/drone/drone-go/drone"
+)
+
+// VersionsHeader is the response header that advertises the
+// media types supported by the handler.
+const VersionsHeader = "X-Drone-Versions"
+
+// ErrNotAcceptable is returned when the handler does not
+// support any of the media types accepted by the client.
+var ErrNotAcceptable = &drone.Error{Code: http.StatusNotAcceptable, Message: "Not Acceptable"}
+
+// mediaPrefix is the prefix of the plugin media types.
+const mediaPrefix = "application/vnd.drone."
+
+// MediaType is a versioned plugin media type in the format
+// application/vnd.drone.<kind>.v<N>+json.
+type MediaType struct {
+	Kind    string
+	Version int
+}
+
+// ParseMediaType parses a versioned plugin media type. It
+// returns false if the value is not a plugin media type.
+func ParseMediaType(s string) (MediaType, bool) {
+	if i := strings.Index(s, ";"); i != -1 {
+		s = s[:i]
+	}
+	s = strings.ToLower(strings.TrimSpace(s))
+	if !strings.HasPrefix(s, mediaPrefix) || !strings.HasSuffix(s, "+json") {
+		return MediaType{}, false
+	}
+	s = strings.TrimSuffix(strings.TrimPrefix(s, mediaPrefix), "+json")
+	i := strings.LastIndex(s, ".v")
+	if i < 1 {
+		return MediaType{}, false
+	}
+	version, err := strconv.Atoi(s[i+2:])
+	if err != nil || version < 1 {
+		return MediaType{}, false
+	}
+	return MediaType{Kind: s[:i], Version: version}, true
+}
+
+// String returns the media type string.
+func (m MediaType) String() string {
+	return fmt.Sprintf("%s%s.v%d+json", mediaPrefix, m.Kind, m.Version)
+}
+
+// Codec decodes the request body and encodes the response body
+// for a version of a plugin API.
+type Codec interface {
+	Decode(data []byte, v interface{}) error
+	Encode(v interface{}) ([]byte, error)
+}
+
+// JSON is a Codec that decodes and encodes the values as JSON
+// without conversion.
+var JSON Codec = jsonCodec{}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Decode(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+func (jsonCodec) Encode(v interface{}) ([]byte, error)    { return json.Marshal(v) }
+
+// Versions negotiates the version of a plugin API using the
+// request Accept header, and dispatches to the Codec for the
+// negotiated version.
+type Versions struct {
+	kind      string
+	codecs    map[int]Codec
+	supported []string
+	latest    int
+}
+
+// NewVersions returns the Versions for the Codecs keyed by
+// media type. It panics if a media type is invalid, or the
+// media types are for different plugin kinds.
+func NewVersions(codecs map[string]Codec) *Versions {
+	v := &Versions{codecs: map[int]Codec{}}
+	var media []MediaType
+	for s, codec := range codecs {
+		m, ok := ParseMediaType(s)
+		if !ok {
+			panic("middleware: invalid media type " + s)
+		}
+		if v.kind != "" && v.kind != m.Kind {
+			panic("middleware: media types for multiple plugin kinds")
+		}
+		v.kind = m.Kind
+		v.codecs[m.Version] = codec
+		media = append(media, m)
+	}
+	if len(media) == 0 {
+		panic("middleware: missing media types")
+	}
+	sort.Slice(media, func(i, j int) bool {
+		return media[i].Version < media[j].Version
+	})
+	for _, m := range media {
+		v.supported = append(v.supported, m.String())
+	}
+	v.latest = media[len(media)-1].Version
+	return v
+}
+
+// Supported returns the supported media types, oldest first.
+func (v *Versions) Supported() []string {
+	return append([]string(nil), v.supported...)
+}
+
+// Negotiate returns the Codec for the version accepted by the
+// client, and advertises the supported media types in the
+// response header. If the Accept header is empty or accepts
+// any JSON response, the latest version is used. If the
+// handler does not support any of the accepted media types, a
+// *drone.Error that matches ErrNotAcceptable is returned.
+func (v *Versions) Negotiate(w http.ResponseWriter, r *http.Request) (Codec, error) {
+	w.Header().Set(VersionsHeader, strings.Join(v.supported, ", "))
+	w.Header().Add("Vary", "Accept")
+
+	accept := r.Header.Get("Accept")
+	if strings.TrimSpace(accept) == "" {
+		return v.codecs[v.latest], nil
+	}
+	for _, media := range parseAccept(accept) {
+		if m, ok := ParseMediaType(media); ok {
+			if codec, ok := v.codecs[m.Version]; ok && m.Kind == v.kind {
+				return codec, nil
+			}
+			continue
+		}
+		switch media {
+		case "application/json", "application/*", "*/*":
+			return v.codecs[v.latest], nil
+		}
+	}
+	return nil, &drone.Error{
+		Code:    ErrNotAcceptable.Code,
+		Message: ErrNotAcceptable.Message,
+		Details: &drone.ErrorDetails{"supported": strings.Join(v.supported, ", ")},
+	}
+}
+
+// parseAccept returns the media types in the Accept header,
+// ordered by quality. Media types with zero quality are
+// excluded.
+func parseAccept(accept string) []string {
+	type item struct {
+		media   string
+		quality float64
+	}
+	var items []item
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		it := item{
+			media:   strings.ToLower(strings.TrimSpace(params[0])),
+			quality: 1,
+		}
+		for _, param := range params[1:] {
+			kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+			if len(kv) == 2 && strings.TrimSpace(kv[0]) == "q" {
+				if q, err := strconv.ParseFloat(strings.TrimSpace(kv[1]), 64); err == nil {
+					it.quality = q
+				}
+			}
+		}
+		if it.media != "" && it.quality > 0 {
+			items = append(items, it)
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].quality > items[j].quality
+	})
+	media := make([]string, len(items))
+	for i, it := range items {
+		media[i] = it.media
+	}
+	return media
+}
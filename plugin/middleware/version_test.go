@@ -0,0 +1,123 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+)
+
+const (
+	testV1 = "application/vnd.drone.env.v1+json"
+	testV2 = "application/vnd.drone.env.v2+json"
+)
+
+// testCodec is a Codec that identifies the negotiated version.
+type testCodec string
+
+func (testCodec) Decode(data []byte, v interface{}) error { return nil }
+func (c testCodec) Encode(v interface{}) ([]byte, error)  { return []byte(c), nil }
+
+func TestParseMediaType(t *testing.T) {
+	tests := []struct {
+		media string
+		want  MediaType
+		ok    bool
+	}{
+		{media: testV2, want: MediaType{Kind: "env", Version: 2}, ok: true},
+		{media: " application/vnd.drone.secret.v1+json; charset=utf-8", want: MediaType{Kind: "secret", Version: 1}, ok: true},
+		{media: "application/vnd.drone.validate.v10+json", want: MediaType{Kind: "validate", Version: 10}, ok: true},
+		{media: "application/json"},
+		{media: "application/vnd.drone.env.v0+json"},
+		{media: "application/vnd.drone.env.vx+json"},
+		{media: "application/vnd.drone.env+json"},
+		{media: "application/vnd.drone.env.v1+xml"},
+	}
+	for _, test := range tests {
+		got, ok := ParseMediaType(test.media)
+		if ok != test.ok || got != test.want {
+			t.Errorf("Want %q parsed as %+v, got %+v", test.media, test.want, got)
+		}
+		if ok && got.String() != test.want.String() {
+			t.Errorf("Want media type string %s", test.want)
+		}
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	versions := NewVersions(map[string]Codec{
+		testV2: testCodec("v2"),
+		testV1: testCodec("v1"),
+	})
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{accept: testV1, want: "v1"},
+		{accept: testV2, want: "v2"},
+		{accept: "", want: "v2"},
+		{accept: "application/json", want: "v2"},
+		{accept: "*/*", want: "v2"},
+		{accept: "application/vnd.drone.env.v3+json, " + testV1, want: "v1"},
+		{accept: testV1 + ";q=0.5, " + testV2, want: "v2"},
+		{accept: testV2 + ";q=0.5, " + testV1, want: "v1"},
+		{accept: testV2 + ";q=0, application/json", want: "v2"},
+		{accept: "application/vnd.drone.env.v3+json"},
+		{accept: "application/vnd.drone.secret.v1+json"},
+		{accept: testV1 + ";q=0"},
+		{accept: "text/plain"},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("POST", "/", nil)
+		req.Header.Set("Accept", test.accept)
+		res := httptest.NewRecorder()
+		codec, err := versions.Negotiate(res, req)
+		if got, want := res.Header().Get(VersionsHeader), testV1+", "+testV2; got != want {
+			t.Errorf("Want supported versions %s, got %s", want, got)
+		}
+		if test.want == "" {
+			if !errors.Is(err, ErrNotAcceptable) {
+				t.Errorf("Want ErrNotAcceptable for %q, got %v", test.accept, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Unexpected error for %q: %s", test.accept, err)
+			continue
+		}
+		if got, _ := codec.Encode(nil); string(got) != test.want {
+			t.Errorf("Want version %s for %q, got %s", test.want, test.accept, got)
+		}
+	}
+}
+
+func TestNewVersions_Invalid(t *testing.T) {
+	tests := []map[string]Codec{
+		{},
+		{"application/json": JSON},
+		{testV1: JSON, "application/vnd.drone.secret.v1+json": JSON},
+	}
+	for _, codecs := range tests {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Want panic for invalid media types %v", codecs)
+				}
+			}()
+			NewVersions(codecs)
+		}()
+	}
+}
@@ -0,0 +1,254 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugintest
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/drone-go/plugin/admission"
+	"github.com/drone/drone-go/plugin/config"
+	"github.com/drone/drone-go/plugin/converter"
+	"github.com/drone/drone-go/plugin/environ"
+	"github.com/drone/drone-go/plugin/middleware"
+	"github.com/drone/drone-go/plugin/registry"
+	"github.com/drone/drone-go/plugin/secret"
+	"github.com/drone/drone-go/plugin/validator"
+	"github.com/drone/drone-go/plugin/webhook"
+)
+
+// TestSecret tests the handler implements the secret protocol.
+// The handler must be configured with the shared secret, and
+// is invoked with the request.
+func TestSecret(t *testing.T, handler http.Handler, key string, in *secret.Request) {
+	testRequest(t, handler, key, secret.V1, in)
+	t.Run("Response", func(t *testing.T) {
+		res := Do(handler, SecretRequest(key, in))
+		testResponse(t, res, key, new(drone.Secret), false)
+	})
+	t.Run("Encrypted", func(t *testing.T) {
+		skipEncryption(t, key)
+		res := Do(handler, SecretRequest(key, in, WithEncryption()))
+		testResponse(t, res, key, new(drone.Secret), true)
+	})
+}
+
+// TestEnviron tests the handler implements version 1 and
+// version 2 of the environ protocol.
+func TestEnviron(t *testing.T, handler http.Handler, key string, in *environ.Request) {
+	testRequest(t, handler, key, environ.V2, in)
+	t.Run("Response", func(t *testing.T) {
+		res := Do(handler, EnvironRequest(key, in))
+		testResponse(t, res, key, &[]*environ.Variable{}, false)
+	})
+	t.Run("ResponseV1", func(t *testing.T) {
+		res := Do(handler, EnvironV1Request(key, in))
+		testResponse(t, res, key, &map[string]string{}, false)
+	})
+	t.Run("Encrypted", func(t *testing.T) {
+		skipEncryption(t, key)
+		res := Do(handler, EnvironRequest(key, in, WithEncryption()))
+		testResponse(t, res, key, &[]*environ.Variable{}, true)
+	})
+	t.Run("EncryptedV1", func(t *testing.T) {
+		skipEncryption(t, key)
+		res := Do(handler, EnvironV1Request(key, in, WithEncryption()))
+		testResponse(t, res, key, &map[string]string{}, true)
+	})
+}
+
+// TestRegistry tests the handler implements the registry
+// protocol.
+func TestRegistry(t *testing.T, handler http.Handler, key string, in *registry.Request) {
+	testRequest(t, handler, key, registry.V1, in)
+	t.Run("Response", func(t *testing.T) {
+		res := Do(handler, RegistryRequest(key, in))
+		testResponse(t, res, key, &[]*drone.Registry{}, false)
+	})
+	t.Run("Encrypted", func(t *testing.T) {
+		skipEncryption(t, key)
+		res := Do(handler, RegistryRequest(key, in, WithEncryption()))
+		testResponse(t, res, key, &[]*drone.Registry{}, true)
+	})
+}
+
+// TestConfig tests the handler implements the config protocol.
+func TestConfig(t *testing.T, handler http.Handler, key string, in *config.Request) {
+	testRequest(t, handler, key, config.V1, in)
+	t.Run("Response", func(t *testing.T) {
+		res := Do(handler, ConfigRequest(key, in))
+		testOptionalResponse(t, res, new(drone.Config))
+	})
+}
+
+// TestConverter tests the handler implements the converter
+// protocol.
+func TestConverter(t *testing.T, handler http.Handler, key string, in *converter.Request) {
+	testRequest(t, handler, key, converter.V1, in)
+	t.Run("Response", func(t *testing.T) {
+		res := Do(handler, ConverterRequest(key, in))
+		testOptionalResponse(t, res, new(drone.Config))
+	})
+}
+
+// TestAdmission tests the handler implements the admission
+// protocol.
+func TestAdmission(t *testing.T, handler http.Handler, key string, in *admission.Request) {
+	testRequest(t, handler, key, admission.V1, in)
+	t.Run("Response", func(t *testing.T) {
+		res := Do(handler, AdmissionRequest(key, in))
+		testOptionalResponse(t, res, new(drone.User))
+	})
+}
+
+// TestValidator tests the handler implements the validator
+// protocol.
+func TestValidator(t *testing.T, handler http.Handler, key string, in *validator.Request) {
+	testRequest(t, handler, key, validator.V1, in)
+	t.Run("Response", func(t *testing.T) {
+		res := Do(handler, ValidatorRequest(key, in))
+		switch res.StatusCode {
+		case http.StatusNoContent, validator.StatusSkip, validator.StatusBlock:
+		default:
+			testError(t, res, 0)
+		}
+	})
+}
+
+// TestWebhook tests the handler implements the webhook
+// protocol.
+func TestWebhook(t *testing.T, handler http.Handler, key string, in *webhook.Request) {
+	testRequest(t, handler, key, webhook.V1, in)
+	t.Run("Response", func(t *testing.T) {
+		res := Do(handler, WebhookRequest(key, in))
+		if res.StatusCode != http.StatusNoContent {
+			testError(t, res, 0)
+		}
+	})
+}
+
+// testRequest tests the handler rejects requests that are not
+// signed, are signed with the wrong secret, have been modified
+// or expired, have a malformed body, or do not accept a
+// supported version.
+func testRequest(t *testing.T, handler http.Handler, key, accept string, in interface{}) {
+	t.Run("MissingSignature", func(t *testing.T) {
+		req := NewRequest(key, accept, in)
+		req.Header.Del("Authorization")
+		req.Header.Del("Signature")
+		testError(t, Do(handler, req), http.StatusBadRequest)
+	})
+	t.Run("InvalidSignature", func(t *testing.T) {
+		req := NewRequest("invalid-"+key, accept, in)
+		testError(t, Do(handler, req), http.StatusBadRequest)
+	})
+	t.Run("TamperedBody", func(t *testing.T) {
+		req := NewRequest(key, accept, in)
+		req.Body = ioutil.NopCloser(strings.NewReader(`{"tampered":true}`))
+		testError(t, Do(handler, req), http.StatusBadRequest)
+	})
+	t.Run("Expired", func(t *testing.T) {
+		req := NewRequest(key, accept, in, WithDate(time.Now().Add(-time.Hour)))
+		testError(t, Do(handler, req), http.StatusUnauthorized)
+	})
+	t.Run("InvalidInput", func(t *testing.T) {
+		req := NewRequest(key, accept, "{")
+		testError(t, Do(handler, req), http.StatusBadRequest)
+	})
+	t.Run("UnsupportedVersion", func(t *testing.T) {
+		media, _ := middleware.ParseMediaType(accept)
+		media.Version = 999
+		res := Do(handler, NewRequest(key, media.String(), in))
+		if res.Header.Get(middleware.VersionsHeader) == "" {
+			t.Errorf("Want supported versions advertised in the %s header", middleware.VersionsHeader)
+		}
+		testError(t, res, http.StatusNotAcceptable)
+	})
+}
+
+// testResponse tests the response is a valid, optionally
+// encrypted, JSON-encoded response or a valid error.
+func testResponse(t *testing.T, res *http.Response, key string, v interface{}, encrypted bool) {
+	if res.StatusCode > 299 {
+		testError(t, res, 0)
+		return
+	}
+	if got, want := res.StatusCode, http.StatusOK; got != want {
+		t.Errorf("Want status code %d, got %d", want, got)
+	}
+	if got := res.Header.Get("Content-Encoding"); encrypted && got != "aesgcm" {
+		t.Errorf("Want Content-Encoding aesgcm, got %q", got)
+	} else if !encrypted && got == "aesgcm" {
+		t.Errorf("Want unencrypted response body")
+	}
+	if err := Decode(res, key, v); err != nil {
+		t.Errorf("Want valid response body, got %s", err)
+	}
+}
+
+// testOptionalResponse tests the response is a JSON-encoded
+// response, a 204 No Content response or a valid error.
+func testOptionalResponse(t *testing.T, res *http.Response, v interface{}) {
+	if res.StatusCode == http.StatusNoContent {
+		return
+	}
+	if res.StatusCode == http.StatusOK {
+		if got, want := res.Header.Get("Content-Type"), "application/json"; got != want {
+			t.Errorf("Want Content-Type %s, got %s", want, got)
+		}
+	}
+	testResponse(t, res, "", v, false)
+}
+
+// testError tests the response is a JSON-encoded error with
+// an error code that matches the status code. If code is
+// non-zero, the status code must match the code.
+func testError(t *testing.T, res *http.Response, code int) {
+	defer res.Body.Close()
+	if code != 0 && res.StatusCode != code {
+		t.Errorf("Want status code %d, got %d", code, res.StatusCode)
+	}
+	if res.StatusCode < 400 {
+		t.Errorf("Want error status code, got %d", res.StatusCode)
+		return
+	}
+	if got, want := res.Header.Get("Content-Type"), "application/json"; got != want {
+		t.Errorf("Want error Content-Type %s, got %s", want, got)
+	}
+	out := new(drone.Error)
+	if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+		t.Errorf("Want JSON-encoded error, got %s", err)
+		return
+	}
+	if out.Code != res.StatusCode {
+		t.Errorf("Want error code %d, got %d", res.StatusCode, out.Code)
+	}
+	if out.Message == "" {
+		t.Errorf("Want error message")
+	}
+}
+
+// skipEncryption skips the test if the shared secret cannot
+// be used as an aesgcm encryption key.
+func skipEncryption(t *testing.T, key string) {
+	if len(key) < 32 {
+		t.Skip("shared secret is too short for aesgcm encryption")
+	}
+}
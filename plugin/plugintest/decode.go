@@ -0,0 +1,111 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugintest
+
+import (
+	"io/ioutil"
+	"net/http"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/drone-go/plugin/environ"
+	"github.com/drone/drone-go/plugin/internal/client"
+	"github.com/drone/drone-go/plugin/validator"
+)
+
+// Decode reads the response body and decodes the JSON-encoded
+// body into v, like the plugin clients. If the response body
+// is aesgcm encrypted, the body is decrypted using the shared
+// secret. If the response status code is 4xx or 5xx, the
+// decoded *drone.Error is returned. If the response status is
+// 204 No Content, v is not modified.
+func Decode(res *http.Response, key string, v interface{}) error {
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return err
+	}
+	return client.Decode(res, body, key, v)
+}
+
+// DecodeError returns the *drone.Error if the response status
+// code is 4xx or 5xx, or nil if the response is successful.
+func DecodeError(res *http.Response) error {
+	return Decode(res, "", nil)
+}
+
+// DecodeSecret decodes a secret response.
+func DecodeSecret(res *http.Response, key string) (*drone.Secret, error) {
+	out := new(drone.Secret)
+	err := Decode(res, key, out)
+	return out, err
+}
+
+// DecodeVariables decodes a version 2 environ response.
+func DecodeVariables(res *http.Response, key string) ([]*environ.Variable, error) {
+	var out []*environ.Variable
+	err := Decode(res, key, &out)
+	return out, err
+}
+
+// DecodeVariablesV1 decodes a legacy version 1 environ response.
+func DecodeVariablesV1(res *http.Response, key string) (map[string]string, error) {
+	out := map[string]string{}
+	err := Decode(res, key, &out)
+	return out, err
+}
+
+// DecodeRegistries decodes a registry response.
+func DecodeRegistries(res *http.Response, key string) ([]*drone.Registry, error) {
+	var out []*drone.Registry
+	err := Decode(res, key, &out)
+	return out, err
+}
+
+// DecodeConfig decodes a config or converter response. The
+// returned config is nil if the response is 204 No Content.
+func DecodeConfig(res *http.Response) (*drone.Config, error) {
+	if res.StatusCode == http.StatusNoContent {
+		return nil, nil
+	}
+	out := new(drone.Config)
+	err := Decode(res, "", out)
+	return out, err
+}
+
+// DecodeUser decodes an admission response. The returned user
+// is nil if the response is 204 No Content.
+func DecodeUser(res *http.Response) (*drone.User, error) {
+	if res.StatusCode == http.StatusNoContent {
+		return nil, nil
+	}
+	out := new(drone.User)
+	err := Decode(res, "", out)
+	return out, err
+}
+
+// DecodeValidation decodes a validator response. It returns
+// validator.ErrSkip or validator.ErrBlock if the build should
+// be skipped or blocked.
+func DecodeValidation(res *http.Response) error {
+	switch res.StatusCode {
+	case validator.StatusSkip:
+		res.Body.Close()
+		return validator.ErrSkip
+	case validator.StatusBlock:
+		res.Body.Close()
+		return validator.ErrBlock
+	}
+	return DecodeError(res)
+}
@@ -0,0 +1,187 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package plugintest provides utilities for testing plugin
+// handlers, including signed request builders, response
+// decoders and conformance suites.
+package plugintest
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/drone/drone-go/plugin/admission"
+	"github.com/drone/drone-go/plugin/config"
+	"github.com/drone/drone-go/plugin/converter"
+	"github.com/drone/drone-go/plugin/environ"
+	"github.com/drone/drone-go/plugin/internal/client"
+	"github.com/drone/drone-go/plugin/registry"
+	"github.com/drone/drone-go/plugin/secret"
+	"github.com/drone/drone-go/plugin/transport"
+	"github.com/drone/drone-go/plugin/validator"
+	"github.com/drone/drone-go/plugin/webhook"
+)
+
+// Option configures a test request.
+type Option func(*options)
+
+type options struct {
+	keyID   string
+	encrypt bool
+	date    time.Time
+	header  http.Header
+}
+
+// WithKeyID returns an option to sign the request with the
+// named key. The default key is transport.DefaultKeyID.
+func WithKeyID(id string) Option {
+	return func(o *options) {
+		o.keyID = id
+	}
+}
+
+// WithEncryption returns an option to request an aesgcm
+// encrypted response body. The response is encrypted using
+// the shared secret, which must be at least 32 bytes.
+func WithEncryption() Option {
+	return func(o *options) {
+		o.encrypt = true
+	}
+}
+
+// WithDate returns an option to set the signed Date header,
+// for example to test request expiration.
+func WithDate(date time.Time) Option {
+	return func(o *options) {
+		o.date = date
+	}
+}
+
+// WithHeader returns an option to set an http header. The
+// header is set before the request is signed, and overrides
+// the headers set by the plugin clients.
+func WithHeader(key, value string) Option {
+	return func(o *options) {
+		o.header.Set(key, value)
+	}
+}
+
+// NewRequest returns a new http.Request with the JSON-encoded
+// body, signed with the shared secret. The accept parameter
+// is the media type of the plugin API, for example secret.V1.
+// The body is used as-is if it is a []byte or string.
+//
+// Like httptest.NewRequest, NewRequest panics on error since
+// it is intended for use in tests.
+func NewRequest(key, accept string, body interface{}, opts ...Option) *http.Request {
+	o := &options{
+		keyID:  transport.DefaultKeyID,
+		date:   time.Now(),
+		header: http.Header{},
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	var data []byte
+	switch v := body.(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		var err error
+		data, err = json.Marshal(body)
+		if err != nil {
+			panic("plugintest: cannot encode request body: " + err.Error())
+		}
+	}
+
+	encoding := "identity"
+	if o.encrypt {
+		encoding = "aesgcm"
+	}
+
+	// the request is signed like a plugin client request.
+	req := httptest.NewRequest("POST", "/", bytes.NewReader(data))
+	req.Header.Set("Accept", accept)
+	req.Header.Set("Accept-Encoding", encoding)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Date", o.date.UTC().Format(http.TimeFormat))
+	for k, v := range o.header {
+		req.Header[k] = v
+	}
+	if err := client.Sign(req, o.keyID, key, data); err != nil {
+		panic("plugintest: cannot sign request: " + err.Error())
+	}
+	return req
+}
+
+// SecretRequest returns a signed secret request.
+func SecretRequest(key string, in *secret.Request, opts ...Option) *http.Request {
+	return NewRequest(key, secret.V1, in, opts...)
+}
+
+// EnvironRequest returns a signed environ request using the
+// version 2 API.
+func EnvironRequest(key string, in *environ.Request, opts ...Option) *http.Request {
+	return NewRequest(key, environ.V2, in, opts...)
+}
+
+// EnvironV1Request returns a signed environ request using the
+// legacy version 1 API.
+func EnvironV1Request(key string, in *environ.Request, opts ...Option) *http.Request {
+	return NewRequest(key, environ.V1, in, opts...)
+}
+
+// RegistryRequest returns a signed registry request.
+func RegistryRequest(key string, in *registry.Request, opts ...Option) *http.Request {
+	return NewRequest(key, registry.V1, in, opts...)
+}
+
+// ConfigRequest returns a signed config request.
+func ConfigRequest(key string, in *config.Request, opts ...Option) *http.Request {
+	return NewRequest(key, config.V1, in, opts...)
+}
+
+// ConverterRequest returns a signed converter request.
+func ConverterRequest(key string, in *converter.Request, opts ...Option) *http.Request {
+	return NewRequest(key, converter.V1, in, opts...)
+}
+
+// ValidatorRequest returns a signed validator request.
+func ValidatorRequest(key string, in *validator.Request, opts ...Option) *http.Request {
+	return NewRequest(key, validator.V1, in, opts...)
+}
+
+// AdmissionRequest returns a signed admission request.
+func AdmissionRequest(key string, in *admission.Request, opts ...Option) *http.Request {
+	return NewRequest(key, admission.V1, in, opts...)
+}
+
+// WebhookRequest returns a signed webhook request.
+func WebhookRequest(key string, in *webhook.Request, opts ...Option) *http.Request {
+	return NewRequest(key, webhook.V1, in, opts...)
+}
+
+// Do serves the request using the handler and returns the
+// recorded response.
+func Do(handler http.Handler, req *http.Request) *http.Response {
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec.Result()
+}
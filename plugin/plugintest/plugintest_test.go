@@ -0,0 +1,153 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugintest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/drone-go/plugin/admission"
+	"github.com/drone/drone-go/plugin/config"
+	"github.com/drone/drone-go/plugin/converter"
+	"github.com/drone/drone-go/plugin/environ"
+	"github.com/drone/drone-go/plugin/registry"
+	"github.com/drone/drone-go/plugin/secret"
+	"github.com/drone/drone-go/plugin/validator"
+	"github.com/drone/drone-go/plugin/webhook"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const key = "xVKAGlWQiY3sOp8JVc0nbuNId3PNCgWh"
+
+func TestConformance(t *testing.T) {
+	t.Run("Secret", func(t *testing.T) {
+		TestSecret(t, secret.Handler(key, secretPlugin{}, nil), key, &secret.Request{Name: "password"})
+	})
+	t.Run("Environ", func(t *testing.T) {
+		TestEnviron(t, environ.Handler(key, environPlugin{}, nil), key, &environ.Request{})
+	})
+	t.Run("Registry", func(t *testing.T) {
+		TestRegistry(t, registry.Handler(key, registryPlugin{}, nil), key, &registry.Request{})
+	})
+	t.Run("Config", func(t *testing.T) {
+		TestConfig(t, config.Handler(configPlugin{}, key, nil), key, &config.Request{})
+	})
+	t.Run("Converter", func(t *testing.T) {
+		TestConverter(t, converter.Handler(converterPlugin{}, key, nil), key, &converter.Request{})
+	})
+	t.Run("Validator", func(t *testing.T) {
+		TestValidator(t, validator.Handler(key, validatorPlugin{}, nil), key, &validator.Request{})
+	})
+	t.Run("Admission", func(t *testing.T) {
+		TestAdmission(t, admission.Handler(admissionPlugin{}, key, nil), key, &admission.Request{})
+	})
+	t.Run("Webhook", func(t *testing.T) {
+		TestWebhook(t, webhook.Handler(webhookPlugin{}, key, nil), key, &webhook.Request{})
+	})
+}
+
+func TestDecode_Encrypted(t *testing.T) {
+	handler := environ.Handler(key, environPlugin{}, nil)
+	req := &environ.Request{}
+
+	got, err := DecodeVariables(Do(handler, EnvironRequest(key, req, WithEncryption())), key)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	want := []*environ.Variable{{Name: "GOOS", Data: "linux"}}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf(diff)
+	}
+
+	gotV1, err := DecodeVariablesV1(Do(handler, EnvironV1Request(key, req, WithEncryption())), key)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if diff := cmp.Diff(gotV1, map[string]string{"GOOS": "linux"}); diff != "" {
+		t.Errorf(diff)
+	}
+}
+
+func TestDecode_Error(t *testing.T) {
+	handler := secret.Handler(key, secretPlugin{}, nil)
+	res := Do(handler, SecretRequest("invalid", &secret.Request{}))
+
+	err := DecodeError(res)
+	if got, ok := err.(*drone.Error); !ok || got.Code != 400 || got.Message != "Invalid Signature" {
+		t.Errorf("Want decoded *drone.Error, got %v", err)
+	}
+}
+
+func TestDecodeValidation(t *testing.T) {
+	handler := validator.Handler(key, validatorPlugin{err: validator.ErrSkip}, nil)
+	res := Do(handler, ValidatorRequest(key, &validator.Request{}))
+	if err := DecodeValidation(res); err != validator.ErrSkip {
+		t.Errorf("Want ErrSkip, got %v", err)
+	}
+}
+
+type secretPlugin struct{}
+
+func (secretPlugin) Find(ctx context.Context, req *secret.Request) (*drone.Secret, error) {
+	return &drone.Secret{Name: req.Name, Data: "correct-horse-battery-staple"}, nil
+}
+
+type environPlugin struct{}
+
+func (environPlugin) List(ctx context.Context, req *environ.Request) ([]*environ.Variable, error) {
+	return []*environ.Variable{{Name: "GOOS", Data: "linux"}}, nil
+}
+
+type registryPlugin struct{}
+
+func (registryPlugin) List(ctx context.Context, req *registry.Request) ([]*drone.Registry, error) {
+	return []*drone.Registry{{Address: "docker.io", Username: "octocat", Password: "pa55word"}}, nil
+}
+
+type configPlugin struct{}
+
+func (configPlugin) Find(ctx context.Context, req *config.Request) (*drone.Config, error) {
+	return &drone.Config{Data: "kind: pipeline"}, nil
+}
+
+type converterPlugin struct{}
+
+func (converterPlugin) Convert(ctx context.Context, req *converter.Request) (*drone.Config, error) {
+	return nil, nil
+}
+
+type validatorPlugin struct {
+	err error
+}
+
+func (p validatorPlugin) Validate(ctx context.Context, req *validator.Request) error {
+	return p.err
+}
+
+type admissionPlugin struct{}
+
+func (admissionPlugin) Admit(ctx context.Context, req *admission.Request) (*drone.User, error) {
+	return &req.User, nil
+}
+
+type webhookPlugin struct{}
+
+func (webhookPlugin) Deliver(ctx context.Context, req *webhook.Request) error {
+	return nil
+}
@@ -0,0 +1,134 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package policy provides access policies that restrict the
+// builds a secret or credential is made available to.
+package policy
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/drone/drone-go/drone"
+)
+
+// Policy defines the conditions under which a secret or
+// credential is made available to a build. The zero value
+// allows every repository, branch and event, except pull
+// requests.
+type Policy struct {
+	// Repos is an optional list of repository slug glob
+	// patterns, for example octocat/*. If empty, all
+	// repositories are allowed.
+	Repos []string `json:"repos,omitempty" yaml:"repos,omitempty"`
+
+	// Branches is an optional list of branch glob patterns,
+	// matched against the build target branch. If empty,
+	// all branches are allowed.
+	Branches []string `json:"branches,omitempty" yaml:"branches,omitempty"`
+
+	// Events is an optional list of build events, for
+	// example push or tag. If empty, all events are allowed.
+	Events []string `json:"events,omitempty" yaml:"events,omitempty"`
+
+	// PullRequest allows pull requests from the repository.
+	PullRequest bool `json:"pull_request,omitempty" yaml:"pull_request,omitempty"`
+
+	// Fork allows pull requests from forks.
+	Fork bool `json:"fork,omitempty" yaml:"fork,omitempty"`
+
+	// Trusted allows only trusted repositories.
+	Trusted bool `json:"trusted,omitempty" yaml:"trusted,omitempty"`
+}
+
+// Denial is returned when a policy denies a build.
+type Denial struct {
+	Reason string
+}
+
+func (e *Denial) Error() string {
+	return "access denied: " + e.Reason
+}
+
+// Validate returns an error if a glob pattern is malformed.
+func (p *Policy) Validate() error {
+	for _, patterns := range [][]string{p.Repos, p.Branches} {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("policy: invalid pattern %q: %s", pattern, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Check returns nil if the policy allows the build, or a
+// *Denial that describes why the build is denied.
+func (p *Policy) Check(repo drone.Repo, build drone.Build) error {
+	if p.Trusted && !repo.Trusted {
+		return deny("repository %s is not trusted", repo.Slug)
+	}
+	if len(p.Repos) != 0 && !Match(p.Repos, repo.Slug) {
+		return deny("repository %s does not match %v", repo.Slug, p.Repos)
+	}
+	if len(p.Events) != 0 && !contains(p.Events, build.Event) {
+		return deny("event %s does not match %v", build.Event, p.Events)
+	}
+	if build.Event == drone.EventPullRequest {
+		if IsFork(repo, build) {
+			if !p.Fork {
+				return deny("pull requests from fork %s are not allowed", build.Fork)
+			}
+		} else if !p.PullRequest {
+			return deny("pull requests are not allowed")
+		}
+	}
+	if len(p.Branches) != 0 && !Match(p.Branches, build.Target) {
+		return deny("branch %s does not match %v", build.Target, p.Branches)
+	}
+	return nil
+}
+
+// IsFork returns true if the build is a pull request from a
+// fork of the repository.
+func IsFork(repo drone.Repo, build drone.Build) bool {
+	return build.Event == drone.EventPullRequest &&
+		build.Fork != "" &&
+		build.Fork != repo.Slug
+}
+
+func deny(format string, args ...interface{}) error {
+	return &Denial{Reason: fmt.Sprintf(format, args...)}
+}
+
+// Match returns true if the value matches one of the glob
+// patterns, using path.Match syntax. A malformed pattern does
+// not match any value.
+func Match(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, value); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,168 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"testing"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/drone-go/plugin"
+	"github.com/drone/drone-go/plugin/fixtures"
+	"github.com/drone/drone-go/plugin/logger"
+)
+
+func TestCheck(t *testing.T) {
+	repo := fixtures.NewRepo("octocat/hello-world")
+	tests := []struct {
+		name   string
+		policy Policy
+		repo   *fixtures.RepoBuilder
+		build  *fixtures.BuildBuilder
+		allow  bool
+	}{
+		{
+			name:  "zero policy allows push",
+			build: fixtures.NewBuild(),
+			allow: true,
+		},
+		{
+			name:  "zero policy denies pull request",
+			build: fixtures.NewBuild().PullRequest("feature", "master"),
+		},
+		{
+			name:   "pull request allowed",
+			policy: Policy{PullRequest: true},
+			build:  fixtures.NewBuild().PullRequest("feature", "master"),
+			allow:  true,
+		},
+		{
+			name:   "pull request from fork denied",
+			policy: Policy{PullRequest: true},
+			build:  fixtures.NewBuild().PullRequest("feature", "master").Fork("spaceghost/hello-world"),
+		},
+		{
+			name:   "pull request from fork allowed",
+			policy: Policy{Fork: true},
+			build:  fixtures.NewBuild().PullRequest("feature", "master").Fork("spaceghost/hello-world"),
+			allow:  true,
+		},
+		{
+			name:   "repository glob",
+			policy: Policy{Repos: []string{"octocat/*"}},
+			build:  fixtures.NewBuild(),
+			allow:  true,
+		},
+		{
+			name:   "repository glob mismatch",
+			policy: Policy{Repos: []string{"spaceghost/*"}},
+			build:  fixtures.NewBuild(),
+		},
+		{
+			name:   "branch glob",
+			policy: Policy{Branches: []string{"release/*"}},
+			build:  fixtures.NewBuild().Push("release/v1"),
+			allow:  true,
+		},
+		{
+			name:   "branch glob mismatch",
+			policy: Policy{Branches: []string{"master"}},
+			build:  fixtures.NewBuild().Push("develop"),
+		},
+		{
+			name:   "event",
+			policy: Policy{Events: []string{drone.EventTag, drone.EventPromote}},
+			build:  fixtures.NewBuild().Promote("production"),
+			allow:  true,
+		},
+		{
+			name:   "event mismatch",
+			policy: Policy{Events: []string{drone.EventTag}},
+			build:  fixtures.NewBuild(),
+		},
+		{
+			name:   "trusted",
+			policy: Policy{Trusted: true},
+			repo:   fixtures.NewRepo("octocat/hello-world").Trusted(),
+			build:  fixtures.NewBuild(),
+			allow:  true,
+		},
+		{
+			name:   "untrusted",
+			policy: Policy{Trusted: true},
+			build:  fixtures.NewBuild(),
+		},
+	}
+	for _, test := range tests {
+		r := test.repo
+		if r == nil {
+			r = repo
+		}
+		f := fixtures.New(r, test.build)
+		err := test.policy.Check(f.Repo, f.Build)
+		if test.allow && err != nil {
+			t.Errorf("%s: want allowed, got %s", test.name, err)
+		}
+		if !test.allow {
+			if _, ok := err.(*Denial); !ok {
+				t.Errorf("%s: want *Denial, got %v", test.name, err)
+			}
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	p := Policy{Repos: []string{"octocat/["}}
+	if err := p.Validate(); err == nil {
+		t.Errorf("Want error for malformed pattern")
+	}
+	p = Policy{Repos: []string{"octocat/*"}, Branches: []string{"release/*"}}
+	if err := p.Validate(); err != nil {
+		t.Errorf("Want valid patterns, got %s", err)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	patterns := []string{"octocat/*", "release/v[0-9]*"}
+	for value, want := range map[string]bool{
+		"octocat/hello-world":    true,
+		"release/v1":             true,
+		"spaceghost/hello-world": false,
+		"octocat/hello/world":    false,
+	} {
+		if got := Match(patterns, value); got != want {
+			t.Errorf("Want Match %v for %s, got %v", want, value, got)
+		}
+	}
+	if Match([]string{"octocat/["}, "octocat/[") {
+		t.Errorf("Want malformed pattern not matched")
+	}
+}
+
+func TestFindSecret(t *testing.T) {
+	p := &Policy{Branches: []string{"master"}, PullRequest: true}
+	req := fixtures.New(nil, fixtures.NewBuild().Push("master")).SecretRequest("docker", "password")
+	res, err := FindSecret(p, "correct-horse", req, logger.Discard())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Name != "password" || res.Data != "correct-horse" || !res.PullRequest {
+		t.Errorf("Unexpected secret %+v", res)
+	}
+
+	req = fixtures.New(nil, fixtures.NewBuild().Push("develop")).SecretRequest("docker", "password")
+	if _, err := FindSecret(p, "correct-horse", req, logger.Discard()); err != plugin.ErrNotFound {
+		t.Errorf("Want denied secret reported as not found, got %v", err)
+	}
+}
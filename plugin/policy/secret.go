@@ -0,0 +1,58 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/drone-go/plugin"
+	"github.com/drone/drone-go/plugin/logger"
+	"github.com/drone/drone-go/plugin/secret"
+)
+
+// FindSecret returns the secret for the request if the policy
+// allows the build. The policy and data are the access policy
+// and data of the secret found by the secret provider.
+//
+// A denied request is logged as a warning and reported as
+// plugin.ErrNotFound, so that the response does not reveal the
+// secret exists.
+func FindSecret(p *Policy, data string, req *secret.Request, logs logger.Logger) (*drone.Secret, error) {
+	if err := p.Check(req.Repo, req.Build); err != nil {
+		logs.Warnf("secrets: denied secret %s to %s build %d (%s): %s",
+			qualify(req.Path, req.Name),
+			req.Repo.Slug,
+			req.Build.Number,
+			req.Build.Event,
+			err,
+		)
+		return nil, plugin.ErrNotFound
+	}
+	return &drone.Secret{
+		Name: req.Name,
+		Data: data,
+		// the policy already restricts pull requests, but the
+		// server also requires the secret to opt in to pull
+		// requests.
+		PullRequest: p.PullRequest || p.Fork,
+	}, nil
+}
+
+// qualify returns the secret name qualified by the path.
+func qualify(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "#" + name
+}
@@ -0,0 +1,65 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"context"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/drone-go/plugin/cache"
+)
+
+// Cached returns a Plugin that caches the registry credentials
+// returned by the underlying plugin. Credentials are keyed by
+// every repository and build field that can be read by an
+// access policy, so cached credentials are shared by the
+// stages of a build, but not by other builds.
+func Cached(plugin Plugin, c *cache.Cache) Plugin {
+	return &cachedPlugin{
+		plugin: plugin,
+		cache:  c,
+	}
+}
+
+type cachedPlugin struct {
+	plugin Plugin
+	cache  *cache.Cache
+}
+
+func (c *cachedPlugin) List(ctx context.Context, req *Request) ([]*drone.Registry, error) {
+	key := cache.Key(
+		"registry",
+		cache.Repo(req.Repo),
+		cache.Build(req.Build),
+	)
+	v, err := c.cache.Get(ctx, key, func(ctx context.Context) (interface{}, error) {
+		return c.plugin.List(ctx, req)
+	})
+	// return a copy so that the caller cannot modify the
+	// cached credentials.
+	cached, _ := v.([]*drone.Registry)
+	if cached == nil {
+		return nil, err
+	}
+	res := make([]*drone.Registry, len(cached))
+	for i, registry := range cached {
+		if registry == nil {
+			continue
+		}
+		copy := *registry
+		res[i] = &copy
+	}
+	return res, err
+}
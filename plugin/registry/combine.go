@@ -0,0 +1,74 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"context"
+	"sync"
+
+	"github.com/drone/drone-go/drone"
+)
+
+// Merge returns a Plugin that queries the plugins in parallel
+// and concatenates the registry credentials in plugin order.
+// If multiple plugins return credentials for the same registry
+// address, the credentials returned by the later plugin take
+// precedence. If any plugin returns an error, the first error
+// is returned.
+func Merge(plugins ...Plugin) Plugin {
+	return &merge{plugins: plugins}
+}
+
+type merge struct {
+	plugins []Plugin
+}
+
+func (p *merge) List(ctx context.Context, req *Request) ([]*drone.Registry, error) {
+	results := make([][]*drone.Registry, len(p.plugins))
+	errs := make([]error, len(p.plugins))
+
+	var wg sync.WaitGroup
+	for i, plugin := range p.plugins {
+		wg.Add(1)
+		go func(i int, plugin Plugin) {
+			defer wg.Done()
+			results[i], errs[i] = plugin.List(ctx, req)
+		}(i, plugin)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var out []*drone.Registry
+	index := map[string]int{}
+	for _, result := range results {
+		for _, r := range result {
+			if r == nil {
+				continue
+			}
+			if i, ok := index[r.Address]; ok {
+				out[i] = r
+				continue
+			}
+			index[r.Address] = len(out)
+			out = append(out, r)
+		}
+	}
+	return out, nil
+}
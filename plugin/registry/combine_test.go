@@ -0,0 +1,56 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMerge(t *testing.T) {
+	plugin := Merge(
+		&mockPlugin{res: []*drone.Registry{
+			{Address: "index.docker.io", Username: "octocat"},
+			{Address: "gcr.io", Username: "_json_key"},
+		}},
+		&mockPlugin{res: []*drone.Registry{
+			{Address: "quay.io", Username: "octocat"},
+			{Address: "index.docker.io", Username: "spaceghost"},
+		}},
+	)
+	got, err := plugin.List(context.Background(), &Request{})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	want := []*drone.Registry{
+		{Address: "index.docker.io", Username: "spaceghost"},
+		{Address: "gcr.io", Username: "_json_key"},
+		{Address: "quay.io", Username: "octocat"},
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf(diff)
+	}
+
+	errFoo := errors.New("foo")
+	plugin = Merge(&mockPlugin{}, &mockPlugin{err: errFoo})
+	if _, err := plugin.List(context.Background(), &Request{}); err != errFoo {
+		t.Errorf("Want error returned, got %v", err)
+	}
+}
@@ -0,0 +1,349 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package docker provides a registry plugin that serves
+// registry credentials from docker config.json files.
+//
+// The credentials are loaded from the auths section of the
+// config files, for example:
+//
+//	{
+//	  "auths": {
+//	    "https://index.docker.io/v1/": { "auth": "b2N0b2NhdDpjb3JyZWN0LWhvcnNl" },
+//	    "gcr.io": { "identitytoken": "ya29.token" }
+//	  }
+//	}
+//
+// Rules restrict the builds that receive the credentials for a
+// registry. Each rule has an access policy:
+//
+//   - registries: [ "*.dkr.ecr.us-east-1.amazonaws.com" ]
+//     namespaces: [ "octocat" ]
+//     events: [ push, tag ]
+//     fork: false
+//     trusted: true
+//     registry_policy: push-pull
+//
+// Pull requests from forks never receive credentials unless a
+// rule sets fork: true. Pull requests from the repository
+// receive the credentials allowed by the rules, unless a rule
+// restricts the events.
+package docker
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/drone-go/plugin/logger"
+	"github.com/drone/drone-go/plugin/policy"
+	"github.com/drone/drone-go/plugin/registry"
+)
+
+// Config configures the docker config registry plugin.
+type Config struct {
+	// Files are the paths of the docker config.json files.
+	// A registry defined in multiple files is loaded from the
+	// last file.
+	Files []string
+
+	// Rules are the optional registry rules. If empty, the
+	// credentials for every registry are returned to every
+	// build, except pull requests from forks. Otherwise the
+	// credentials for a registry are returned if a rule
+	// matches the registry and allows the build.
+	Rules []*Rule
+}
+
+// Rule restricts the builds that receive the credentials for
+// the matching registries. Unlike a secret policy, a rule
+// allows pull requests from the repository, so the
+// pull_request field has no effect. Pull requests from forks
+// are denied unless the rule sets fork.
+type Rule struct {
+	// Registries is an optional list of registry address glob
+	// patterns. If empty, the rule matches all registries.
+	Registries []string `json:"registries,omitempty" yaml:"registries,omitempty"`
+
+	// Namespaces is an optional list of repository namespace
+	// glob patterns. If empty, all namespaces are allowed.
+	Namespaces []string `json:"namespaces,omitempty" yaml:"namespaces,omitempty"`
+
+	// RegistryPolicy is the optional registry policy of the
+	// returned credentials: pull, push or push-pull. Pull
+	// requests never receive push or push-pull credentials.
+	RegistryPolicy string `json:"registry_policy,omitempty" yaml:"registry_policy,omitempty"`
+
+	policy.Policy `yaml:",inline"`
+}
+
+// Validate returns an error if the rule is invalid.
+func (r *Rule) Validate() error {
+	for _, patterns := range [][]string{r.Registries, r.Namespaces} {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("docker: invalid pattern %q: %s", pattern, err)
+			}
+		}
+	}
+	switch r.RegistryPolicy {
+	case "", drone.RegistryPull, drone.RegistryPush, drone.RegistryPushPull:
+	default:
+		return fmt.Errorf("docker: invalid registry policy %q", r.RegistryPolicy)
+	}
+	return r.Policy.Validate()
+}
+
+// match returns true if the rule matches the registry.
+func (r *Rule) match(address string) bool {
+	return len(r.Registries) == 0 || policy.Match(r.Registries, address)
+}
+
+// check returns nil if the rule allows the build.
+func (r *Rule) check(repo drone.Repo, build drone.Build) error {
+	if len(r.Namespaces) != 0 && !policy.Match(r.Namespaces, repo.Namespace) {
+		return &policy.Denial{Reason: fmt.Sprintf("namespace %s does not match %v", repo.Namespace, r.Namespaces)}
+	}
+	if build.Event == drone.EventPullRequest && r.RegistryPolicy != "" && r.RegistryPolicy != drone.RegistryPull {
+		return &policy.Denial{Reason: fmt.Sprintf("pull requests cannot receive %s credentials", r.RegistryPolicy)}
+	}
+	p := r.Policy
+	if !policy.IsFork(repo, build) {
+		p.PullRequest = true
+	}
+	return p.Check(repo, build)
+}
+
+// New returns a registry plugin that serves registry
+// credentials from docker config.json files.
+//
+// The files are reloaded when modified. If the reload fails,
+// the error is logged and the previously loaded credentials
+// continue to be served. Requests denied by a rule are logged
+// as warnings.
+func New(config Config, logs logger.Logger) (registry.Plugin, error) {
+	if logs == nil {
+		logs = logger.Discard()
+	}
+	if len(config.Files) == 0 {
+		return nil, fmt.Errorf("docker: missing config file")
+	}
+	for _, rule := range config.Rules {
+		if err := rule.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	s := &store{
+		files:   config.Files,
+		rules:   config.Rules,
+		logger:  logs,
+		modtime: make([]time.Time, len(config.Files)),
+	}
+	if err := s.reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+type store struct {
+	files  []string
+	rules  []*Rule
+	logger logger.Logger
+
+	mu         sync.Mutex
+	registries []*drone.Registry
+	modtime    []time.Time
+}
+
+func (s *store) List(ctx context.Context, req *registry.Request) ([]*drone.Registry, error) {
+	s.mu.Lock()
+	if err := s.reload(); err != nil {
+		s.logger.Errorf("registry: cannot reload docker config: %s", err)
+	}
+	registries := s.registries
+	s.mu.Unlock()
+
+	var res []*drone.Registry
+	for _, found := range registries {
+		copy := *found
+		rule, err := s.check(found.Address, req)
+		if err != nil {
+			s.logger.Warnf("registry: denied registry %s to %s build %d (%s): %s",
+				found.Address,
+				req.Repo.Slug,
+				req.Build.Number,
+				req.Build.Event,
+				err,
+			)
+			continue
+		}
+		if rule != nil {
+			copy.Policy = rule.RegistryPolicy
+		}
+		res = append(res, &copy)
+	}
+	return res, nil
+}
+
+// check returns the first rule that matches the registry and
+// allows the build. If there are no rules, check returns a nil
+// rule, unless the build is a pull request from a fork.
+func (s *store) check(address string, req *registry.Request) (*Rule, error) {
+	if len(s.rules) == 0 {
+		if policy.IsFork(req.Repo, req.Build) {
+			return nil, &policy.Denial{Reason: fmt.Sprintf("pull requests from fork %s are not allowed", req.Build.Fork)}
+		}
+		return nil, nil
+	}
+	var err error = &policy.Denial{Reason: "no matching rule"}
+	for _, rule := range s.rules {
+		if !rule.match(address) {
+			continue
+		}
+		if err = rule.check(req.Repo, req.Build); err == nil {
+			return rule, nil
+		}
+	}
+	return nil, err
+}
+
+// reload loads the registries if a file was modified since the
+// last load. The caller must hold the lock, except when called
+// from the constructor.
+func (s *store) reload() error {
+	modified := s.registries == nil
+	modtime := make([]time.Time, len(s.files))
+	for i, file := range s.files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+		modtime[i] = info.ModTime()
+		if !modtime[i].Equal(s.modtime[i]) {
+			modified = true
+		}
+	}
+	if !modified {
+		return nil
+	}
+	index := map[string]*drone.Registry{}
+	for _, file := range s.files {
+		registries, err := parse(file)
+		if err != nil {
+			return err
+		}
+		for _, entry := range registries {
+			index[entry.Address] = entry
+		}
+	}
+	registries := []*drone.Registry{}
+	for _, entry := range index {
+		registries = append(registries, entry)
+	}
+	sort.Slice(registries, func(i, j int) bool {
+		return registries[i].Address < registries[j].Address
+	})
+	s.registries = registries
+	s.modtime = modtime
+	return nil
+}
+
+type (
+	// configFile is the docker config.json file.
+	configFile struct {
+		Auths map[string]auth `json:"auths"`
+	}
+
+	// auth is the docker config.json registry auth.
+	auth struct {
+		Auth          string `json:"auth"`
+		Username      string `json:"username"`
+		Password      string `json:"password"`
+		Email         string `json:"email"`
+		IdentityToken string `json:"identitytoken"`
+		RegistryToken string `json:"registrytoken"`
+	}
+)
+
+// parse parses the registries from the docker config file.
+func parse(file string) ([]*drone.Registry, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	out := new(configFile)
+	if err := json.Unmarshal(data, out); err != nil {
+		return nil, fmt.Errorf("%s: %s", file, err)
+	}
+	var registries []*drone.Registry
+	for address, auth := range out.Auths {
+		entry := &drone.Registry{
+			Address:  hostname(address),
+			Username: auth.Username,
+			Password: auth.Password,
+			Email:    auth.Email,
+			Token:    auth.IdentityToken,
+		}
+		if auth.RegistryToken != "" {
+			entry.Token = auth.RegistryToken
+		}
+		if auth.Auth != "" {
+			username, password, err := decode(auth.Auth)
+			if err != nil {
+				return nil, fmt.Errorf("%s: registry %s: %s", file, address, err)
+			}
+			entry.Username = username
+			entry.Password = password
+		}
+		registries = append(registries, entry)
+	}
+	return registries, nil
+}
+
+// decode decodes the base64 encoded username and password.
+func decode(s string) (string, string, error) {
+	data, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid auth: %s", err)
+	}
+	parts := strings.SplitN(string(data), ":", 2)
+	if len(parts) != 2 {
+		return "", "", fmt.Errorf("invalid auth: missing password")
+	}
+	return parts[0], parts[1], nil
+}
+
+// hostname returns the registry hostname, for example
+// index.docker.io for https://index.docker.io/v1/.
+func hostname(address string) string {
+	if strings.Contains(address, "://") {
+		if u, err := url.Parse(address); err == nil && u.Host != "" {
+			return u.Host
+		}
+	}
+	if i := strings.Index(address, "/"); i != -1 {
+		return address[:i]
+	}
+	return address
+}
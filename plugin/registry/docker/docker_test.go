@@ -0,0 +1,258 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package docker
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/drone-go/plugin/fixtures"
+	"github.com/drone/drone-go/plugin/logger"
+	"github.com/drone/drone-go/plugin/policy"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const dockerconfig = `{
+  "auths": {
+    "https://index.docker.io/v1/": { "auth": "b2N0b2NhdDpjb3JyZWN0OmhvcnNl" },
+    "gcr.io": { "identitytoken": "ya29.token" },
+    "quay.io": { "username": "octocat", "password": "battery-staple", "email": "octocat@github.com" }
+  }
+}`
+
+const dockerconfigOverride = `{
+  "auths": {
+    "quay.io": { "registrytoken": "quay.token" }
+  }
+}`
+
+func setup(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "drone-registry-docker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ioutil.WriteFile(filepath.Join(dir, "config.json"), []byte(dockerconfig), 0600)
+	ioutil.WriteFile(filepath.Join(dir, "override.json"), []byte(dockerconfigOverride), 0600)
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func TestList(t *testing.T) {
+	dir, cleanup := setup(t)
+	defer cleanup()
+
+	p, err := New(Config{Files: []string{filepath.Join(dir, "config.json")}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := fixtures.New(fixtures.NewRepo("octocat/hello-world"), fixtures.NewBuild())
+	got, err := p.List(context.Background(), f.RegistryRequest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*drone.Registry{
+		{Address: "gcr.io", Token: "ya29.token"},
+		{Address: "index.docker.io", Username: "octocat", Password: "correct:horse"},
+		{Address: "quay.io", Username: "octocat", Password: "battery-staple", Email: "octocat@github.com"},
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("Unexpected registries")
+		t.Log(diff)
+	}
+
+	// pull requests from the repository receive the
+	// credentials.
+	f = fixtures.New(fixtures.NewRepo("octocat/hello-world"), fixtures.NewBuild().PullRequest("feature", "master"))
+	if got, _ := p.List(context.Background(), f.RegistryRequest()); len(got) != 3 {
+		t.Errorf("Want credentials for pull requests, got %d registries", len(got))
+	}
+}
+
+func TestList_Fork(t *testing.T) {
+	dir, cleanup := setup(t)
+	defer cleanup()
+
+	logs := &recorder{Logger: logger.Discard()}
+	p, err := New(Config{Files: []string{filepath.Join(dir, "config.json")}}, logs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	build := fixtures.NewBuild().PullRequest("feature", "master").Fork("spaceghost/hello-world")
+	f := fixtures.New(fixtures.NewRepo("octocat/hello-world"), build)
+	got, err := p.List(context.Background(), f.RegistryRequest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Errorf("Want no credentials for pull requests from forks, got %d registries", len(got))
+	}
+	if !strings.Contains(logs.last, "denied registry") {
+		t.Errorf("Want denial logged as a warning, got %q", logs.last)
+	}
+}
+
+func TestList_Override(t *testing.T) {
+	dir, cleanup := setup(t)
+	defer cleanup()
+
+	p, err := New(Config{Files: []string{
+		filepath.Join(dir, "config.json"),
+		filepath.Join(dir, "override.json"),
+	}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := fixtures.New(fixtures.NewRepo("octocat/hello-world"), fixtures.NewBuild())
+	got, _ := p.List(context.Background(), f.RegistryRequest())
+	if len(got) != 3 || got[2].Address != "quay.io" || got[2].Token != "quay.token" || got[2].Password != "" {
+		t.Errorf("Want registry loaded from the last file, got %+v", got[2])
+	}
+}
+
+func TestList_Rules(t *testing.T) {
+	dir, cleanup := setup(t)
+	defer cleanup()
+
+	rules := []*Rule{
+		{
+			Registries:     []string{"gcr.io"},
+			Namespaces:     []string{"octo*"},
+			RegistryPolicy: drone.RegistryPushPull,
+			Policy:         policy.Policy{Trusted: true},
+		},
+		{
+			Registries:     []string{"*.docker.io"},
+			RegistryPolicy: drone.RegistryPull,
+		},
+	}
+	p, err := New(Config{Files: []string{filepath.Join(dir, "config.json")}, Rules: rules}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	trusted := fixtures.NewRepo("octocat/hello-world").Trusted()
+	tests := []struct {
+		name string
+		f    *fixtures.Fixture
+		want []string
+	}{
+		{
+			name: "trusted push",
+			f:    fixtures.New(trusted, fixtures.NewBuild()),
+			want: []string{"gcr.io:push-pull", "index.docker.io:pull"},
+		},
+		{
+			name: "untrusted push",
+			f:    fixtures.New(fixtures.NewRepo("octocat/hello-world"), fixtures.NewBuild()),
+			want: []string{"index.docker.io:pull"},
+		},
+		{
+			name: "namespace",
+			f:    fixtures.New(fixtures.NewRepo("spaceghost/hello-world").Trusted(), fixtures.NewBuild()),
+			want: []string{"index.docker.io:pull"},
+		},
+		{
+			name: "pull request",
+			f:    fixtures.New(trusted, fixtures.NewBuild().PullRequest("feature", "master")),
+			want: []string{"index.docker.io:pull"},
+		},
+		{
+			name: "fork",
+			f:    fixtures.New(trusted, fixtures.NewBuild().PullRequest("feature", "master").Fork("spaceghost/hello-world")),
+			want: nil,
+		},
+	}
+	for _, test := range tests {
+		res, err := p.List(context.Background(), test.f.RegistryRequest())
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		var got []string
+		for _, r := range res {
+			got = append(got, r.Address+":"+r.Policy)
+		}
+		if diff := cmp.Diff(got, test.want); diff != "" {
+			t.Errorf("Unexpected registries for %s", test.name)
+			t.Log(diff)
+		}
+	}
+}
+
+func TestList_Reload(t *testing.T) {
+	dir, cleanup := setup(t)
+	defer cleanup()
+
+	path := filepath.Join(dir, "config.json")
+	p, _ := New(Config{Files: []string{path}}, nil)
+	f := fixtures.New(fixtures.NewRepo("octocat/hello-world"), fixtures.NewBuild())
+
+	ioutil.WriteFile(path, []byte(dockerconfigOverride), 0600)
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(path, future, future)
+	got, _ := p.List(context.Background(), f.RegistryRequest())
+	if len(got) != 1 || got[0].Token != "quay.token" {
+		t.Errorf("Want registries reloaded, got %+v", got)
+	}
+
+	// an invalid file is logged and the previous registries
+	// continue to be served.
+	ioutil.WriteFile(path, []byte("{"), 0600)
+	future = future.Add(time.Minute)
+	os.Chtimes(path, future, future)
+	got, _ = p.List(context.Background(), f.RegistryRequest())
+	if len(got) != 1 {
+		t.Errorf("Want previous registries served, got %+v", got)
+	}
+}
+
+func TestNew_Invalid(t *testing.T) {
+	dir, cleanup := setup(t)
+	defer cleanup()
+
+	path := filepath.Join(dir, "config.json")
+	configs := []Config{
+		{},
+		{Files: []string{filepath.Join(dir, "missing.json")}},
+		{Files: []string{path}, Rules: []*Rule{{Registries: []string{"["}}}},
+		{Files: []string{path}, Rules: []*Rule{{RegistryPolicy: "pull-push"}}},
+	}
+	for _, config := range configs {
+		if _, err := New(config, nil); err == nil {
+			t.Errorf("Want error for invalid config %+v", config)
+		}
+	}
+
+	ioutil.WriteFile(path, []byte(`{"auths":{"gcr.io":{"auth":"b2N0b2NhdA=="}}}`), 0600)
+	if _, err := New(Config{Files: []string{path}}, nil); err == nil {
+		t.Errorf("Want error for auth without password")
+	}
+}
+
+type recorder struct {
+	logger.Logger
+	last string
+}
+
+func (r *recorder) Warnf(format string, args ...interface{}) {
+	r.last = fmt.Sprintf(format, args...)
+}
@@ -0,0 +1,188 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package exec provides a registry plugin that gets registry
+// credentials from a docker credential helper, such as
+// docker-credential-ecr-login.
+//
+// The plugin runs the helper get command for each configured
+// registry, using the docker credential helper protocol. The
+// helper receives the registry address on stdin and writes the
+// credentials as JSON to stdout, for example:
+//
+//	{"ServerURL": "index.docker.io", "Username": "octocat", "Secret": "correct-horse-battery-staple"}
+//
+// Registries that have no credentials are skipped. If the helper
+// fails for a registry, the error is logged and the registry is
+// skipped, unless the helper fails for every registry.
+package exec
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/drone-go/plugin/cache"
+	"github.com/drone/drone-go/plugin/internal/command"
+	"github.com/drone/drone-go/plugin/logger"
+	"github.com/drone/drone-go/plugin/registry"
+)
+
+// errCredentialsNotFound is the message the docker credential
+// helpers write when the registry has no credentials.
+const errCredentialsNotFound = "credentials not found in native keychain"
+
+// tokenUsername is the username the docker credential helpers
+// return for an identity token.
+const tokenUsername = "<token>"
+
+// Config configures the exec registry plugin.
+type Config struct {
+	// Command is the name or path of the docker credential
+	// helper, for example docker-credential-ecr-login.
+	Command string
+
+	// Registries are the registry addresses passed to the
+	// helper.
+	Registries []string
+
+	// Env is the environment allowlist of the helper. See
+	// command.Command for the format of the entries.
+	Env []string
+
+	// Timeout is the maximum command duration. If zero, the
+	// command.DefaultTimeout is used.
+	Timeout time.Duration
+
+	// TTL is the duration the credentials are cached. If
+	// zero, the credentials are not cached.
+	TTL time.Duration
+
+	// Logger is an optional logger that receives the helper
+	// errors for registries that are skipped.
+	Logger logger.Logger
+}
+
+// New returns a registry plugin that gets registry credentials
+// from a docker credential helper.
+func New(config Config) (registry.Plugin, error) {
+	if config.Command == "" {
+		return nil, fmt.Errorf("exec: missing command")
+	}
+	if len(config.Registries) == 0 {
+		return nil, fmt.Errorf("exec: missing registries")
+	}
+	p := &provider{
+		registries: config.Registries,
+		logger:     config.Logger,
+		command: &command.Command{
+			Path:    config.Command,
+			Args:    []string{"get"},
+			Env:     config.Env,
+			Timeout: config.Timeout,
+		},
+	}
+	if config.TTL > 0 {
+		p.cache = cache.New(cache.Config{
+			TTL:         config.TTL,
+			NegativeTTL: config.TTL,
+		})
+	}
+	if p.logger == nil {
+		p.logger = logger.Discard()
+	}
+	return p, nil
+}
+
+type provider struct {
+	registries []string
+	command    *command.Command
+	cache      *cache.Cache
+	logger     logger.Logger
+}
+
+// credentials is the docker credential helper get response.
+type credentials struct {
+	ServerURL string
+	Username  string
+	Secret    string
+}
+
+func (p *provider) List(ctx context.Context, req *registry.Request) ([]*drone.Registry, error) {
+	var res []*drone.Registry
+	var failed int
+	var first error
+	for _, address := range p.registries {
+		found, err := p.find(ctx, address)
+		if err != nil {
+			p.logger.Errorf("registry: cannot get credentials for %s: %s", address, err)
+			if first == nil {
+				first = err
+			}
+			failed++
+			continue
+		}
+		if found != nil {
+			// return a copy so that the caller cannot modify
+			// the cached credentials.
+			copy := *found
+			res = append(res, &copy)
+		}
+	}
+	if failed == len(p.registries) {
+		return nil, first
+	}
+	return res, nil
+}
+
+// find returns the registry credentials, from the cache if
+// caching is enabled.
+func (p *provider) find(ctx context.Context, address string) (*drone.Registry, error) {
+	if p.cache == nil {
+		return p.get(ctx, address)
+	}
+	v, err := p.cache.Get(ctx, "registry\x00"+address, func(ctx context.Context) (interface{}, error) {
+		return p.get(ctx, address)
+	})
+	found, _ := v.(*drone.Registry)
+	return found, err
+}
+
+// get runs the helper get command. It returns nil if the
+// registry has no credentials.
+func (p *provider) get(ctx context.Context, address string) (*drone.Registry, error) {
+	out, err := p.command.Run(ctx, []byte(address))
+	if err != nil {
+		if strings.Contains(string(out), errCredentialsNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	creds := new(credentials)
+	if err := json.Unmarshal(bytes.TrimSpace(out), creds); err != nil {
+		return nil, fmt.Errorf("exec: %s: invalid output: %s", p.command.Path, err)
+	}
+	res := &drone.Registry{Address: address}
+	if creds.Username == tokenUsername {
+		res.Token = creds.Secret
+	} else {
+		res.Username = creds.Username
+		res.Password = creds.Secret
+	}
+	return res, nil
+}
@@ -0,0 +1,159 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exec
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/drone-go/plugin"
+	"github.com/drone/drone-go/plugin/registry"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// script is a fake docker credential helper.
+const script = `#!/bin/sh
+echo x >> "$COUNT"
+if [ "$1" != "get" ]; then
+	echo "unknown command $1" >&2
+	exit 1
+fi
+case "$(cat)" in
+index.docker.io)
+	echo '{"ServerURL":"index.docker.io","Username":"octocat","Secret":"correct-horse"}' ;;
+gcr.io)
+	echo '{"ServerURL":"gcr.io","Username":"<token>","Secret":"ya29.token"}' ;;
+quay.io)
+	echo "credentials not found in native keychain"
+	exit 1 ;;
+*)
+	echo "connection refused" >&2
+	exit 1 ;;
+esac
+`
+
+func setup(t *testing.T) (Config, string, func()) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping shell script tests on windows")
+	}
+	dir, err := ioutil.TempDir("", "drone-registry-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "docker-credential-test")
+	if err := ioutil.WriteFile(path, []byte(script), 0700); err != nil {
+		t.Fatal(err)
+	}
+	count := filepath.Join(dir, "count")
+	config := Config{
+		Command:    path,
+		Registries: []string{"index.docker.io", "gcr.io", "quay.io"},
+		Env:        []string{"PATH", "COUNT=" + count},
+		Timeout:    time.Second,
+	}
+	return config, count, func() { os.RemoveAll(dir) }
+}
+
+func TestList(t *testing.T) {
+	config, _, cleanup := setup(t)
+	defer cleanup()
+
+	p, err := New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := p.List(context.Background(), &registry.Request{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*drone.Registry{
+		{Address: "index.docker.io", Username: "octocat", Password: "correct-horse"},
+		{Address: "gcr.io", Token: "ya29.token"},
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("Unexpected registry credentials")
+		t.Log(diff)
+	}
+}
+
+func TestList_Error(t *testing.T) {
+	config, _, cleanup := setup(t)
+	defer cleanup()
+
+	// a failing registry is skipped.
+	config.Registries = append(config.Registries, "registry.company.com")
+	p, _ := New(config)
+	res, err := p.List(context.Background(), &registry.Request{})
+	if err != nil {
+		t.Error(err)
+	}
+	if got, want := len(res), 2; got != want {
+		t.Errorf("Want %d registries when one registry fails, got %d", want, got)
+	}
+
+	// an error is returned if every registry fails.
+	config.Registries = []string{"registry.company.com"}
+	p, _ = New(config)
+	_, err = p.List(context.Background(), &registry.Request{})
+	if err == nil || !strings.Contains(err.Error(), "connection refused") {
+		t.Errorf("Want error with the helper stderr, got %v", err)
+	}
+	if !errors.Is(err, plugin.ErrUnavailable) {
+		t.Errorf("Want ErrUnavailable, got %v", err)
+	}
+}
+
+func TestList_Cache(t *testing.T) {
+	config, count, cleanup := setup(t)
+	defer cleanup()
+
+	config.TTL = time.Minute
+	p, _ := New(config)
+	for i := 0; i < 3; i++ {
+		res, err := p.List(context.Background(), &registry.Request{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// modify the result to verify the cached credentials
+		// are copied.
+		res[0].Password = ""
+	}
+	res, _ := p.List(context.Background(), &registry.Request{})
+	if res[0].Password != "correct-horse" {
+		t.Errorf("Want cached credentials copied")
+	}
+	data, _ := ioutil.ReadFile(count)
+	if got := strings.Count(string(data), "x"); got != 3 {
+		t.Errorf("Want helper output cached per registry, got %d invocations", got)
+	}
+}
+
+func TestNew_Invalid(t *testing.T) {
+	if _, err := New(Config{Registries: []string{"index.docker.io"}}); err == nil {
+		t.Errorf("Want error for missing command")
+	}
+	if _, err := New(Config{Command: "docker-credential-ecr-login"}); err == nil {
+		t.Errorf("Want error for missing registries")
+	}
+}
@@ -15,28 +15,40 @@
 package registry
 
 import (
-	"encoding/json"
 	"io/ioutil"
 	"net/http"
 
 	"github.com/drone/drone-go/plugin/internal/aesgcm"
 	"github.com/drone/drone-go/plugin/logger"
-
-	"github.com/99designs/httpsignatures-go"
+	"github.com/drone/drone-go/plugin/middleware"
 )
 
+// versions are the supported versions of the registry API.
+var versions = middleware.NewVersions(map[string]middleware.Codec{
+	V1: middleware.JSON,
+})
+
 // Handler returns a http.Handler that accepts JSON-encoded
 // HTTP requests for a secret, invokes the underlying secret
 // plugin, and writes the JSON-encoded secret to the HTTP response.
 //
 // The handler verifies the authenticity of the HTTP request
 // using the http-signature, and returns a 400 Bad Request if
-// the signature is missing or invalid.
+// the signature is missing or invalid. The handler also
+// verifies the request body matches the signed digest and the
+// signed date is within the allowed clock skew.
+//
+// The handler negotiates the API version using the Accept
+// header, and returns a 406 Not Acceptable if the client does
+// not accept a supported version.
 //
 // The handler can optionally encrypt the response body using
 // aesgcm if the HTTP request includes the Accept-Encoding header
-// set to aesgcm.
-func Handler(secret string, plugin Plugin, logs logger.Logger) http.Handler {
+// set to aesgcm. The response is encrypted with the secret that
+// matches the keyId of the request signature. Encryption is not
+// supported for requests signed with a private key, and the
+// handler returns a 406 Not Acceptable.
+func Handler(secret string, plugin Plugin, logs logger.Logger, opts ...middleware.Option) http.Handler {
 	handler := &handler{
 		secret: secret,
 		plugin: plugin,
@@ -45,7 +57,7 @@ func Handler(secret string, plugin Plugin, logs logger.Logger) http.Handler {
 	if handler.logger == nil {
 		handler.logger = logger.Discard()
 	}
-	return handler
+	return middleware.Wrap("registry", secret, handler.logger, handler, opts...)
 }
 
 type handler struct {
@@ -55,54 +67,55 @@ type handler struct {
 }
 
 func (p *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	signature, err := httpsignatures.FromRequest(r)
+	codec, err := versions.Negotiate(w, r)
 	if err != nil {
-		p.logger.Debugf("registry: invalid or missing signature in http.Request")
-		http.Error(w, "Invalid or Missing Signature", http.StatusBadRequest)
-		return
-	}
-	if !signature.IsValid(p.secret, r) {
-		p.logger.Debugf("registry: invalid signature in http.Request")
-		http.Error(w, "Invalid Signature", http.StatusBadRequest)
+		p.logger.Debugf("registry: unsupported media type: %s", r.Header.Get("Accept"))
+		middleware.WriteError(w, err, http.StatusNotAcceptable)
 		return
 	}
 
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		p.logger.Debugf("registry: cannot read http.Request body")
-		w.WriteHeader(http.StatusBadRequest)
+		middleware.WriteError(w, err, http.StatusBadRequest)
 		return
 	}
 
 	req := &Request{}
-	err = json.Unmarshal(body, req)
+	err = codec.Decode(body, req)
 	if err != nil {
 		p.logger.Debugf("registry: cannot unmarshal http.Request body")
-		http.Error(w, "Invalid Input", http.StatusBadRequest)
+		middleware.WriteError(w, middleware.ErrInvalidInput, http.StatusBadRequest)
 		return
 	}
 
 	auths, err := p.plugin.List(r.Context(), req)
 	if err != nil {
 		p.logger.Debugf("registry: cannot list registries: %s", err)
-		http.Error(w, err.Error(), http.StatusNotFound)
+		middleware.WriteError(w, err, http.StatusNotFound)
 		return
 	}
-	out, _ := json.Marshal(auths)
+	out, _ := codec.Encode(auths)
 
 	// If the client can optionally accept an encrypted
 	// response, we encrypt the payload body using secretbox.
 	if r.Header.Get("Accept-Encoding") == "aesgcm" {
-		key, err := aesgcm.Key(p.secret)
+		shared, ok := middleware.SecretFrom(r.Context(), p.secret)
+		if !ok {
+			p.logger.Debugf("registry: cannot encrypt response without a shared secret")
+			middleware.WriteError(w, middleware.ErrEncryptionUnsupported, http.StatusNotAcceptable)
+			return
+		}
+		key, err := aesgcm.Key(shared)
 		if err != nil {
 			p.logger.Errorf("registry: invalid encryption key: %s", err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			middleware.WriteError(w, err, http.StatusInternalServerError)
 			return
 		}
 		out, err = aesgcm.Encrypt(out, key)
 		if err != nil {
 			p.logger.Errorf("registry: cannot encrypt message: %s", err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			middleware.WriteError(w, err, http.StatusInternalServerError)
 			return
 		}
 		w.Header().Set("Content-Encoding", "aesgcm")
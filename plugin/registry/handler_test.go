@@ -25,8 +25,7 @@ import (
 
 	"github.com/drone/drone-go/drone"
 	"github.com/drone/drone-go/plugin/internal/aesgcm"
-
-	"github.com/99designs/httpsignatures-go"
+	"github.com/drone/drone-go/plugin/internal/testutil"
 )
 
 func TestHandler(t *testing.T) {
@@ -39,7 +38,7 @@ func TestHandler(t *testing.T) {
 	req := httptest.NewRequest("GET", "/", buf)
 	req.Header.Add("Date", time.Now().UTC().Format(http.TimeFormat))
 
-	err := httpsignatures.DefaultSha256Signer.AuthRequest("hmac-key", key, req)
+	err := testutil.Sign(req, key)
 	if err != nil {
 		t.Error(err)
 		return
@@ -88,7 +87,7 @@ func TestHandler_Encrypted(t *testing.T) {
 	req.Header.Add("Date", time.Now().UTC().Format(http.TimeFormat))
 	req.Header.Add("Accept-Encoding", "aesgcm")
 
-	err := httpsignatures.DefaultSha256Signer.AuthRequest("hmac-key", key, req)
+	err := testutil.Sign(req, key)
 	if err != nil {
 		t.Error(err)
 		return
@@ -151,7 +150,7 @@ func TestHandler_MissingSignature(t *testing.T) {
 	handler := Handler("xVKAGlWQiY3sOp8JVc0nbuNId3PNCgWh", nil, nil)
 	handler.ServeHTTP(res, req)
 
-	got, want := res.Body.String(), "Invalid or Missing Signature\n"
+	got, want := res.Body.String(), `{"code":400,"message":"Invalid or Missing Signature"}`+"\n"
 	if got != want {
 		t.Errorf("Want response body %q, got %q", want, got)
 	}
@@ -166,7 +165,7 @@ func TestHandler_InvalidSignature(t *testing.T) {
 	handler := Handler("xVKAGlWQiY3sOp8JVc0nbuNId3PNCgWh", nil, nil)
 	handler.ServeHTTP(res, req)
 
-	got, want := res.Body.String(), "Invalid Signature\n"
+	got, want := res.Body.String(), `{"code":400,"message":"Invalid Signature"}`+"\n"
 	if got != want {
 		t.Errorf("Want response body %q, got %q", want, got)
 	}
@@ -0,0 +1,97 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secret
+
+import (
+	"context"
+	"testing"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/drone-go/plugin/cache"
+)
+
+func TestCached(t *testing.T) {
+	mock := &countingPlugin{}
+	c := cache.New(cache.Config{})
+	plugin := Cached(mock, c)
+
+	ctx := context.Background()
+	req := &Request{
+		Name:  "password",
+		Repo:  drone.Repo{Slug: "octocat/hello-world"},
+		Build: drone.Build{Event: drone.EventPush, Ref: "refs/heads/master"},
+	}
+
+	res, _ := plugin.Find(ctx, req)
+	res.Data = "modified"
+	res, _ = plugin.Find(ctx, req)
+	if got, want := res.Data, "correct-horse-battery-staple"; got != want {
+		t.Errorf("Want cached secret unaffected by the caller, got %q", got)
+	}
+	if got, want := mock.calls, 1; got != want {
+		t.Errorf("Want %d plugin calls, got %d", want, got)
+	}
+
+	// a different build event must not share the cached
+	// secret, since access may depend on the event.
+	plugin.Find(ctx, &Request{
+		Name:  "password",
+		Repo:  drone.Repo{Slug: "octocat/hello-world"},
+		Build: drone.Build{Event: drone.EventPullRequest, Ref: "refs/heads/master"},
+	})
+	if got, want := mock.calls, 2; got != want {
+		t.Errorf("Want %d plugin calls, got %d", want, got)
+	}
+
+	// a promotion to a different target, or a build of a
+	// repository that is no longer trusted, must not share
+	// the cached secret.
+	plugin.Find(ctx, &Request{
+		Name:  "password",
+		Repo:  drone.Repo{Slug: "octocat/hello-world"},
+		Build: drone.Build{Event: drone.EventPush, Ref: "refs/heads/master", Deploy: "production"},
+	})
+	plugin.Find(ctx, &Request{
+		Name:  "password",
+		Repo:  drone.Repo{Slug: "octocat/hello-world", Trusted: true},
+		Build: drone.Build{Event: drone.EventPush, Ref: "refs/heads/master"},
+	})
+	if got, want := mock.calls, 4; got != want {
+		t.Errorf("Want %d plugin calls, got %d", want, got)
+	}
+
+	// the stages of a build share the cached secret.
+	plugin.Find(ctx, &Request{
+		Name:  "password",
+		Repo:  drone.Repo{Slug: "octocat/hello-world"},
+		Build: drone.Build{Event: drone.EventPush, Ref: "refs/heads/master", Status: drone.StatusRunning},
+	})
+	if got, want := mock.calls, 4; got != want {
+		t.Errorf("Want %d plugin calls, got %d", want, got)
+	}
+
+	if stats := c.Stats(); stats.Hits != 2 || stats.Misses != 4 {
+		t.Errorf("Unexpected cache stats %+v", stats)
+	}
+}
+
+type countingPlugin struct {
+	calls int
+}
+
+func (p *countingPlugin) Find(context.Context, *Request) (*drone.Secret, error) {
+	p.calls++
+	return &drone.Secret{Name: "password", Data: "correct-horse-battery-staple"}, nil
+}
@@ -19,12 +19,16 @@ import (
 
 	"github.com/drone/drone-go/drone"
 	"github.com/drone/drone-go/plugin/internal/client"
+	"github.com/drone/drone-go/plugin/transport"
 )
 
 // Client returns a new plugin client.
-func Client(endpoint, secret string, skipverify bool) Plugin {
-	client := client.New(endpoint, secret, skipverify)
-	client.Accept = V1
+func Client(endpoint, secret string, skipverify bool, opts ...transport.Option) Plugin {
+	client := client.New(endpoint, secret, skipverify, opts...)
+	client.Idempotent = true
+	if client.Accept == "" {
+		client.Accept = V1
+	}
 	return &pluginClient{
 		client: client,
 	}
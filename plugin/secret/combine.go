@@ -0,0 +1,50 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secret
+
+import (
+	"context"
+
+	"github.com/drone/drone-go/drone"
+)
+
+// First returns a Plugin that queries the plugins in order and
+// returns the first secret found. A plugin that returns an
+// error or a nil secret is skipped. If no plugin returns the
+// secret, the first error is returned.
+func First(plugins ...Plugin) Plugin {
+	return &first{plugins: plugins}
+}
+
+type first struct {
+	plugins []Plugin
+}
+
+func (p *first) Find(ctx context.Context, req *Request) (*drone.Secret, error) {
+	var firstErr error
+	for _, plugin := range p.plugins {
+		res, err := plugin.Find(ctx, req)
+		if err == nil && res != nil {
+			return res, nil
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+	return nil, firstErr
+}
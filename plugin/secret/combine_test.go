@@ -0,0 +1,46 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secret
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/drone/drone-go/drone"
+)
+
+func TestFirst(t *testing.T) {
+	errFoo := errors.New("foo")
+	plugin := First(
+		&mockPlugin{err: errFoo},
+		&mockPlugin{},
+		&mockPlugin{res: &drone.Secret{Name: "password", Data: "a"}},
+		&mockPlugin{res: &drone.Secret{Name: "password", Data: "b"}},
+	)
+	res, err := plugin.Find(context.Background(), &Request{Name: "password"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if got, want := res.Data, "a"; got != want {
+		t.Errorf("Want secret from the first plugin with a hit, got %s", got)
+	}
+
+	plugin = First(&mockPlugin{}, &mockPlugin{err: errFoo})
+	if _, err := plugin.Find(context.Background(), &Request{}); err != errFoo {
+		t.Errorf("Want first error when no plugin returns the secret, got %v", err)
+	}
+}
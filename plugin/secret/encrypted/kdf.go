@@ -0,0 +1,51 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encrypted
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+)
+
+// pbkdf2 derives a key from the password and salt using
+// PBKDF2 (RFC 8018) with HMAC-SHA256.
+func pbkdf2(password, salt []byte, iterations, size int) []byte {
+	prf := hmac.New(sha256.New, password)
+	n := (size + prf.Size() - 1) / prf.Size()
+
+	var buf [4]byte
+	key := make([]byte, 0, n*prf.Size())
+	u := make([]byte, prf.Size())
+	for block := 1; block <= n; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.BigEndian.PutUint32(buf[:], uint32(block))
+		prf.Write(buf[:])
+		t := prf.Sum(nil)
+		copy(u, t)
+
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:size]
+}
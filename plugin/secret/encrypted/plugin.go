@@ -0,0 +1,111 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encrypted
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/drone-go/plugin"
+	"github.com/drone/drone-go/plugin/logger"
+	"github.com/drone/drone-go/plugin/policy"
+	"github.com/drone/drone-go/plugin/secret"
+)
+
+// New returns a secret plugin that serves secrets from the
+// encrypted store file. The store is reloaded when the file is
+// modified. If the reload fails, the error is logged and the
+// previously loaded store continues to be served. Requests
+// denied by an access policy are logged as warnings.
+func New(path, masterKey string, logs logger.Logger) (secret.Plugin, error) {
+	if logs == nil {
+		logs = logger.Discard()
+	}
+	p := &provider{
+		path:      path,
+		masterKey: masterKey,
+		logger:    logs,
+	}
+	if err := p.reload(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+type provider struct {
+	path      string
+	masterKey string
+	logger    logger.Logger
+
+	mu      sync.Mutex
+	store   *Store
+	modtime time.Time
+	loading bool
+}
+
+func (p *provider) Find(ctx context.Context, req *secret.Request) (*drone.Secret, error) {
+	if err := p.reload(); err != nil {
+		p.logger.Errorf("secrets: cannot reload %s: %s", p.path, err)
+	}
+	p.mu.Lock()
+	store := p.store
+	p.mu.Unlock()
+
+	// the store is not modified after it is loaded, so the
+	// secret is decrypted without holding the lock.
+	entry, data, err := store.Get(req.Path, req.Name)
+	if err == ErrNotExist {
+		return nil, plugin.ErrNotFound
+	}
+	if err != nil {
+		p.logger.Errorf("secrets: %s", err)
+		return nil, err
+	}
+	return policy.FindSecret(&entry.Policy, data, req, p.logger)
+}
+
+// reload loads the store if the file was modified since the
+// last load. The key derivation and decryption run without
+// holding the lock, and the loaded store replaces the current
+// store. If a reload is already in progress, the current store
+// continues to be served.
+func (p *provider) reload() error {
+	info, err := os.Stat(p.path)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	if p.loading || (p.store != nil && info.ModTime().Equal(p.modtime)) {
+		p.mu.Unlock()
+		return nil
+	}
+	p.loading = true
+	p.mu.Unlock()
+
+	store, err := Load(p.path, p.masterKey)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.loading = false
+	if err != nil {
+		return err
+	}
+	p.store = store
+	p.modtime = info.ModTime()
+	return nil
+}
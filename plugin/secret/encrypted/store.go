@@ -0,0 +1,349 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package encrypted provides an encrypted-at-rest secret store
+// and a secret plugin that serves secrets from the store.
+//
+// The store is a JSON file. Each secret is encrypted with
+// aesgcm using a random data key, and the data key is
+// encrypted with a key derived from the master key using
+// PBKDF2-HMAC-SHA256 and a random salt. The secret names and
+// access policies are stored in plaintext, so that the store
+// can be listed and reviewed without the master key. The
+// access policy is authenticated with the encrypted secret, so
+// a policy modified without the master key is rejected.
+package encrypted
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/drone/drone-go/plugin/internal/aesgcm"
+	"github.com/drone/drone-go/plugin/policy"
+)
+
+// Version is the store format version.
+const Version = 1
+
+// DefaultIterations is the default number of PBKDF2 iterations
+// used to derive the key from the master key.
+const DefaultIterations = 310000
+
+// MinIterations is the minimum number of PBKDF2 iterations
+// accepted when a store is loaded.
+const MinIterations = 100000
+
+// iterations is the number of PBKDF2 iterations used for new
+// keys, and minIterations is the minimum number of iterations
+// accepted. They are variables so that tests can use fewer
+// iterations.
+var (
+	iterations    = DefaultIterations
+	minIterations = MinIterations
+)
+
+// kdfName identifies the key derivation function.
+const kdfName = "pbkdf2-sha256"
+
+// keyData is the additional data used to authenticate the
+// encrypted data key.
+var keyData = []byte("drone-secret-store")
+
+// Store errors.
+var (
+	ErrExists         = errors.New("encrypted: secret already exists")
+	ErrNotExist       = errors.New("encrypted: secret does not exist")
+	ErrInvalidKey     = errors.New("encrypted: invalid master key")
+	ErrMissingKey     = errors.New("encrypted: missing master key")
+	ErrInvalidVersion = errors.New("encrypted: unsupported store version")
+	ErrWeakKDF        = errors.New("encrypted: too few key derivation iterations")
+)
+
+// Store is an encrypted-at-rest secret store.
+type Store struct {
+	Version int      `json:"version"`
+	KDF     KDF      `json:"kdf"`
+	Key     []byte   `json:"key"`
+	Secrets []*Entry `json:"secrets"`
+
+	// dataKey is the decrypted data key.
+	dataKey *[32]byte
+}
+
+// KDF defines the key derivation parameters.
+type KDF struct {
+	Name       string `json:"name"`
+	Salt       []byte `json:"salt"`
+	Iterations int    `json:"iterations"`
+}
+
+// Entry is an encrypted secret and its access policy.
+type Entry struct {
+	Path    string `json:"path,omitempty"`
+	Name    string `json:"name"`
+	Data    []byte `json:"data"`
+	Created int64  `json:"created"`
+	Updated int64  `json:"updated"`
+
+	policy.Policy
+}
+
+// Create returns a new, empty store encrypted with the master
+// key.
+func Create(masterKey string) (*Store, error) {
+	s := &Store{Version: Version}
+	if err := s.seal(masterKey); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Load reads the store from the file and decrypts the data key
+// with the master key.
+func Load(path, masterKey string) (*Store, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data, masterKey)
+}
+
+// Parse parses the JSON-encoded store and decrypts the data
+// key with the master key.
+func Parse(data []byte, masterKey string) (*Store, error) {
+	s := new(Store)
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, err
+	}
+	if s.Version != Version || s.KDF.Name != kdfName {
+		return nil, ErrInvalidVersion
+	}
+	if s.KDF.Iterations < minIterations {
+		return nil, ErrWeakKDF
+	}
+	if masterKey == "" {
+		return nil, ErrMissingKey
+	}
+	plaintext, err := aesgcm.DecryptWithData(s.Key, s.derive(masterKey), keyData)
+	if err != nil || len(plaintext) != 32 {
+		return nil, ErrInvalidKey
+	}
+	s.dataKey = new([32]byte)
+	copy(s.dataKey[:], plaintext)
+	return s, nil
+}
+
+// Save writes the store to the file. The file is replaced
+// atomically and is readable only by the owner.
+func (s *Store) Save(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Get returns the entry and the decrypted secret.
+func (s *Store) Get(path, name string) (*Entry, string, error) {
+	entry := s.find(path, name)
+	if entry == nil {
+		return nil, "", ErrNotExist
+	}
+	plaintext, err := aesgcm.DecryptWithData(entry.Data, s.dataKey, entryData(entry))
+	if err != nil {
+		return nil, "", fmt.Errorf("encrypted: cannot decrypt secret %s: %s", name, err)
+	}
+	return entry, string(plaintext), nil
+}
+
+// Add adds the secret with the access policy. It returns
+// ErrExists if the secret already exists.
+func (s *Store) Add(path, name, data string, p policy.Policy) error {
+	if s.find(path, name) != nil {
+		return ErrExists
+	}
+	if name == "" {
+		return errors.New("encrypted: secret name is required")
+	}
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	now := time.Now().Unix()
+	entry := &Entry{
+		Path:    path,
+		Name:    name,
+		Created: now,
+		Updated: now,
+		Policy:  p,
+	}
+	ciphertext, err := aesgcm.EncryptWithData([]byte(data), s.dataKey, entryData(entry))
+	if err != nil {
+		return err
+	}
+	entry.Data = ciphertext
+	s.Secrets = append(s.Secrets, entry)
+	sort.Slice(s.Secrets, func(i, j int) bool {
+		a, b := s.Secrets[i], s.Secrets[j]
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		return a.Name < b.Name
+	})
+	return nil
+}
+
+// Rotate replaces the secret data. The access policy is
+// retained. It returns ErrNotExist if the secret does not
+// exist.
+func (s *Store) Rotate(path, name, data string) error {
+	entry := s.find(path, name)
+	if entry == nil {
+		return ErrNotExist
+	}
+	ciphertext, err := aesgcm.EncryptWithData([]byte(data), s.dataKey, entryData(entry))
+	if err != nil {
+		return err
+	}
+	entry.Data = ciphertext
+	entry.Updated = time.Now().Unix()
+	return nil
+}
+
+// Remove removes the secret. It returns ErrNotExist if the
+// secret does not exist.
+func (s *Store) Remove(path, name string) error {
+	for i, entry := range s.Secrets {
+		if entry.Path == path && entry.Name == name {
+			s.Secrets = append(s.Secrets[:i], s.Secrets[i+1:]...)
+			return nil
+		}
+	}
+	return ErrNotExist
+}
+
+// Rekey re-encrypts the store under the new master key. A new
+// salt and data key are generated, and every secret is
+// re-encrypted with the new data key.
+func (s *Store) Rekey(masterKey string) error {
+	type plaintext struct {
+		entry *Entry
+		data  string
+	}
+	var secrets []plaintext
+	for _, entry := range s.Secrets {
+		_, data, err := s.Get(entry.Path, entry.Name)
+		if err != nil {
+			return err
+		}
+		secrets = append(secrets, plaintext{entry, data})
+	}
+
+	next := &Store{Version: Version}
+	if err := next.seal(masterKey); err != nil {
+		return err
+	}
+	ciphertexts := make([][]byte, len(secrets))
+	for i, secret := range secrets {
+		ciphertext, err := aesgcm.EncryptWithData([]byte(secret.data), next.dataKey, entryData(secret.entry))
+		if err != nil {
+			return err
+		}
+		ciphertexts[i] = ciphertext
+	}
+	for i, secret := range secrets {
+		secret.entry.Data = ciphertexts[i]
+	}
+	s.KDF = next.KDF
+	s.Key = next.Key
+	s.dataKey = next.dataKey
+	return nil
+}
+
+// seal generates a new salt and data key, and encrypts the
+// data key with the master key.
+func (s *Store) seal(masterKey string) error {
+	if masterKey == "" {
+		return ErrMissingKey
+	}
+	s.KDF = KDF{
+		Name:       kdfName,
+		Salt:       make([]byte, 16),
+		Iterations: iterations,
+	}
+	if _, err := io.ReadFull(rand.Reader, s.KDF.Salt); err != nil {
+		return err
+	}
+	s.dataKey = new([32]byte)
+	if _, err := io.ReadFull(rand.Reader, s.dataKey[:]); err != nil {
+		return err
+	}
+	key, err := aesgcm.EncryptWithData(s.dataKey[:], s.derive(masterKey), keyData)
+	if err != nil {
+		return err
+	}
+	s.Key = key
+	return nil
+}
+
+// derive derives the key encryption key from the master key.
+func (s *Store) derive(masterKey string) *[32]byte {
+	key := new([32]byte)
+	copy(key[:], pbkdf2([]byte(masterKey), s.KDF.Salt, s.KDF.Iterations, 32))
+	return key
+}
+
+func (s *Store) find(path, name string) *Entry {
+	for _, entry := range s.Secrets {
+		if entry.Path == path && entry.Name == name {
+			return entry
+		}
+	}
+	return nil
+}
+
+// entryData returns the additional data used to authenticate
+// the encrypted secret. It includes the path, name and access
+// policy, which prevents an encrypted secret from being copied
+// to another entry, and the access policy from being modified
+// without the master key.
+func entryData(entry *Entry) []byte {
+	// the policy is encoded as JSON, which encodes the
+	// struct fields in a fixed order.
+	policy, _ := json.Marshal(entry.Policy)
+	return []byte(entry.Path + "\x00" + entry.Name + "\x00" + string(policy))
+}
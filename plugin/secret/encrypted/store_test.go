@@ -0,0 +1,225 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encrypted
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/drone/drone-go/plugin"
+	"github.com/drone/drone-go/plugin/fixtures"
+	"github.com/drone/drone-go/plugin/policy"
+)
+
+func init() {
+	iterations = 1000
+	minIterations = 1000
+}
+
+func TestPBKDF2(t *testing.T) {
+	tests := []struct {
+		password, salt string
+		iterations     int
+		size           int
+		want           string
+	}{
+		// test vectors from RFC 7914 section 11.
+		{"passwd", "salt", 1, 64, "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783"},
+		{"password", "salt", 4096, 32, "c5e478d59288c841aa530db6845c4c8d962893a001ce4e11a4963873aa98134a"},
+	}
+	for _, test := range tests {
+		got := hex.EncodeToString(pbkdf2([]byte(test.password), []byte(test.salt), test.iterations, test.size))
+		if got != test.want {
+			t.Errorf("Want derived key %s, got %s", test.want, got)
+		}
+	}
+}
+
+func TestStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "drone-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "secrets.json")
+
+	s, err := Create("correct-horse-battery-staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add("", "password", "foo", policy.Policy{Repos: []string{"octocat/*"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add("aws", "access_key", "bar", policy.Policy{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add("", "password", "baz", policy.Policy{}); err != ErrExists {
+		t.Errorf("Want ErrExists, got %v", err)
+	}
+	if err := s.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, _ := ioutil.ReadFile(path)
+	if strings.Contains(string(raw), `"foo"`) || strings.Contains(string(raw), `"bar"`) {
+		t.Errorf("Want secrets encrypted at rest")
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Errorf("Want store readable only by the owner, got %s", info.Mode())
+	}
+
+	if _, err := Load(path, "wrong-key"); err != ErrInvalidKey {
+		t.Errorf("Want ErrInvalidKey, got %v", err)
+	}
+	s, err = Load(path, "correct-horse-battery-staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, data, err := s.Get("", "password")
+	if err != nil || data != "foo" {
+		t.Errorf("Want decrypted secret, got %v", err)
+	} else if len(entry.Repos) != 1 {
+		t.Errorf("Want access policy loaded")
+	}
+
+	if err := s.Rotate("", "password", "qux"); err != nil {
+		t.Error(err)
+	}
+	if _, data, _ := s.Get("", "password"); data != "qux" {
+		t.Errorf("Want rotated secret, got %s", data)
+	}
+	if err := s.Rotate("", "unknown", "qux"); err != ErrNotExist {
+		t.Errorf("Want ErrNotExist, got %v", err)
+	}
+
+	if err := s.Rekey("new-master-key"); err != nil {
+		t.Fatal(err)
+	}
+	s.Save(path)
+	if _, err := Load(path, "correct-horse-battery-staple"); err != ErrInvalidKey {
+		t.Errorf("Want old master key rejected after rekey, got %v", err)
+	}
+	s, err = Load(path, "new-master-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, data, _ := s.Get("aws", "access_key"); data != "bar" {
+		t.Errorf("Want secret readable after rekey, got %s", data)
+	}
+
+	if err := s.Remove("aws", "access_key"); err != nil {
+		t.Error(err)
+	}
+	if _, _, err := s.Get("aws", "access_key"); err != ErrNotExist {
+		t.Errorf("Want ErrNotExist after remove, got %v", err)
+	}
+}
+
+func TestStore_Swapped(t *testing.T) {
+	s, err := Create("correct-horse-battery-staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Add("", "a", "foo", policy.Policy{})
+	s.Add("", "b", "bar", policy.Policy{})
+
+	// an encrypted secret copied to another entry must not
+	// decrypt.
+	s.Secrets[1].Data = s.Secrets[0].Data
+	if _, _, err := s.Get("", "b"); err == nil {
+		t.Errorf("Want error decrypting a secret copied from another entry")
+	}
+}
+
+func TestFind(t *testing.T) {
+	dir, err := ioutil.TempDir("", "drone-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "secrets.json")
+
+	s, _ := Create("correct-horse-battery-staple")
+	s.Add("", "password", "foo", policy.Policy{Branches: []string{"master"}})
+	s.Save(path)
+
+	p, err := New(path, "correct-horse-battery-staple", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := p.Find(context.Background(), fixtures.New(nil, nil).SecretRequest("", "password"))
+	if err != nil || res.Data != "foo" {
+		t.Errorf("Want secret, got %v", err)
+	}
+	req := fixtures.New(nil, fixtures.NewBuild().Push("develop")).SecretRequest("", "password")
+	if _, err := p.Find(context.Background(), req); err != plugin.ErrNotFound {
+		t.Errorf("Want denied secret reported as not found, got %v", err)
+	}
+
+	// the store is reloaded when the file is modified. While
+	// a reload is in progress, the current store is served.
+	s.Rotate("", "password", "bar")
+	s.Save(path)
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(path, later, later)
+	p.(*provider).loading = true
+	res, err = p.Find(context.Background(), fixtures.New(nil, nil).SecretRequest("", "password"))
+	if err != nil || res.Data != "foo" {
+		t.Errorf("Want current secret during reload, got %v", err)
+	}
+	p.(*provider).loading = false
+	res, err = p.Find(context.Background(), fixtures.New(nil, nil).SecretRequest("", "password"))
+	if err != nil || res.Data != "bar" {
+		t.Errorf("Want rotated secret after reload, got %v", err)
+	}
+
+	if _, err := New(path, "wrong-key", nil); err != ErrInvalidKey {
+		t.Errorf("Want ErrInvalidKey, got %v", err)
+	}
+}
+
+func TestStore_Tampered(t *testing.T) {
+	s, err := Create("correct-horse-battery-staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Add("", "docker_password", "correct-horse", policy.Policy{Repos: []string{"octocat/*"}})
+
+	// the access policy cannot be modified without the master
+	// key.
+	s.Secrets[0].Repos = []string{"*"}
+	if _, _, err := s.Get("", "docker_password"); err == nil {
+		t.Errorf("Want error decrypting a secret with a modified policy")
+	}
+	s.Secrets[0].Repos = []string{"octocat/*"}
+	if _, _, err := s.Get("", "docker_password"); err != nil {
+		t.Error(err)
+	}
+
+	// a store with too few key derivation iterations is
+	// rejected.
+	s.KDF.Iterations = 1
+	data, _ := json.Marshal(s)
+	if _, err := Parse(data, "correct-horse-battery-staple"); err != ErrWeakKDF {
+		t.Errorf("Want ErrWeakKDF, got %v", err)
+	}
+}
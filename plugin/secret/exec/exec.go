@@ -0,0 +1,108 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package exec provides a secret plugin that runs a helper
+// command to get secrets.
+//
+// The command receives the secret request as JSON on stdin and
+// writes the secret as JSON to stdout, for example:
+//
+//	{"data": "correct-horse-battery-staple", "pull_request": false}
+//
+// If the command writes nothing to stdout the secret is not
+// found. If the command exits with a non-zero status the
+// request fails with plugin.ErrUnavailable.
+package exec
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/drone-go/plugin"
+	"github.com/drone/drone-go/plugin/cache"
+	"github.com/drone/drone-go/plugin/internal/command"
+	"github.com/drone/drone-go/plugin/secret"
+)
+
+// Config configures the exec secret plugin.
+type Config struct {
+	// Command is the name or path of the helper command.
+	Command string
+
+	// Args are the command arguments.
+	Args []string
+
+	// Env is the environment allowlist of the command. See
+	// command.Command for the format of the entries.
+	Env []string
+
+	// Timeout is the maximum command duration. If zero, the
+	// command.DefaultTimeout is used.
+	Timeout time.Duration
+
+	// TTL is the duration the command output is cached. If
+	// zero, the output is not cached.
+	TTL time.Duration
+}
+
+// New returns a secret plugin that runs a helper command to
+// get secrets.
+func New(config Config) (secret.Plugin, error) {
+	if config.Command == "" {
+		return nil, fmt.Errorf("exec: missing command")
+	}
+	var p secret.Plugin = &provider{
+		command: &command.Command{
+			Path:    config.Command,
+			Args:    config.Args,
+			Env:     config.Env,
+			Timeout: config.Timeout,
+		},
+	}
+	if config.TTL > 0 {
+		p = secret.Cached(p, cache.New(cache.Config{
+			TTL:         config.TTL,
+			NegativeTTL: config.TTL,
+		}))
+	}
+	return p, nil
+}
+
+type provider struct {
+	command *command.Command
+}
+
+func (p *provider) Find(ctx context.Context, req *secret.Request) (*drone.Secret, error) {
+	in, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	out, err := p.command.Run(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(out)) == 0 {
+		return nil, plugin.ErrNotFound
+	}
+	res := new(drone.Secret)
+	if err := json.Unmarshal(out, res); err != nil {
+		return nil, fmt.Errorf("exec: %s: invalid output: %s", p.command.Path, err)
+	}
+	res.Name = req.Name
+	return res, nil
+}
@@ -0,0 +1,166 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exec
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/drone/drone-go/plugin"
+	"github.com/drone/drone-go/plugin/fixtures"
+	"github.com/drone/drone-go/plugin/secret"
+)
+
+const script = `#!/bin/sh
+input=$(cat)
+echo x >> "$COUNT"
+case "$input" in
+*'"name":"password"'*)
+	echo '{"data":"correct-horse-battery-staple","pull_request":true}' ;;
+*'"name":"env"'*)
+	printf '{"data":"%s:%s"}' "$TOKEN" "$HOME" ;;
+*'"name":"slow"'*)
+	exec sleep 5 ;;
+*'"name":"fail"'*)
+	echo "vault is sealed" >&2
+	exit 2 ;;
+*'"name":"invalid"'*)
+	echo "not json" ;;
+esac
+`
+
+// setup writes the helper script and returns the plugin
+// configuration and the path of the invocation count file.
+func setup(t *testing.T) (Config, string, func()) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping shell script tests on windows")
+	}
+	dir, err := ioutil.TempDir("", "drone-secret-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "helper")
+	if err := ioutil.WriteFile(path, []byte(script), 0700); err != nil {
+		t.Fatal(err)
+	}
+	count := filepath.Join(dir, "count")
+	config := Config{
+		Command: path,
+		Env:     []string{"PATH", "COUNT=" + count, "TOKEN=s3cr3t"},
+		Timeout: time.Second,
+	}
+	return config, count, func() { os.RemoveAll(dir) }
+}
+
+func invocations(path string) int {
+	data, _ := ioutil.ReadFile(path)
+	return strings.Count(string(data), "x")
+}
+
+func TestFind(t *testing.T) {
+	config, _, cleanup := setup(t)
+	defer cleanup()
+
+	p, err := New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := fixtures.New(fixtures.NewRepo("octocat/hello-world"), fixtures.NewBuild())
+	got, err := p.Find(context.Background(), f.SecretRequest("docker", "password"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "password" || got.Data != "correct-horse-battery-staple" || !got.PullRequest {
+		t.Errorf("Unexpected secret %+v", got)
+	}
+
+	_, err = p.Find(context.Background(), f.SecretRequest("docker", "token"))
+	if !errors.Is(err, plugin.ErrNotFound) {
+		t.Errorf("Want ErrNotFound for empty output, got %v", err)
+	}
+}
+
+func TestFind_Env(t *testing.T) {
+	config, _, cleanup := setup(t)
+	defer cleanup()
+
+	defer os.Setenv("HOME", os.Getenv("HOME"))
+	os.Setenv("HOME", "/home/octocat")
+	p, _ := New(config)
+	got, err := p.Find(context.Background(), &secret.Request{Name: "env"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Data != "s3cr3t:" {
+		t.Errorf("Want only allowlisted variables passed to the command, got %s", got.Data)
+	}
+}
+
+func TestFind_Errors(t *testing.T) {
+	config, _, cleanup := setup(t)
+	defer cleanup()
+
+	config.Timeout = 100 * time.Millisecond
+	p, _ := New(config)
+
+	_, err := p.Find(context.Background(), &secret.Request{Name: "slow"})
+	if !errors.Is(err, plugin.ErrUnavailable) {
+		t.Errorf("Want ErrUnavailable for timeout, got %v", err)
+	}
+	_, err = p.Find(context.Background(), &secret.Request{Name: "fail"})
+	if err == nil || !strings.Contains(err.Error(), "vault is sealed") {
+		t.Errorf("Want error with the command stderr, got %v", err)
+	}
+	if !errors.Is(err, plugin.ErrUnavailable) {
+		t.Errorf("Want ErrUnavailable for non-zero exit, got %v", err)
+	}
+	_, err = p.Find(context.Background(), &secret.Request{Name: "invalid"})
+	if err == nil || !strings.Contains(err.Error(), "invalid output") {
+		t.Errorf("Want invalid output error, got %v", err)
+	}
+}
+
+func TestFind_Cache(t *testing.T) {
+	config, count, cleanup := setup(t)
+	defer cleanup()
+
+	config.TTL = time.Minute
+	p, _ := New(config)
+	for i := 0; i < 3; i++ {
+		p.Find(context.Background(), &secret.Request{Name: "password"})
+		p.Find(context.Background(), &secret.Request{Name: "token"})
+	}
+	if got := invocations(count); got != 2 {
+		t.Errorf("Want command output cached, got %d invocations", got)
+	}
+	p.Find(context.Background(), &secret.Request{Name: "fail"})
+	p.Find(context.Background(), &secret.Request{Name: "fail"})
+	if got := invocations(count); got != 4 {
+		t.Errorf("Want command errors not cached, got %d invocations", got)
+	}
+}
+
+func TestNew_MissingCommand(t *testing.T) {
+	if _, err := New(Config{}); err == nil {
+		t.Errorf("Want error for missing command")
+	}
+}
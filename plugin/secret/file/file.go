@@ -0,0 +1,198 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package file provides a secret plugin that serves secrets
+// from a YAML or JSON file, or a directory of files.
+//
+// The file contains a list of secrets. Each secret has an
+// optional access policy:
+//
+//   - name: docker_password
+//     data: correct-horse-battery-staple
+//     repos: [ "octocat/*" ]
+//     branches: [ master, "release/*" ]
+//     events: [ push, tag ]
+//     pull_request: false
+//     fork: false
+//     trusted: true
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/drone-go/plugin"
+	"github.com/drone/drone-go/plugin/logger"
+	"github.com/drone/drone-go/plugin/policy"
+	"github.com/drone/drone-go/plugin/secret"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Secret defines a secret and its access policy.
+type Secret struct {
+	Path string `json:"path,omitempty" yaml:"path,omitempty"`
+	Name string `json:"name" yaml:"name"`
+	Data string `json:"data" yaml:"data"`
+
+	policy.Policy `yaml:",inline"`
+}
+
+type key struct {
+	path string
+	name string
+}
+
+// New returns a secret plugin that serves secrets from the
+// file or directory. A directory is loaded from the .yml,
+// .yaml and .json files in the directory, in lexical order,
+// and a secret defined in multiple files is loaded from the
+// last file.
+//
+// The secrets are reloaded when the file or directory is
+// modified. If the reload fails, the error is logged and the
+// previously loaded secrets continue to be served. Requests
+// denied by an access policy are logged as warnings.
+func New(path string, logs logger.Logger) (secret.Plugin, error) {
+	if logs == nil {
+		logs = logger.Discard()
+	}
+	s := &store{
+		path:   path,
+		logger: logs,
+	}
+	if err := s.reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+type store struct {
+	path   string
+	logger logger.Logger
+
+	mu      sync.Mutex
+	secrets map[key]*Secret
+	modtime time.Time
+}
+
+func (s *store) Find(ctx context.Context, req *secret.Request) (*drone.Secret, error) {
+	s.mu.Lock()
+	if err := s.reload(); err != nil {
+		s.logger.Errorf("secrets: cannot reload %s: %s", s.path, err)
+	}
+	found, ok := s.secrets[key{req.Path, req.Name}]
+	s.mu.Unlock()
+
+	if !ok {
+		return nil, plugin.ErrNotFound
+	}
+	return policy.FindSecret(&found.Policy, found.Data, req, s.logger)
+}
+
+// reload loads the secrets if the file or directory was
+// modified since the last load. The caller must hold the
+// lock, except when called from the constructor.
+func (s *store) reload() error {
+	modtime, files, err := stat(s.path)
+	if err != nil {
+		return err
+	}
+	if s.secrets != nil && modtime.Equal(s.modtime) {
+		return nil
+	}
+	secrets := map[key]*Secret{}
+	for _, file := range files {
+		list, err := parse(file)
+		if err != nil {
+			return err
+		}
+		for _, secret := range list {
+			secrets[key{secret.Path, secret.Name}] = secret
+		}
+	}
+	s.secrets = secrets
+	s.modtime = modtime
+	return nil
+}
+
+// stat returns the most recent modification time of the file
+// or directory and its files, and the list of files to load.
+func stat(path string) (time.Time, []string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, nil, err
+	}
+	if !info.IsDir() {
+		return info.ModTime(), []string{path}, nil
+	}
+	modtime := info.ModTime()
+	entries, err := ioutil.ReadDir(path)
+	if err != nil {
+		return modtime, nil, err
+	}
+	var files []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		switch filepath.Ext(entry.Name()) {
+		case ".yml", ".yaml", ".json":
+		default:
+			continue
+		}
+		if entry.ModTime().After(modtime) {
+			modtime = entry.ModTime()
+		}
+		files = append(files, filepath.Join(path, entry.Name()))
+	}
+	sort.Strings(files)
+	return modtime, files, nil
+}
+
+// parse parses the secrets file. A .json file is parsed as
+// JSON, and any other file is parsed as YAML.
+func parse(file string) ([]*Secret, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var secrets []*Secret
+	if strings.EqualFold(filepath.Ext(file), ".json") {
+		err = json.Unmarshal(data, &secrets)
+	} else {
+		err = yaml.Unmarshal(data, &secrets)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", file, err)
+	}
+	for _, secret := range secrets {
+		if secret == nil || secret.Name == "" {
+			return nil, fmt.Errorf("%s: secret name is required", file)
+		}
+		if err := secret.Validate(); err != nil {
+			return nil, fmt.Errorf("%s: secret %s: %s", file, secret.Name, err)
+		}
+	}
+	return secrets, nil
+}
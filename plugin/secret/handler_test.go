@@ -17,16 +17,22 @@ package secret
 import (
 	"bytes"
 	"context"
+	"crypto/ed25519"
+	"crypto/rand"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 	"time"
 
 	"github.com/drone/drone-go/drone"
+	"github.com/drone/drone-go/plugin"
 	"github.com/drone/drone-go/plugin/internal/aesgcm"
-
-	"github.com/99designs/httpsignatures-go"
+	"github.com/drone/drone-go/plugin/internal/testutil"
+	"github.com/drone/drone-go/plugin/middleware"
+	"github.com/drone/drone-go/plugin/transport"
 )
 
 func TestHandler(t *testing.T) {
@@ -41,7 +47,7 @@ func TestHandler(t *testing.T) {
 	req := httptest.NewRequest("GET", "/", buf)
 	req.Header.Add("Date", time.Now().UTC().Format(http.TimeFormat))
 
-	err := httpsignatures.DefaultSha256Signer.AuthRequest("hmac-key", key, req)
+	err := testutil.Sign(req, key)
 	if err != nil {
 		t.Error(err)
 		return
@@ -83,7 +89,7 @@ func TestHandler_Encrypted(t *testing.T) {
 	req.Header.Add("Date", time.Now().UTC().Format(http.TimeFormat))
 	req.Header.Add("Accept-Encoding", "aesgcm")
 
-	err := httpsignatures.DefaultSha256Signer.AuthRequest("hmac-key", key, req)
+	err := testutil.Sign(req, key)
 	if err != nil {
 		t.Error(err)
 		return
@@ -129,6 +135,183 @@ func TestHandler_Encrypted(t *testing.T) {
 	}
 }
 
+func TestHandler_Keyring(t *testing.T) {
+	oldKey := "xVKAGlWQiY3sOp8JVc0nbuNId3PNCgWh"
+	newKey := "3bSMuRSWM6Sq0C2X6JZ1pQSN8nXzBfQK"
+
+	keyring := middleware.NewKeyring()
+	keyring.Add("old", oldKey)
+	keyring.Rotate("new", newKey, time.Hour)
+
+	buf := new(bytes.Buffer)
+	json.NewEncoder(buf).Encode(&Request{
+		Name: "docker_password",
+	})
+
+	res := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/", buf)
+	req.Header.Add("Accept-Encoding", "aesgcm")
+
+	err := testutil.SignKey(req, "new", newKey)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	plugin := &mockPlugin{
+		res: &drone.Secret{Name: "docker_password"},
+	}
+
+	handler := Handler("", plugin, nil, middleware.WithKeyring(keyring))
+	handler.ServeHTTP(res, req)
+
+	if got, want := res.Code, 200; got != want {
+		t.Errorf("Want status code %d, got %d", want, got)
+		return
+	}
+
+	// the response must be encrypted with the secret that
+	// matches the keyId of the request.
+	keyb, _ := aesgcm.Key(newKey)
+	body, err := aesgcm.Decrypt(res.Body.Bytes(), keyb)
+	if err != nil {
+		t.Errorf("Want response encrypted with the request key, got %s", err)
+		return
+	}
+	resp := &drone.Secret{}
+	json.Unmarshal(body, resp)
+	if got, want := resp.Name, "docker_password"; got != want {
+		t.Errorf("Want secret name %s, got %s", want, got)
+	}
+}
+
+func TestHandler_UnknownKey(t *testing.T) {
+	keyring := middleware.NewKeyring()
+	keyring.Add("new", "3bSMuRSWM6Sq0C2X6JZ1pQSN8nXzBfQK")
+
+	res := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/", bytes.NewBufferString("{}"))
+	err := testutil.SignKey(req, "old", "xVKAGlWQiY3sOp8JVc0nbuNId3PNCgWh")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	handler := Handler("", nil, nil, middleware.WithKeyring(keyring))
+	handler.ServeHTTP(res, req)
+
+	if got, want := res.Code, 401; got != want {
+		t.Errorf("Want status code %d, got %d", want, got)
+	}
+}
+
+func TestClient_KeyID(t *testing.T) {
+	keyring := middleware.NewKeyring()
+	keyring.Add("old", "xVKAGlWQiY3sOp8JVc0nbuNId3PNCgWh")
+	keyring.Add("new", "3bSMuRSWM6Sq0C2X6JZ1pQSN8nXzBfQK")
+
+	plugin := &mockPlugin{
+		res: &drone.Secret{Name: "docker_password"},
+	}
+	server := httptest.NewServer(Handler("", plugin, nil, middleware.WithKeyring(keyring)))
+	defer server.Close()
+
+	client := Client(server.URL, "3bSMuRSWM6Sq0C2X6JZ1pQSN8nXzBfQK", false, transport.WithKeyID("new"))
+	got, err := client.Find(context.Background(), &Request{Name: "docker_password"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if got.Name != "docker_password" {
+		t.Errorf("Want secret name docker_password, got %s", got.Name)
+	}
+
+	client = Client(server.URL, "3bSMuRSWM6Sq0C2X6JZ1pQSN8nXzBfQK", false, transport.WithKeyID("old"))
+	if _, err := client.Find(context.Background(), &Request{Name: "docker_password"}); err == nil {
+		t.Errorf("Want error when signing with the wrong secret for the keyId")
+	}
+}
+
+func TestClient_PrivateKey(t *testing.T) {
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	keyring := middleware.NewKeyring()
+	keyring.AddPublicKey("drone", pub)
+
+	plugin := &mockPlugin{
+		res: &drone.Secret{Name: "docker_password"},
+	}
+	server := httptest.NewServer(Handler("", plugin, nil, middleware.WithKeyring(keyring)))
+	defer server.Close()
+
+	client := Client(server.URL, "", false, transport.WithPrivateKey("drone", key))
+	got, err := client.Find(context.Background(), &Request{Name: "docker_password"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if got.Name != "docker_password" {
+		t.Errorf("Want secret name docker_password, got %s", got.Name)
+	}
+}
+
+func TestClient_PrivateKeyEncryption(t *testing.T) {
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	keyring := middleware.NewKeyring()
+	keyring.AddPublicKey("drone", pub)
+
+	plugin := &mockPlugin{
+		res: &drone.Secret{Name: "docker_password"},
+	}
+	server := httptest.NewServer(Handler("xVKAGlWQiY3sOp8JVc0nbuNId3PNCgWh", plugin, nil, middleware.WithKeyring(keyring)))
+	defer server.Close()
+
+	// the response must not be encrypted with the shared secret
+	// because the request was not signed with it.
+	client := Client(server.URL, "", false,
+		transport.WithPrivateKey("drone", key),
+		transport.WithEncryption(),
+	)
+	_, err = client.Find(context.Background(), &Request{Name: "docker_password"})
+	if !errors.Is(err, middleware.ErrEncryptionUnsupported) {
+		t.Errorf("Want ErrEncryptionUnsupported, got %v", err)
+	}
+}
+
+func TestClient_TypedErrors(t *testing.T) {
+	key := "xVKAGlWQiY3sOp8JVc0nbuNId3PNCgWh"
+
+	tests := []struct {
+		err  error
+		want error
+	}{
+		{fmt.Errorf("no secret named password: %w", plugin.ErrNotFound), plugin.ErrNotFound},
+		{fmt.Errorf("vault sealed: %w", plugin.ErrUnavailable), plugin.ErrUnavailable},
+		{plugin.ErrDenied, plugin.ErrDenied},
+	}
+	for _, test := range tests {
+		server := httptest.NewServer(Handler(key, &mockPlugin{err: test.err}, nil))
+		_, err := Client(server.URL, key, false).Find(context.Background(), &Request{Name: "password"})
+		server.Close()
+
+		if !errors.Is(err, test.want) {
+			t.Errorf("Want error %v, got %v", test.want, err)
+		}
+		if got, want := err.Error(), test.err.Error(); got != want {
+			t.Errorf("Want error message %q, got %q", want, got)
+		}
+	}
+}
+
 func TestHandler_MissingSignature(t *testing.T) {
 	res := httptest.NewRecorder()
 	req := httptest.NewRequest("GET", "/", nil)
@@ -136,7 +319,7 @@ func TestHandler_MissingSignature(t *testing.T) {
 	handler := Handler("xVKAGlWQiY3sOp8JVc0nbuNId3PNCgWh", nil, nil)
 	handler.ServeHTTP(res, req)
 
-	got, want := res.Body.String(), "Invalid or Missing Signature\n"
+	got, want := res.Body.String(), `{"code":400,"message":"Invalid or Missing Signature"}`+"\n"
 	if got != want {
 		t.Errorf("Want response body %q, got %q", want, got)
 	}
@@ -151,7 +334,7 @@ func TestHandler_InvalidSignature(t *testing.T) {
 	handler := Handler("xVKAGlWQiY3sOp8JVc0nbuNId3PNCgWh", nil, nil)
 	handler.ServeHTTP(res, req)
 
-	got, want := res.Body.String(), "Invalid Signature\n"
+	got, want := res.Body.String(), `{"code":400,"message":"Invalid Signature"}`+"\n"
 	if got != want {
 		t.Errorf("Want response body %q, got %q", want, got)
 	}
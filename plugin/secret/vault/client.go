@@ -0,0 +1,238 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/drone/drone-go/plugin"
+)
+
+// kvResponse is the KV version 2 read response.
+type kvResponse struct {
+	LeaseDuration int `json:"lease_duration"`
+	Data          struct {
+		Data     map[string]interface{} `json:"data"`
+		Metadata struct {
+			Version      int    `json:"version"`
+			DeletionTime string `json:"deletion_time"`
+			Destroyed    bool   `json:"destroyed"`
+		} `json:"metadata"`
+	} `json:"data"`
+}
+
+// loginResponse is the AppRole login response.
+type loginResponse struct {
+	Auth struct {
+		ClientToken   string `json:"client_token"`
+		LeaseDuration int    `json:"lease_duration"`
+	} `json:"auth"`
+}
+
+// get reads the secret from Vault and returns the secret data
+// and lease duration. If the token is rejected and the plugin
+// uses AppRole credentials, the plugin logs in again and
+// retries the request.
+func (p *provider) get(ctx context.Context, r *ref) (map[string]string, time.Duration, error) {
+	endpoint := p.config.Address + "/v1/" + p.config.Mount + "/data/" + escape(r.path)
+	if r.version != 0 {
+		endpoint += "?version=" + strconv.Itoa(r.version)
+	}
+
+	out := new(kvResponse)
+	err := p.do(ctx, "GET", endpoint, nil, out, true)
+	if err != nil {
+		return nil, 0, err
+	}
+	// a deleted or destroyed version is returned with no
+	// data.
+	if out.Data.Data == nil || out.Data.Metadata.Destroyed {
+		return nil, 0, plugin.ErrNotFound
+	}
+	data := map[string]string{}
+	for k, v := range out.Data.Data {
+		switch v := v.(type) {
+		case string:
+			data[k] = v
+		default:
+			b, _ := json.Marshal(v)
+			data[k] = string(b)
+		}
+	}
+	return data, time.Duration(out.LeaseDuration) * time.Second, nil
+}
+
+// do sends the authenticated request and decodes the JSON
+// response.
+func (p *provider) do(ctx context.Context, method, endpoint string, in, out interface{}, retry bool) error {
+	token, err := p.authenticate(ctx, "")
+	if err != nil {
+		return err
+	}
+	code, err := p.send(ctx, method, endpoint, token, in, out)
+	if code == http.StatusForbidden && retry && p.config.RoleID != "" {
+		// the token may have been revoked or expired before
+		// its lease, so log in again and retry once.
+		if token, err = p.authenticate(ctx, token); err != nil {
+			return err
+		}
+		_, err = p.send(ctx, method, endpoint, token, in, out)
+	}
+	return err
+}
+
+// authenticate returns the token, logging in with the AppRole
+// credentials if the plugin has no token, the token lease is
+// about to expire, or the token is the rejected token.
+// Concurrent callers share a single login, and the login
+// request is sent without holding the lock.
+func (p *provider) authenticate(ctx context.Context, rejected string) (string, error) {
+	p.mu.Lock()
+	if p.config.RoleID == "" {
+		defer p.mu.Unlock()
+		return p.token, nil
+	}
+	if p.token != "" && p.token != rejected && (p.expires.IsZero() || p.now().Before(p.expires)) {
+		defer p.mu.Unlock()
+		return p.token, nil
+	}
+	if cl := p.login; cl != nil {
+		p.mu.Unlock()
+		select {
+		case <-cl.done:
+			return cl.token, cl.err
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+	cl := &login{done: make(chan struct{})}
+	p.login = cl
+	p.mu.Unlock()
+
+	var expires time.Time
+	cl.token, expires, cl.err = p.authenticateAppRole(ctx)
+
+	p.mu.Lock()
+	if cl.err == nil {
+		p.token, p.expires = cl.token, expires
+	}
+	p.login = nil
+	p.mu.Unlock()
+	close(cl.done)
+	return cl.token, cl.err
+}
+
+// authenticateAppRole logs in with the AppRole credentials and
+// returns the token and the time the token should be renewed.
+func (p *provider) authenticateAppRole(ctx context.Context) (string, time.Time, error) {
+	in := map[string]string{
+		"role_id":   p.config.RoleID,
+		"secret_id": p.config.SecretID,
+	}
+	out := new(loginResponse)
+	endpoint := p.config.Address + "/v1/auth/" + p.config.AuthMount + "/login"
+	if _, err := p.send(ctx, "POST", endpoint, "", in, out); err != nil {
+		return "", time.Time{}, fmt.Errorf("vault: cannot login: %w", err)
+	}
+	if out.Auth.ClientToken == "" {
+		return "", time.Time{}, fmt.Errorf("vault: login returned no token: %w", plugin.ErrUnavailable)
+	}
+	var expires time.Time
+	if lease := time.Duration(out.Auth.LeaseDuration) * time.Second; lease > 0 {
+		// renew the token before the lease expires.
+		expires = p.now().Add(lease - lease/10)
+	}
+	return out.Auth.ClientToken, expires, nil
+}
+
+// send sends the request and decodes the JSON response. It
+// returns the response status code and an error that wraps
+// plugin.ErrNotFound, plugin.ErrDenied or plugin.ErrUnavailable
+// for an error response.
+func (p *provider) send(ctx context.Context, method, endpoint, token string, in, out interface{}) (int, error) {
+	var body io.Reader
+	if in != nil {
+		data, _ := json.Marshal(in)
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, endpoint, body)
+	if err != nil {
+		return 0, err
+	}
+	req = req.WithContext(ctx)
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if p.config.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", p.config.Namespace)
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := p.config.Client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return 0, ctx.Err()
+		}
+		return 0, fmt.Errorf("vault: %s: %w", err, plugin.ErrUnavailable)
+	}
+	defer res.Body.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return res.StatusCode, fmt.Errorf("vault: %s: %w", err, plugin.ErrUnavailable)
+	}
+
+	switch {
+	case res.StatusCode == http.StatusNotFound:
+		return res.StatusCode, plugin.ErrNotFound
+	case res.StatusCode == http.StatusForbidden:
+		return res.StatusCode, fmt.Errorf("vault: %s: %w", message(data), plugin.ErrDenied)
+	case res.StatusCode > 299:
+		return res.StatusCode, fmt.Errorf("vault: %s: %w", message(data), plugin.ErrUnavailable)
+	}
+	return res.StatusCode, json.Unmarshal(data, out)
+}
+
+// message returns the error message from the Vault error
+// response.
+func message(data []byte) string {
+	out := struct {
+		Errors []string `json:"errors"`
+	}{}
+	if json.Unmarshal(data, &out) == nil && len(out.Errors) != 0 {
+		return strings.Join(out.Errors, ", ")
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// escape escapes each segment of the path.
+func escape(path string) string {
+	parts := strings.Split(path, "/")
+	for i, part := range parts {
+		parts[i] = url.PathEscape(part)
+	}
+	return strings.Join(parts, "/")
+}
@@ -0,0 +1,278 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package vault provides a secret plugin that serves secrets
+// from a Vault KV version 2 secrets engine.
+//
+// The secret request path and name are mapped to a KV path and
+// key. The path can include a version and a key using the
+// path@version#key syntax, for example docker@3#password. If
+// the path does not include a key, the secret name is used as
+// the key. If the request has no path, the secret name must
+// include the path and key, for example docker#password.
+package vault
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/drone-go/plugin"
+	"github.com/drone/drone-go/plugin/secret"
+)
+
+// Default configuration.
+const (
+	DefaultMount     = "secret"
+	DefaultAuthMount = "approle"
+	DefaultCacheSize = 1000
+)
+
+// Config configures the Vault secret plugin.
+type Config struct {
+	// Address is the Vault server address, for example
+	// https://vault.company.com:8200.
+	Address string
+
+	// Namespace is the optional Vault Enterprise namespace.
+	Namespace string
+
+	// Mount is the mount path of the KV version 2 secrets
+	// engine. If empty, the DefaultMount is used.
+	Mount string
+
+	// Token is the Vault token. If empty, the plugin logs in
+	// using the AppRole credentials.
+	Token string
+
+	// RoleID and SecretID are the AppRole credentials. The
+	// plugin logs in when the first secret is requested, and
+	// logs in again before the token lease expires or if the
+	// token is rejected.
+	RoleID   string
+	SecretID string
+
+	// AuthMount is the mount path of the AppRole auth method.
+	// If empty, the DefaultAuthMount is used.
+	AuthMount string
+
+	// Template is an optional path prefix template. The
+	// template is executed with the secret.Request, for
+	// example ci/{{.Repo.Namespace}}/{{.Repo.Name}}, so that a
+	// repository can only read secrets below its prefix.
+	Template string
+
+	// TTL is the duration secrets are cached if the response
+	// has no lease duration. If zero, secrets without a lease
+	// are not cached.
+	TTL time.Duration
+
+	// CacheSize is the maximum number of cached secrets. If
+	// zero, the DefaultCacheSize is used.
+	CacheSize int
+
+	// Client is the http client. If nil, the
+	// http.DefaultClient is used.
+	Client *http.Client
+}
+
+// New returns a secret plugin that serves secrets from Vault.
+func New(config Config) (secret.Plugin, error) {
+	if config.Address == "" {
+		return nil, fmt.Errorf("vault: missing address")
+	}
+	if config.Token == "" && config.RoleID == "" {
+		return nil, fmt.Errorf("vault: missing token or approle credentials")
+	}
+	if config.Mount == "" {
+		config.Mount = DefaultMount
+	}
+	if config.AuthMount == "" {
+		config.AuthMount = DefaultAuthMount
+	}
+	if config.Client == nil {
+		config.Client = http.DefaultClient
+	}
+	if config.CacheSize <= 0 {
+		config.CacheSize = DefaultCacheSize
+	}
+	p := &provider{
+		config: config,
+		token:  config.Token,
+		cache:  map[string]*entry{},
+		now:    time.Now,
+	}
+	if config.Template != "" {
+		tmpl, err := template.New("path").Option("missingkey=error").Parse(config.Template)
+		if err != nil {
+			return nil, fmt.Errorf("vault: invalid path template: %s", err)
+		}
+		p.template = tmpl
+	}
+	return p, nil
+}
+
+type provider struct {
+	config   Config
+	template *template.Template
+	now      func() time.Time
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+	login   *login
+	cache   map[string]*entry
+}
+
+// entry is a cached secret.
+type entry struct {
+	data    map[string]string
+	expires time.Time
+}
+
+// login is an AppRole login in progress.
+type login struct {
+	done  chan struct{}
+	token string
+	err   error
+}
+
+func (p *provider) Find(ctx context.Context, req *secret.Request) (*drone.Secret, error) {
+	ref, err := p.resolve(req)
+	if err != nil {
+		return nil, err
+	}
+	data, err := p.read(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	value, ok := data[ref.key]
+	if !ok {
+		return nil, plugin.ErrNotFound
+	}
+	return &drone.Secret{
+		Name: req.Name,
+		Data: value,
+	}, nil
+}
+
+// ref is a reference to a key in a KV secret.
+type ref struct {
+	path    string
+	version int
+	key     string
+}
+
+// resolve resolves the KV path, version and key requested by
+// the secret request.
+func (p *provider) resolve(req *secret.Request) (*ref, error) {
+	spec, key := req.Path, req.Name
+	if spec == "" {
+		spec, key = req.Name, ""
+	}
+	r := new(ref)
+	if i := strings.LastIndex(spec, "#"); i != -1 {
+		spec, key = spec[:i], spec[i+1:]
+	}
+	if i := strings.LastIndex(spec, "@"); i != -1 {
+		version, err := strconv.Atoi(spec[i+1:])
+		if err != nil || version < 1 {
+			return nil, fmt.Errorf("vault: invalid secret version %q: %w", spec[i+1:], plugin.ErrNotFound)
+		}
+		spec, r.version = spec[:i], version
+	}
+	if key == "" {
+		return nil, fmt.Errorf("vault: missing secret key: %w", plugin.ErrNotFound)
+	}
+	r.key = key
+
+	// the path is cleaned as an absolute path so that it
+	// cannot escape the path prefix.
+	r.path = strings.TrimPrefix(path.Clean("/"+spec), "/")
+	if r.path == "" {
+		return nil, fmt.Errorf("vault: missing secret path: %w", plugin.ErrNotFound)
+	}
+	if p.template != nil {
+		var buf bytes.Buffer
+		if err := p.template.Execute(&buf, req); err != nil {
+			return nil, fmt.Errorf("vault: cannot execute path template: %s", err)
+		}
+		prefix := strings.Trim(path.Clean("/"+buf.String()), "/")
+		if prefix != "" {
+			r.path = prefix + "/" + r.path
+		}
+	}
+	return r, nil
+}
+
+// read returns the secret data, from the cache if the cached
+// secret has not expired.
+func (p *provider) read(ctx context.Context, r *ref) (map[string]string, error) {
+	key := r.path + "@" + strconv.Itoa(r.version)
+
+	p.mu.Lock()
+	cached, ok := p.cache[key]
+	if ok && p.now().Before(cached.expires) {
+		p.mu.Unlock()
+		return cached.data, nil
+	}
+	delete(p.cache, key)
+	p.mu.Unlock()
+
+	data, lease, err := p.get(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	ttl := lease
+	if ttl == 0 {
+		ttl = p.config.TTL
+	}
+	if ttl > 0 {
+		p.mu.Lock()
+		p.store(key, &entry{data: data, expires: p.now().Add(ttl)})
+		p.mu.Unlock()
+	}
+	return data, nil
+}
+
+// store adds the entry to the cache. If the cache is full, the
+// expired entries are removed, and if the cache is still full,
+// the entry that expires first is removed. The caller must hold
+// the lock.
+func (p *provider) store(key string, e *entry) {
+	if _, ok := p.cache[key]; !ok && len(p.cache) >= p.config.CacheSize {
+		now := p.now()
+		var oldest string
+		for k, v := range p.cache {
+			if !now.Before(v.expires) {
+				delete(p.cache, k)
+			} else if oldest == "" || v.expires.Before(p.cache[oldest].expires) {
+				oldest = k
+			}
+		}
+		if len(p.cache) >= p.config.CacheSize {
+			delete(p.cache, oldest)
+		}
+	}
+	p.cache[key] = e
+}
@@ -0,0 +1,296 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package plugin provides a runner that serves plugin http
+// handlers with graceful shutdown, optional tls and health
+// check endpoints.
+package plugin
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/drone/drone-go/plugin/logger"
+)
+
+// Environment variables used to configure the plugin server.
+const (
+	EnvBind            = "DRONE_BIND"
+	EnvSecret          = "DRONE_SECRET"
+	EnvTLSCert         = "DRONE_TLS_CERT"
+	EnvTLSKey          = "DRONE_TLS_KEY"
+	EnvShutdownTimeout = "DRONE_SHUTDOWN_TIMEOUT"
+)
+
+// Default server configuration.
+const (
+	DefaultAddr              = ":3000"
+	DefaultShutdownTimeout   = 30 * time.Second
+	DefaultReadHeaderTimeout = 10 * time.Second
+)
+
+// Health check endpoints. Requests to these endpoints are not
+// routed to the plugin handler and do not require a signature.
+const (
+	PathHealthz = "/healthz"
+	PathReadyz  = "/readyz"
+)
+
+var (
+	// errNoHandler is returned when the plugin handler is nil.
+	errNoHandler = errors.New("plugin: missing http.Handler")
+
+	// errNoSecret is returned when the plugin handler is built
+	// from the shared secret and the secret is empty.
+	errNoSecret = errors.New("plugin: missing shared secret")
+)
+
+// Options configures the plugin server.
+type Options struct {
+	// Handler is the plugin http.Handler, for example the
+	// handler returned by secret.Handler. If nil, the handler
+	// is built by NewHandler.
+	Handler http.Handler
+
+	// NewHandler returns the plugin http.Handler that verifies
+	// requests using the shared secret, for example:
+	//
+	//   func(s string) http.Handler {
+	//     return secret.Handler(s, plugin, logs)
+	//   }
+	//
+	// It is used if the Handler is nil.
+	NewHandler func(secret string) http.Handler
+
+	// Addr is the address the server listens on. If empty,
+	// the DRONE_BIND environment variable is used, and if
+	// not set, the DefaultAddr.
+	Addr string
+
+	// Listener is an optional listener. If set, the Addr is
+	// ignored.
+	Listener net.Listener
+
+	// Secret is the shared secret passed to NewHandler. If
+	// empty, the DRONE_SECRET environment variable is used. The
+	// server refuses to start if NewHandler is set and the
+	// secret is empty. The secret is not used if the Handler
+	// is set.
+	Secret string
+
+	// CertFile and KeyFile are the paths to the tls certificate
+	// and private key. If set, the server serves https, and the
+	// certificate is reloaded when the files change. If empty,
+	// the DRONE_TLS_CERT and DRONE_TLS_KEY environment variables
+	// are used.
+	CertFile string
+	KeyFile  string
+
+	// ShutdownTimeout is the maximum time to wait for active
+	// connections to drain on shutdown. If zero, the
+	// DRONE_SHUTDOWN_TIMEOUT environment variable is used, and
+	// if not set, the DefaultShutdownTimeout.
+	ShutdownTimeout time.Duration
+
+	// ReadHeaderTimeout is the maximum time to read the request
+	// headers. If zero, the DefaultReadHeaderTimeout is used.
+	ReadHeaderTimeout time.Duration
+
+	// Ready is an optional readiness check. The /readyz
+	// endpoint returns 503 Service Unavailable if the check
+	// returns an error.
+	Ready func(context.Context) error
+
+	// Logger is an optional logger.
+	Logger logger.Logger
+}
+
+// FromEnv returns the Options loaded from the environment. An
+// error is returned if the shutdown timeout is not a valid,
+// positive duration.
+func FromEnv() (Options, error) {
+	opts := Options{
+		Addr:     os.Getenv(EnvBind),
+		Secret:   os.Getenv(EnvSecret),
+		CertFile: os.Getenv(EnvTLSCert),
+		KeyFile:  os.Getenv(EnvTLSKey),
+	}
+	if s := os.Getenv(EnvShutdownTimeout); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return opts, fmt.Errorf("plugin: invalid %s: %s", EnvShutdownTimeout, err)
+		}
+		if d <= 0 {
+			return opts, fmt.Errorf("plugin: invalid %s: must be positive", EnvShutdownTimeout)
+		}
+		opts.ShutdownTimeout = d
+	}
+	return opts, nil
+}
+
+// Serve serves the plugin handler until the context is
+// canceled or the process receives SIGINT or SIGTERM, and then
+// shuts down gracefully, waiting for active requests to
+// complete. Unset options are loaded from the environment.
+func Serve(ctx context.Context, opts Options) error {
+	if opts.Handler == nil && opts.NewHandler == nil {
+		return errNoHandler
+	}
+	opts, err := opts.withDefaults()
+	if err != nil {
+		return err
+	}
+	if opts.Handler == nil {
+		if opts.Secret == "" {
+			return errNoSecret
+		}
+		opts.Handler = opts.NewHandler(opts.Secret)
+	}
+	logs := opts.Logger
+
+	var tlsConfig *tls.Config
+	if opts.CertFile != "" || opts.KeyFile != "" {
+		certs, err := newCertLoader(opts.CertFile, opts.KeyFile)
+		if err != nil {
+			return err
+		}
+		tlsConfig = &tls.Config{
+			GetCertificate: certs.GetCertificate,
+			MinVersion:     tls.VersionTLS12,
+		}
+	}
+
+	listener := opts.Listener
+	if listener == nil {
+		listener, err = net.Listen("tcp", opts.Addr)
+		if err != nil {
+			return err
+		}
+	}
+	if tlsConfig != nil {
+		listener = tls.NewListener(listener, tlsConfig)
+	}
+
+	var stopping int32
+	mux := http.NewServeMux()
+	mux.HandleFunc(PathHealthz, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc(PathReadyz, func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&stopping) == 1 {
+			http.Error(w, "Shutting Down", http.StatusServiceUnavailable)
+			return
+		}
+		if opts.Ready != nil {
+			if err := opts.Ready(r.Context()); err != nil {
+				http.Error(w, err.Error(), http.StatusServiceUnavailable)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.Handle("/", opts.Handler)
+
+	srv := &http.Server{
+		Handler:           mux,
+		TLSConfig:         tlsConfig,
+		ReadHeaderTimeout: opts.ReadHeaderTimeout,
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+	go func() {
+		select {
+		case sig := <-sigs:
+			logs.Infof("plugin: received signal %s", sig)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	errc := make(chan error, 1)
+	go func() {
+		logs.Infof("plugin: listening on %s", listener.Addr())
+		errc <- srv.Serve(listener)
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	// stop reporting ready so that load balancers stop
+	// routing new requests, and drain active connections.
+	atomic.StoreInt32(&stopping, 1)
+	logs.Infof("plugin: shutting down")
+
+	shutdown, done := context.WithTimeout(context.Background(), opts.ShutdownTimeout)
+	defer done()
+	if err := srv.Shutdown(shutdown); err != nil {
+		return err
+	}
+	if err := <-errc; err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// withDefaults returns the options with unset values loaded
+// from the environment or set to the default value.
+func (opts Options) withDefaults() (Options, error) {
+	env, err := FromEnv()
+	if err != nil {
+		return opts, err
+	}
+	if opts.Addr == "" {
+		opts.Addr = env.Addr
+	}
+	if opts.Addr == "" {
+		opts.Addr = DefaultAddr
+	}
+	if opts.Secret == "" {
+		opts.Secret = env.Secret
+	}
+	if opts.CertFile == "" && opts.KeyFile == "" {
+		opts.CertFile = env.CertFile
+		opts.KeyFile = env.KeyFile
+	}
+	if opts.ShutdownTimeout == 0 {
+		opts.ShutdownTimeout = env.ShutdownTimeout
+	}
+	if opts.ShutdownTimeout == 0 {
+		opts.ShutdownTimeout = DefaultShutdownTimeout
+	}
+	if opts.ReadHeaderTimeout == 0 {
+		opts.ReadHeaderTimeout = DefaultReadHeaderTimeout
+	}
+	if opts.Logger == nil {
+		opts.Logger = logger.Discard()
+	}
+	return opts, nil
+}
@@ -0,0 +1,258 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestServe(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := "http://" + listener.Addr().String()
+
+	var ready error
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() {
+		errc <- Serve(ctx, Options{
+			Handler:  handler,
+			Listener: listener,
+			Ready:    func(context.Context) error { return ready },
+		})
+	}()
+
+	tests := []struct {
+		path string
+		code int
+	}{
+		{PathHealthz, http.StatusOK},
+		{PathReadyz, http.StatusOK},
+		{"/", http.StatusTeapot},
+		{"/secret", http.StatusTeapot},
+	}
+	for _, test := range tests {
+		if got, want := get(t, addr+test.path), test.code; got != want {
+			t.Errorf("Want status code %d for %s, got %d", want, test.path, got)
+		}
+	}
+
+	ready = errors.New("backend unavailable")
+	if got, want := get(t, addr+PathReadyz), http.StatusServiceUnavailable; got != want {
+		t.Errorf("Want status code %d when not ready, got %d", want, got)
+	}
+
+	cancel()
+	select {
+	case err := <-errc:
+		if err != nil {
+			t.Errorf("Want graceful shutdown, got %s", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("Want server stopped after the context is canceled")
+	}
+}
+
+func TestServe_NoHandler(t *testing.T) {
+	if err := Serve(context.Background(), Options{}); err != errNoHandler {
+		t.Errorf("Want errNoHandler, got %v", err)
+	}
+}
+
+func TestServe_NewHandler(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := "http://" + listener.Addr().String()
+
+	var got string
+	newHandler := func(secret string) http.Handler {
+		got = secret
+		return http.NotFoundHandler()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() {
+		errc <- Serve(ctx, Options{
+			NewHandler: newHandler,
+			Secret:     "correct-horse-battery-staple",
+			Listener:   listener,
+		})
+	}()
+	get(t, addr+PathHealthz)
+	cancel()
+	if err := <-errc; err != nil {
+		t.Error(err)
+	}
+	if want := "correct-horse-battery-staple"; got != want {
+		t.Errorf("Want handler built from the secret %q, got %q", want, got)
+	}
+}
+
+func TestServe_NoSecret(t *testing.T) {
+	os.Unsetenv(EnvSecret)
+	err := Serve(context.Background(), Options{
+		NewHandler: func(string) http.Handler { return http.NotFoundHandler() },
+	})
+	if err != errNoSecret {
+		t.Errorf("Want errNoSecret, got %v", err)
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	os.Setenv(EnvBind, ":8080")
+	os.Setenv(EnvSecret, "correct-horse-battery-staple")
+	os.Setenv(EnvShutdownTimeout, "5s")
+	defer func() {
+		os.Unsetenv(EnvBind)
+		os.Unsetenv(EnvSecret)
+		os.Unsetenv(EnvShutdownTimeout)
+	}()
+
+	opts, err := FromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := opts.Addr, ":8080"; got != want {
+		t.Errorf("Want addr %s, got %s", want, got)
+	}
+	if got, want := opts.Secret, "correct-horse-battery-staple"; got != want {
+		t.Errorf("Want secret %s, got %s", want, got)
+	}
+	if got, want := opts.ShutdownTimeout, 5*time.Second; got != want {
+		t.Errorf("Want shutdown timeout %s, got %s", want, got)
+	}
+
+	opts, _ = Options{Addr: ":9000"}.withDefaults()
+	if got, want := opts.Addr, ":9000"; got != want {
+		t.Errorf("Want explicit addr %s, got %s", want, got)
+	}
+	if got, want := opts.ReadHeaderTimeout, DefaultReadHeaderTimeout; got != want {
+		t.Errorf("Want read header timeout %s, got %s", want, got)
+	}
+
+	for _, s := range []string{"5", "-1s", "0s"} {
+		os.Setenv(EnvShutdownTimeout, s)
+		if _, err := FromEnv(); err == nil {
+			t.Errorf("Want error for shutdown timeout %q", s)
+		}
+	}
+}
+
+func TestCertLoader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "drone-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	writeCert(t, certFile, keyFile, "foo")
+
+	loader, err := newCertLoader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	loader.now = func() time.Time { return now }
+	before, _ := loader.GetCertificate(nil)
+
+	// rewrite the certificate with a later modification time
+	// and verify the new certificate is not served until the
+	// check interval elapses.
+	writeCert(t, certFile, keyFile, "bar")
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, later, later)
+
+	if cert, _ := loader.GetCertificate(nil); cert != before {
+		t.Errorf("Want files checked at most once per interval")
+	}
+
+	now = now.Add(certCheckInterval)
+	after, err := loader.GetCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(before.Certificate[0], after.Certificate[0]) {
+		t.Errorf("Want certificate reloaded after the file is modified")
+	}
+
+	// a broken certificate file must not interrupt serving
+	// the previously loaded certificate.
+	ioutil.WriteFile(certFile, []byte("invalid"), 0600)
+	later = later.Add(time.Minute)
+	os.Chtimes(certFile, later, later)
+	now = now.Add(certCheckInterval)
+	if cert, err := loader.GetCertificate(nil); err != nil || cert != after {
+		t.Errorf("Want previous certificate served when reload fails")
+	}
+}
+
+func get(t *testing.T, url string) int {
+	res, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	return res.StatusCode
+}
+
+func writeCert(t *testing.T, certFile, keyFile, name string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+}
@@ -0,0 +1,249 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package server provides a http.Handler that serves multiple
+// plugin types from a single endpoint.
+package server
+
+import (
+	"errors"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/drone/drone-go/plugin"
+	"github.com/drone/drone-go/plugin/admission"
+	"github.com/drone/drone-go/plugin/config"
+	"github.com/drone/drone-go/plugin/converter"
+	"github.com/drone/drone-go/plugin/environ"
+	"github.com/drone/drone-go/plugin/logger"
+	"github.com/drone/drone-go/plugin/middleware"
+	"github.com/drone/drone-go/plugin/registry"
+	"github.com/drone/drone-go/plugin/secret"
+	"github.com/drone/drone-go/plugin/validator"
+	"github.com/drone/drone-go/plugin/webhook"
+)
+
+// Plugin kinds, as they appear in the versioned media type
+// (e.g. application/vnd.drone.secret.v1+json) and in the
+// request path (e.g. /secret). The request path may also use
+// the plugin package name (e.g. /environ for /env).
+const (
+	KindAdmission = "admission"
+	KindConfig    = "config"
+	KindConverter = "convert"
+	KindEnviron   = "env"
+	KindRegistry  = "registry"
+	KindSecret    = "secret"
+	KindValidator = "validate"
+	KindWebhook   = "webhook"
+)
+
+// aliases maps the plugin package names to the plugin kind,
+// for the packages whose name differs from the kind.
+var aliases = map[string]string{
+	"converter": KindConverter,
+	"environ":   KindEnviron,
+	"validator": KindValidator,
+}
+
+// errUnknownPlugin is returned when registering a value that
+// does not implement any plugin interface.
+var errUnknownPlugin = errors.New("server: value does not implement a plugin interface")
+
+// Server serves any combination of plugins from a single
+// http.Handler. Requests are routed to the plugin by the
+// versioned Accept media type or, if the Accept header is not
+// a plugin media type, by the last element of the request
+// path. All plugins share a single signature verifier, logger
+// and middleware stack.
+type Server struct {
+	// Secret is the shared secret used to verify requests.
+	Secret string
+
+	// Logger is the logger shared by all plugins.
+	Logger logger.Logger
+
+	// Options configures the middleware shared by all
+	// plugins.
+	Options []middleware.Option
+
+	// Middleware is an optional list of http middleware
+	// applied to every request, before the request is
+	// routed and verified.
+	Middleware []func(http.Handler) http.Handler
+
+	Admission admission.Plugin
+	Config    config.Plugin
+	Converter converter.Plugin
+	Environ   environ.Plugin
+	Registry  registry.Plugin
+	Secrets   secret.Plugin
+	Validator validator.Plugin
+	Webhook   webhook.Plugin
+}
+
+// New returns a new Server that serves the plugins. Each
+// plugin is registered for every plugin interface it
+// implements.
+func New(secret string, plugins ...interface{}) (*Server, error) {
+	s := &Server{Secret: secret}
+	for _, plugin := range plugins {
+		if err := s.Register(plugin); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Register registers the plugin for every plugin interface it
+// implements. It returns an error if the plugin does not
+// implement any plugin interface.
+func (s *Server) Register(plugin interface{}) error {
+	var ok bool
+	if p, is := plugin.(admission.Plugin); is {
+		s.Admission, ok = p, true
+	}
+	if p, is := plugin.(config.Plugin); is {
+		s.Config, ok = p, true
+	}
+	if p, is := plugin.(converter.Plugin); is {
+		s.Converter, ok = p, true
+	}
+	if p, is := plugin.(environ.Plugin); is {
+		s.Environ, ok = p, true
+	}
+	if p, is := plugin.(registry.Plugin); is {
+		s.Registry, ok = p, true
+	}
+	if p, is := plugin.(secret.Plugin); is {
+		s.Secrets, ok = p, true
+	}
+	if p, is := plugin.(validator.Plugin); is {
+		s.Validator, ok = p, true
+	}
+	if p, is := plugin.(webhook.Plugin); is {
+		s.Webhook, ok = p, true
+	}
+	if !ok {
+		return errUnknownPlugin
+	}
+	return nil
+}
+
+// Handler returns the http.Handler that routes requests to
+// the registered plugins. Changes to the Server after the
+// handler is created have no effect on the handler.
+func (s *Server) Handler() http.Handler {
+	logs := s.Logger
+	if logs == nil {
+		logs = logger.Discard()
+	}
+
+	// create a single verifier that is shared by all plugin
+	// handlers, so that replay detection and key rotation
+	// apply across plugin types.
+	conf := new(middleware.Config)
+	for _, opt := range s.Options {
+		opt(conf)
+	}
+	verifier := conf.Verifier
+	if verifier == nil {
+		verifier = middleware.NewVerifier(s.Secret)
+		verifier.Keys = conf.Keyring
+	}
+	opts := append(s.Options[:len(s.Options):len(s.Options)], middleware.WithVerifier(verifier))
+
+	routes := map[string]http.Handler{}
+	if s.Admission != nil {
+		routes[KindAdmission] = admission.Handler(s.Admission, s.Secret, logs, opts...)
+	}
+	if s.Config != nil {
+		routes[KindConfig] = config.Handler(s.Config, s.Secret, logs, opts...)
+	}
+	if s.Converter != nil {
+		routes[KindConverter] = converter.Handler(s.Converter, s.Secret, logs, opts...)
+	}
+	if s.Environ != nil {
+		routes[KindEnviron] = environ.Handler(s.Secret, s.Environ, logs, opts...)
+	}
+	if s.Registry != nil {
+		routes[KindRegistry] = registry.Handler(s.Secret, s.Registry, logs, opts...)
+	}
+	if s.Secrets != nil {
+		routes[KindSecret] = secret.Handler(s.Secret, s.Secrets, logs, opts...)
+	}
+	if s.Validator != nil {
+		routes[KindValidator] = validator.Handler(s.Secret, s.Validator, logs, opts...)
+	}
+	if s.Webhook != nil {
+		routes[KindWebhook] = webhook.Handler(s.Webhook, s.Secret, logs, opts...)
+	}
+
+	// requests for an unknown plugin kind are verified before
+	// the error is returned, so that unsigned callers cannot
+	// probe which plugin kinds are registered.
+	notFound := middleware.Wrap("server", s.Secret, logs, http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logs.Debugf("server: no plugin registered for %s %s", r.URL.Path, r.Header.Get("Accept"))
+			middleware.WriteError(w, plugin.ErrNotFound, http.StatusNotFound)
+		},
+	), opts...)
+
+	var handler http.Handler = &router{routes: routes, notFound: notFound}
+	for i := len(s.Middleware) - 1; i >= 0; i-- {
+		handler = s.Middleware[i](handler)
+	}
+	return handler
+}
+
+type router struct {
+	routes   map[string]http.Handler
+	notFound http.Handler
+}
+
+func (rt *router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	handler, ok := rt.routes[Kind(r)]
+	if !ok {
+		handler = rt.notFound
+	}
+	handler.ServeHTTP(w, r)
+}
+
+// Kind returns the plugin kind of the request. The kind is
+// parsed from the versioned Accept media type, and if not
+// present, from the last element of the request path, which
+// is either the kind or the plugin package name. For example,
+// the environ plugin is served at /env and /environ.
+func Kind(r *http.Request) string {
+	if kind := kindOf(r.Header.Get("Accept")); kind != "" {
+		return kind
+	}
+	kind := path.Base(r.URL.Path)
+	if alias, ok := aliases[kind]; ok {
+		return alias
+	}
+	return kind
+}
+
+// kindOf returns the plugin kind from a versioned media type
+// in the format application/vnd.drone.<kind>.v<N>+json.
+func kindOf(accept string) string {
+	for _, media := range strings.Split(accept, ",") {
+		if m, ok := middleware.ParseMediaType(media); ok {
+			return m.Kind
+		}
+	}
+	return ""
+}
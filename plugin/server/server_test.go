@@ -0,0 +1,307 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/drone-go/plugin/admission"
+	"github.com/drone/drone-go/plugin/config"
+	"github.com/drone/drone-go/plugin/converter"
+	"github.com/drone/drone-go/plugin/environ"
+	"github.com/drone/drone-go/plugin/internal/testutil"
+	"github.com/drone/drone-go/plugin/middleware"
+	"github.com/drone/drone-go/plugin/registry"
+	"github.com/drone/drone-go/plugin/secret"
+	"github.com/drone/drone-go/plugin/validator"
+	"github.com/drone/drone-go/plugin/webhook"
+)
+
+const key = "xVKAGlWQiY3sOp8JVc0nbuNId3PNCgWh"
+
+func TestServer(t *testing.T) {
+	s, err := New(key, &mockSecret{}, &mockEnviron{}, &mockRegistry{})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	server := httptest.NewServer(s.Handler())
+	defer server.Close()
+
+	// the plugin clients post to the root path and are
+	// routed using the versioned Accept media type.
+	ctx := context.Background()
+	sec, err := secret.Client(server.URL, key, false).Find(ctx, &secret.Request{Name: "password"})
+	if err != nil {
+		t.Error(err)
+	} else if got, want := sec.Data, "correct-horse-battery-staple"; got != want {
+		t.Errorf("Want secret %q, got %q", want, got)
+	}
+
+	envs, err := environ.Client(server.URL, key, false).List(ctx, &environ.Request{})
+	if err != nil {
+		t.Error(err)
+	} else if len(envs) != 1 || envs[0].Name != "GOOS" {
+		t.Errorf("Want environment variables from the environ plugin")
+	}
+
+	regs, err := registry.Client(server.URL, key, false).List(ctx, &registry.Request{})
+	if err != nil {
+		t.Error(err)
+	} else if len(regs) != 1 || regs[0].Address != "docker.io" {
+		t.Errorf("Want registries from the registry plugin")
+	}
+}
+
+func TestServer_Path(t *testing.T) {
+	s, _ := New(key, &mockSecret{})
+	handler := s.Handler()
+
+	tests := []struct {
+		path string
+		code int
+	}{
+		{"/secret", 200},
+		{"/plugins/secret", 200},
+		{"/registry", 404},
+		{"/", 404},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("POST", test.path, strings.NewReader(`{"name":"password"}`))
+		req.Header.Set("Accept", "application/json")
+		if err := testutil.Sign(req, key); err != nil {
+			t.Error(err)
+			return
+		}
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		if got, want := res.Code, test.code; got != want {
+			t.Errorf("Want status code %d for path %s, got %d", want, test.path, got)
+		}
+		if got, want := res.Header().Get("Content-Type"), "application/json"; test.code == 404 && got != want {
+			t.Errorf("Want JSON error for path %s, got Content-Type %q", test.path, got)
+		}
+	}
+}
+
+func TestServer_PathUnsigned(t *testing.T) {
+	s, _ := New(key, &mockSecret{})
+	handler := s.Handler()
+
+	// an unsigned request receives the same error for a
+	// registered and an unknown plugin kind.
+	for _, path := range []string{"/secret", "/registry"} {
+		req := httptest.NewRequest("POST", path, strings.NewReader(`{"name":"password"}`))
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		if got, want := res.Code, 400; got != want {
+			t.Errorf("Want status code %d for unsigned request to %s, got %d", want, path, got)
+		}
+	}
+}
+
+func TestServer_Kinds(t *testing.T) {
+	s, err := New(key,
+		&mockAdmission{},
+		&mockConfig{},
+		&mockConverter{},
+		&mockEnviron{},
+		&mockRegistry{},
+		&mockSecret{},
+		&mockValidator{},
+		&mockWebhook{},
+	)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	handler := s.Handler()
+
+	tests := []struct {
+		path   string
+		accept string
+	}{
+		{"/", admission.V1},
+		{"/", config.V1},
+		{"/", converter.V1},
+		{"/", environ.V1},
+		{"/", registry.V1},
+		{"/", secret.V1},
+		{"/", validator.V1},
+		{"/", webhook.V1},
+		{"/admission", "application/json"},
+		{"/config", "application/json"},
+		{"/convert", "application/json"},
+		{"/converter", "application/json"},
+		{"/env", "application/json"},
+		{"/environ", "application/json"},
+		{"/registry", "application/json"},
+		{"/secret", "application/json"},
+		{"/validate", "application/json"},
+		{"/validator", "application/json"},
+		{"/webhook", "application/json"},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("POST", test.path, strings.NewReader(`{}`))
+		req.Header.Set("Accept", test.accept)
+		if err := testutil.Sign(req, key); err != nil {
+			t.Error(err)
+			return
+		}
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		if res.Code > 299 {
+			t.Errorf("Want plugin served for path %s and media type %s, got status code %d", test.path, test.accept, res.Code)
+		}
+	}
+}
+
+func TestServer_SharedVerifier(t *testing.T) {
+	s, _ := New(key, &mockSecret{}, &mockRegistry{})
+	verifier := middleware.NewVerifier(key)
+	verifier.Cache = middleware.NewReplayCache()
+	verifier.ReplaySignatures = true
+	s.Options = []middleware.Option{middleware.WithVerifier(verifier)}
+	handler := s.Handler()
+
+	// a request to one plugin cannot be replayed against
+	// another plugin served by the same server.
+	req := httptest.NewRequest("POST", "/secret", strings.NewReader(`{}`))
+	if err := testutil.Sign(req, key); err != nil {
+		t.Error(err)
+		return
+	}
+	replay := req.Clone(context.Background())
+	replay.URL.Path = "/registry"
+	replay.Body = ioutil.NopCloser(strings.NewReader(`{}`))
+
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	if got, want := res.Code, 200; got != want {
+		t.Errorf("Want status code %d, got %d", want, got)
+	}
+
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, replay)
+	if got, want := res.Code, 401; got != want {
+		t.Errorf("Want replayed request rejected with status code %d, got %d", want, got)
+	}
+}
+
+func TestServer_Middleware(t *testing.T) {
+	var called bool
+	s, _ := New(key, &mockSecret{})
+	s.Middleware = append(s.Middleware, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			called = true
+			next.ServeHTTP(w, r)
+		})
+	})
+
+	req := httptest.NewRequest("POST", "/secret", nil)
+	s.Handler().ServeHTTP(httptest.NewRecorder(), req)
+	if !called {
+		t.Errorf("Want middleware invoked")
+	}
+}
+
+func TestRegister(t *testing.T) {
+	s := new(Server)
+	if err := s.Register(struct{}{}); err == nil {
+		t.Errorf("Want error registering a value that is not a plugin")
+	}
+	if err := s.Register(&mockSecret{}); err != nil {
+		t.Error(err)
+	}
+	if s.Secrets == nil {
+		t.Errorf("Want secret plugin registered")
+	}
+}
+
+func TestKind(t *testing.T) {
+	tests := []struct {
+		path, accept, kind string
+	}{
+		{"/", secret.V1, KindSecret},
+		{"/", environ.V2, KindEnviron},
+		{"/", "text/plain, " + registry.V1 + "; q=0.9", KindRegistry},
+		{"/convert", "application/json", KindConverter},
+		{"/api/validate", "", KindValidator},
+		{"/converter", "application/json", KindConverter},
+		{"/environ", "", KindEnviron},
+		{"/validator", "", KindValidator},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("POST", test.path, nil)
+		req.Header.Set("Accept", test.accept)
+		if got, want := Kind(req), test.kind; got != want {
+			t.Errorf("Want kind %q, got %q", want, got)
+		}
+	}
+}
+
+type mockSecret struct{}
+
+func (*mockSecret) Find(context.Context, *secret.Request) (*drone.Secret, error) {
+	return &drone.Secret{Name: "password", Data: "correct-horse-battery-staple"}, nil
+}
+
+type mockEnviron struct{}
+
+func (*mockEnviron) List(context.Context, *environ.Request) ([]*environ.Variable, error) {
+	return []*environ.Variable{{Name: "GOOS", Data: "linux"}}, nil
+}
+
+type mockRegistry struct{}
+
+func (*mockRegistry) List(context.Context, *registry.Request) ([]*drone.Registry, error) {
+	return []*drone.Registry{{Address: "docker.io"}}, nil
+}
+
+type mockAdmission struct{}
+
+func (*mockAdmission) Admit(context.Context, *admission.Request) (*drone.User, error) {
+	return &drone.User{Login: "octocat"}, nil
+}
+
+type mockConfig struct{}
+
+func (*mockConfig) Find(context.Context, *config.Request) (*drone.Config, error) {
+	return &drone.Config{Data: "kind: pipeline"}, nil
+}
+
+type mockConverter struct{}
+
+func (*mockConverter) Convert(context.Context, *converter.Request) (*drone.Config, error) {
+	return &drone.Config{Data: "kind: pipeline"}, nil
+}
+
+type mockValidator struct{}
+
+func (*mockValidator) Validate(context.Context, *validator.Request) error {
+	return nil
+}
+
+type mockWebhook struct{}
+
+func (*mockWebhook) Deliver(context.Context, *webhook.Request) error {
+	return nil
+}
@@ -0,0 +1,218 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package transport provides options to configure how the
+// plugin clients sign and send http requests.
+package transport
+
+import (
+	"crypto"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/drone-go/plugin/internal/httpsig"
+)
+
+// DefaultKeyID is the default keyId used to sign requests.
+const DefaultKeyID = "hmac-key"
+
+// Default retry configuration. Retries are disabled by
+// default and enabled with WithRetries.
+const (
+	DefaultRetries    = 0
+	DefaultMinBackoff = 100 * time.Millisecond
+	DefaultMaxBackoff = 2 * time.Second
+)
+
+// ErrCircuitOpen is returned when the circuit breaker is open
+// for every endpoint and the request is not attempted.
+var ErrCircuitOpen = &drone.Error{Code: http.StatusServiceUnavailable, Message: "Circuit Open", Retryable: true}
+
+// Config configures the plugin client.
+type Config struct {
+	// KeyID is the keyId included in the http signature. The
+	// plugin uses the keyId to select the secret used to verify
+	// the request and to encrypt the response.
+	KeyID string
+
+	// PrivateKey is an optional ed25519 or rsa private key. If
+	// set, requests are signed using the ed25519 or rsa-sha256
+	// algorithm instead of the hmac-sha256 shared secret, and
+	// the plugin only needs the public key to verify requests.
+	PrivateKey crypto.Signer
+
+	// Accept is an optional media type that overrides the
+	// media type requested by the client, for example to
+	// request version 1 of the environ API.
+	Accept string
+
+	// Encrypt requests an aesgcm encrypted response body.
+	// The response is decrypted using the shared secret.
+	// Only the secret, environ and registry plugins support
+	// encrypted responses, and only for requests signed with
+	// the shared secret. The plugin rejects encrypted requests
+	// signed with a PrivateKey.
+	Encrypt bool
+
+	// Endpoints is an optional list of endpoints used in
+	// addition to the endpoint passed to the client. Requests
+	// are sent to the first healthy endpoint, and retried
+	// requests fail over to the next endpoint, so failover
+	// requires Retries to be positive.
+	Endpoints []string
+
+	// RoundRobin distributes requests across all endpoints
+	// instead of preferring the first healthy endpoint.
+	RoundRobin bool
+
+	// Retries is the maximum number of times a request is
+	// retried after a connection error that occurred before
+	// the request was sent. The secret, registry, environ,
+	// config and converter plugins do not modify state, and
+	// their requests are also retried after any connection
+	// error or a 502, 503 or 504 response. Requests to the
+	// admission, validator and webhook plugins are never
+	// retried once they may have reached the plugin. If zero
+	// or negative, requests are not retried.
+	Retries int
+
+	// MinBackoff and MaxBackoff bound the exponential backoff
+	// between retries.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// FailureThreshold is the number of consecutive failures
+	// after which the circuit breaker for an endpoint opens
+	// and requests to the endpoint fail fast. If zero, the
+	// circuit breaker is disabled.
+	FailureThreshold int
+
+	// Cooldown is the duration the circuit breaker stays open
+	// before a single trial request is allowed.
+	Cooldown time.Duration
+}
+
+// Option configures the plugin client.
+type Option func(*Config)
+
+// WithKeyID returns an option to sign requests with the named
+// key. The secret passed to the client must be the secret the
+// plugin associates with this keyId.
+func WithKeyID(id string) Option {
+	return func(c *Config) {
+		c.KeyID = id
+	}
+}
+
+// WithPrivateKey returns an option to sign requests with the
+// named ed25519 or rsa private key.
+func WithPrivateKey(id string, key crypto.Signer) Option {
+	return func(c *Config) {
+		c.KeyID = id
+		c.PrivateKey = key
+	}
+}
+
+// WithAccept returns an option to override the media type
+// requested by the client.
+func WithAccept(media string) Option {
+	return func(c *Config) {
+		c.Accept = media
+	}
+}
+
+// WithEncryption returns an option to request an aesgcm
+// encrypted response body.
+func WithEncryption() Option {
+	return func(c *Config) {
+		c.Encrypt = true
+	}
+}
+
+// WithEndpoints returns an option to add endpoints used for
+// failover or round-robin load balancing.
+func WithEndpoints(endpoints ...string) Option {
+	return func(c *Config) {
+		c.Endpoints = append(c.Endpoints, endpoints...)
+	}
+}
+
+// WithRoundRobin returns an option to distribute requests
+// across all endpoints.
+func WithRoundRobin() Option {
+	return func(c *Config) {
+		c.RoundRobin = true
+	}
+}
+
+// WithRetries returns an option to set the maximum number of
+// retries. Requests are not retried unless this option is
+// used with a positive value.
+func WithRetries(n int) Option {
+	return func(c *Config) {
+		c.Retries = n
+	}
+}
+
+// WithBackoff returns an option to set the minimum and maximum
+// backoff between retries.
+func WithBackoff(min, max time.Duration) Option {
+	return func(c *Config) {
+		c.MinBackoff = min
+		c.MaxBackoff = max
+	}
+}
+
+// WithCircuitBreaker returns an option to open the circuit for
+// an endpoint after the number of consecutive failures, and to
+// allow a trial request after the cooldown.
+func WithCircuitBreaker(threshold int, cooldown time.Duration) Option {
+	return func(c *Config) {
+		c.FailureThreshold = threshold
+		c.Cooldown = cooldown
+	}
+}
+
+// New returns the client configuration with the options
+// applied.
+func New(opts ...Option) *Config {
+	config := &Config{
+		KeyID:      DefaultKeyID,
+		Retries:    DefaultRetries,
+		MinBackoff: DefaultMinBackoff,
+		MaxBackoff: DefaultMaxBackoff,
+	}
+	for _, opt := range opts {
+		opt(config)
+	}
+	return config
+}
+
+// ParsePrivateKey parses a PEM encoded ed25519 or rsa private
+// key in PKCS8 or PKCS1 form.
+func ParsePrivateKey(data []byte) (crypto.Signer, error) {
+	return httpsig.ParsePrivateKey(data)
+}
+
+// LoadPrivateKey reads and parses a PEM encoded ed25519 or rsa
+// private key from the file.
+func LoadPrivateKey(path string) (crypto.Signer, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePrivateKey(data)
+}
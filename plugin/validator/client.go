@@ -19,12 +19,15 @@ import (
 
 	"github.com/drone/drone-go/drone"
 	"github.com/drone/drone-go/plugin/internal/client"
+	"github.com/drone/drone-go/plugin/transport"
 )
 
 // Client returns a new plugin client.
-func Client(endpoint, secret string, skipverify bool) Plugin {
-	client := client.New(endpoint, secret, skipverify)
-	client.Accept = V1
+func Client(endpoint, secret string, skipverify bool, opts ...transport.Option) Plugin {
+	client := client.New(endpoint, secret, skipverify, opts...)
+	if client.Accept == "" {
+		client.Accept = V1
+	}
 	return &pluginClient{
 		client: client,
 	}
@@ -37,10 +40,10 @@ type pluginClient struct {
 func (c *pluginClient) Validate(ctx context.Context, in *Request) error {
 	err := c.client.Do(ctx, in, nil)
 	if xerr, ok := err.(*drone.Error); ok {
-		if xerr.Code == httpStatusSkip {
+		if xerr.Code == StatusSkip {
 			return ErrSkip
 		}
-		if xerr.Code == httpStatusBlock {
+		if xerr.Code == StatusBlock {
 			return ErrBlock
 		}
 	}
@@ -0,0 +1,69 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validator
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// All returns a Plugin that invokes the plugins in parallel and
+// passes only if all plugins pass. A validation error takes
+// precedence over ErrBlock, and ErrBlock takes precedence over
+// ErrSkip, so that a plugin cannot skip a build that another
+// plugin requires to be approved. If multiple plugins return a
+// validation error, the error of the first plugin is returned.
+func All(plugins ...Plugin) Plugin {
+	return &all{plugins: plugins}
+}
+
+type all struct {
+	plugins []Plugin
+}
+
+func (p *all) Validate(ctx context.Context, req *Request) error {
+	errs := make([]error, len(p.plugins))
+
+	var wg sync.WaitGroup
+	for i, plugin := range p.plugins {
+		wg.Add(1)
+		go func(i int, plugin Plugin) {
+			defer wg.Done()
+			errs[i] = plugin.Validate(ctx, req)
+		}(i, plugin)
+	}
+	wg.Wait()
+
+	var skip, block bool
+	for _, err := range errs {
+		switch {
+		case err == nil:
+		case errors.Is(err, ErrBlock):
+			block = true
+		case errors.Is(err, ErrSkip):
+			skip = true
+		default:
+			return err
+		}
+	}
+	if block {
+		return ErrBlock
+	}
+	if skip {
+		return ErrSkip
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestAll(t *testing.T) {
+	errFoo := errors.New("foo")
+	tests := []struct {
+		errs []error
+		want error
+	}{
+		{[]error{nil, nil}, nil},
+		{[]error{nil, ErrBlock}, ErrBlock},
+		{[]error{nil, ErrSkip}, ErrSkip},
+		{[]error{ErrSkip, ErrBlock}, ErrBlock},
+		{[]error{ErrBlock, ErrSkip}, ErrBlock},
+		{[]error{fmt.Errorf("policy: %w", ErrSkip)}, ErrSkip},
+		{[]error{ErrSkip, fmt.Errorf("policy: %w", ErrBlock)}, ErrBlock},
+		{[]error{ErrSkip, errFoo, ErrBlock}, errFoo},
+		{nil, nil},
+	}
+	for i, test := range tests {
+		var plugins []Plugin
+		for _, err := range test.errs {
+			plugins = append(plugins, &mockPlugin{err: err})
+		}
+		if got := All(plugins...).Validate(context.Background(), &Request{}); got != test.want {
+			t.Errorf("Test %d: want error %v, got %v", i, test.want, got)
+		}
+	}
+}
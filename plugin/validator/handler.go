@@ -15,21 +15,25 @@
 package validator
 
 import (
-	"encoding/json"
 	"io/ioutil"
 	"net/http"
 
-	"github.com/drone/drone-go/drone"
 	"github.com/drone/drone-go/plugin/logger"
-
-	"github.com/99designs/httpsignatures-go"
+	"github.com/drone/drone-go/plugin/middleware"
 )
 
+// Non-standard http status codes returned by the handler when
+// the plugin skips or blocks the pipeline.
 const (
-	httpStatusSkip  = 498
-	httpStatusBlock = 499
+	StatusSkip  = 498
+	StatusBlock = 499
 )
 
+// versions are the supported versions of the validator API.
+var versions = middleware.NewVersions(map[string]middleware.Codec{
+	V1: middleware.JSON,
+})
+
 // Handler returns a http.Handler that accepts JSON-encoded
 // HTTP requests to validate the yaml configuration, invokes
 // the underlying plugin. A 2xx status code is returned if
@@ -37,12 +41,18 @@ const (
 //
 // The handler verifies the authenticity of the HTTP request
 // using the http-signature, and returns a 400 Bad Request if
-// the signature is missing or invalid.
+// the signature is missing or invalid. The handler also
+// verifies the request body matches the signed digest and the
+// signed date is within the allowed clock skew.
+//
+// The handler negotiates the API version using the Accept
+// header, and returns a 406 Not Acceptable if the client does
+// not accept a supported version.
 //
 // The handler can optionally encrypt the response body using
 // aesgcm if the HTTP request includes the Accept-Encoding header
 // set to aesgcm.
-func Handler(secret string, plugin Plugin, logs logger.Logger) http.Handler {
+func Handler(secret string, plugin Plugin, logs logger.Logger, opts ...middleware.Option) http.Handler {
 	handler := &handler{
 		secret: secret,
 		plugin: plugin,
@@ -51,7 +61,7 @@ func Handler(secret string, plugin Plugin, logs logger.Logger) http.Handler {
 	if handler.logger == nil {
 		handler.logger = logger.Discard()
 	}
-	return handler
+	return middleware.Wrap("validator", secret, handler.logger, handler, opts...)
 }
 
 type handler struct {
@@ -61,30 +71,25 @@ type handler struct {
 }
 
 func (p *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	signature, err := httpsignatures.FromRequest(r)
+	codec, err := versions.Negotiate(w, r)
 	if err != nil {
-		p.logger.Debugf("validator: invalid or missing signature in http.Request")
-		http.Error(w, "Invalid or Missing Signature", http.StatusBadRequest)
-		return
-	}
-	if !signature.IsValid(p.secret, r) {
-		p.logger.Debugf("validator: invalid signature in http.Request")
-		http.Error(w, "Invalid Signature", http.StatusBadRequest)
+		p.logger.Debugf("validator: unsupported media type: %s", r.Header.Get("Accept"))
+		middleware.WriteError(w, err, http.StatusNotAcceptable)
 		return
 	}
 
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		p.logger.Debugf("validator: cannot read http.Request body")
-		w.WriteHeader(http.StatusBadRequest)
+		middleware.WriteError(w, err, http.StatusBadRequest)
 		return
 	}
 
 	req := &Request{}
-	err = json.Unmarshal(body, req)
+	err = codec.Decode(body, req)
 	if err != nil {
 		p.logger.Debugf("validator: cannot unmarshal http.Request body")
-		http.Error(w, "Invalid Input", http.StatusBadRequest)
+		middleware.WriteError(w, middleware.ErrInvalidInput, http.StatusBadRequest)
 		return
 	}
 
@@ -95,25 +100,14 @@ func (p *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err == ErrSkip {
-		w.WriteHeader(httpStatusSkip)
+		w.WriteHeader(StatusSkip)
 		return
 	}
 
 	if err == ErrBlock {
-		w.WriteHeader(httpStatusBlock)
+		w.WriteHeader(StatusBlock)
 		return
 	}
 
-	// The error should be converted to a drone.Error so that
-	// it can be marshaled to JSON.
-	if _, ok := err.(*drone.Error); !ok {
-		err = &drone.Error{
-			Code:    http.StatusBadRequest,
-			Message: err.Error(),
-		}
-	}
-
-	out, _ := json.Marshal(err)
-	w.WriteHeader(http.StatusBadRequest)
-	_, _ = w.Write(out)
+	middleware.WriteError(w, err, http.StatusBadRequest)
 }
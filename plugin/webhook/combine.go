@@ -0,0 +1,53 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"context"
+	"sync"
+)
+
+// Broadcast returns a Plugin that delivers the webhook to all
+// plugins in parallel. Delivery is attempted for every plugin,
+// even if a plugin returns an error. If any plugin returns an
+// error, the error of the first plugin is returned.
+func Broadcast(plugins ...Plugin) Plugin {
+	return &broadcast{plugins: plugins}
+}
+
+type broadcast struct {
+	plugins []Plugin
+}
+
+func (p *broadcast) Deliver(ctx context.Context, req *Request) error {
+	errs := make([]error, len(p.plugins))
+
+	var wg sync.WaitGroup
+	for i, plugin := range p.plugins {
+		wg.Add(1)
+		go func(i int, plugin Plugin) {
+			defer wg.Done()
+			errs[i] = plugin.Deliver(ctx, req)
+		}(i, plugin)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+)
+
+func TestBroadcast(t *testing.T) {
+	var calls int32
+	count := pluginFunc(func(ctx context.Context, req *Request) error {
+		atomic.AddInt32(&calls, 1)
+		return nil
+	})
+
+	if err := Broadcast(count, count).Deliver(context.Background(), &Request{}); err != nil {
+		t.Error(err)
+	}
+	if got, want := atomic.LoadInt32(&calls), int32(2); got != want {
+		t.Errorf("Want webhook delivered to %d plugins, got %d", want, got)
+	}
+
+	// delivery is attempted for every plugin, and the error
+	// of the first plugin is returned.
+	atomic.StoreInt32(&calls, 0)
+	errFoo := errors.New("foo")
+	errBar := errors.New("bar")
+	plugin := Broadcast(count, &mockPlugin{err: errFoo}, &mockPlugin{err: errBar}, count)
+	if err := plugin.Deliver(context.Background(), &Request{}); err != errFoo {
+		t.Errorf("Want error of the first plugin, got %v", err)
+	}
+	if got, want := atomic.LoadInt32(&calls), int32(2); got != want {
+		t.Errorf("Want webhook delivered to %d plugins after an error, got %d", want, got)
+	}
+}
+
+type pluginFunc func(context.Context, *Request) error
+
+func (f pluginFunc) Deliver(ctx context.Context, req *Request) error {
+	return f(ctx, req)
+}